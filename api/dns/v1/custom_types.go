@@ -18,18 +18,20 @@ const (
 type WatchResourceKind string
 
 const (
-	WatchResourceKindTemplate        WatchResourceKind = "Template"
-	WatchResourceKindClusterTemplate WatchResourceKind = "ClusterTemplate"
-	WatchResourceKindNamespace       WatchResourceKind = "Namespace"
-	WatchResourceKindIngress         WatchResourceKind = "Ingress"
-	WatchResourceKindService         WatchResourceKind = "Service"
-	WatchResourceKindEndpoints       WatchResourceKind = "Endpoints"
-	WatchResourceKindNode            WatchResourceKind = "Node"
-	WatchResourceKindPod             WatchResourceKind = "Pod"
-	WatchResourceKindRecord          WatchResourceKind = "Record"
+	WatchResourceKindTemplate               WatchResourceKind = "Template"
+	WatchResourceKindClusterTemplate        WatchResourceKind = "ClusterTemplate"
+	WatchResourceKindNamespace              WatchResourceKind = "Namespace"
+	WatchResourceKindIngress                WatchResourceKind = "Ingress"
+	WatchResourceKindService                WatchResourceKind = "Service"
+	WatchResourceKindEndpoints              WatchResourceKind = "Endpoints"
+	WatchResourceKindNode                   WatchResourceKind = "Node"
+	WatchResourceKindPod                    WatchResourceKind = "Pod"
+	WatchResourceKindRecord                 WatchResourceKind = "Record"
+	WatchResourceKindTemplateLibrary        WatchResourceKind = "TemplateLibrary"
+	WatchResourceKindClusterTemplateLibrary WatchResourceKind = "ClusterTemplateLibrary"
 )
 
-// +kubebuilder:validation:Enum=A;CNAME;TXT;MX;SRV;AAAA;NS;CAA
+// +kubebuilder:validation:Enum=A;CNAME;TXT;MX;SRV;AAAA;NS;CAA;PTR
 type RecordType string
 
 const (
@@ -41,6 +43,29 @@ const (
 	RecordTypeAAAA  RecordType = "AAAA"
 	RecordTypeNS    RecordType = "NS"
 	RecordTypeCAA   RecordType = "CAA"
+	RecordTypePTR   RecordType = "PTR"
+)
+
+// What happens to the record on the provider side when the Record is deleted or no longer matches the provider
+// Delete: The record is deleted from the provider
+// Retain: The record is left untouched on the provider
+// +kubebuilder:validation:Enum=Delete;Retain
+type DeletionPolicy string
+
+const (
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+)
+
+// How a provider shares Records with the other providers matching them
+// Mirror: Records are pushed to the provider in addition to any other matching provider
+// Exclusive: Records are only pushed to the highest priority, most specific of the matching Exclusive providers
+// +kubebuilder:validation:Enum=Mirror;Exclusive
+type ProviderMatchMode string
+
+const (
+	ProviderMatchModeMirror    ProviderMatchMode = "Mirror"
+	ProviderMatchModeExclusive ProviderMatchMode = "Exclusive"
 )
 
 type NamespacedName struct {
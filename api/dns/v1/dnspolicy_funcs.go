@@ -0,0 +1,72 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// SelectsNamespace reports whether the policy applies to a namespace with the given labels
+func (p *DNSPolicySpec) SelectsNamespace(namespaceLabels map[string]string) (bool, error) {
+	selector, err := metav1.LabelSelectorAsSelector(&p.NamespaceSelector)
+	if err != nil {
+		return false, err
+	}
+	return selector.Matches(labels.Set(namespaceLabels)), nil
+}
+
+// Allows returns an error describing why the record is not allowed by the policy
+func (p *DNSPolicySpec) Allows(record *RecordSpec) error {
+	if len(p.AllowedDomains) != 0 && !slices.ContainsFunc(p.AllowedDomains, func(pattern string) bool { return MatchDomain(pattern, record.Name) }) {
+		return fmt.Errorf("domain %s is not allowed", record.Name)
+	}
+	if len(p.AllowedTypes) != 0 && !slices.Contains(p.AllowedTypes, record.Type) {
+		return fmt.Errorf("record type %s is not allowed", record.Type)
+	}
+	if record.TTL != 0 && p.MinTTL != 0 && record.TTL < p.MinTTL {
+		return fmt.Errorf("ttl %d is less than %d", record.TTL, p.MinTTL)
+	}
+	if record.TTL != 0 && p.MaxTTL != 0 && record.TTL > p.MaxTTL {
+		return fmt.Errorf("ttl %d is greater than %d", record.TTL, p.MaxTTL)
+	}
+	return nil
+}
+
+// Validate checks the record against all policies selecting its namespace.
+// The record is allowed if no policy selects the namespace or any selecting policy allows it.
+func (l *DNSPolicyList) Validate(namespaceLabels map[string]string, record *RecordSpec) error {
+	violations := make([]string, 0)
+	for _, policy := range l.Items {
+		if ok, err := policy.Spec.SelectsNamespace(namespaceLabels); err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+		if err := policy.Spec.Allows(record); err != nil {
+			violations = append(violations, fmt.Sprintf("DNSPolicy %s: %s", policy.Name, err.Error()))
+		} else {
+			return nil
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(violations, "; "))
+}
+
+// MatchDomain matches a domain against a pattern, "*" matches any domain and "*.sample.com" any subdomain of sample.com
+func MatchDomain(pattern, domain string) bool {
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if pattern == "*" {
+		return true
+	}
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(domain, "."+suffix)
+	}
+	return pattern == domain
+}
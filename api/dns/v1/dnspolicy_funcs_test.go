@@ -0,0 +1,68 @@
+package v1
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMatchDomain(t *testing.T) {
+	tests := []struct {
+		pattern, domain string
+		wants           bool
+	}{
+		{"*", "login.example.com", true},
+		{"login.example.com", "login.example.com", true},
+		{"login.example.com", "LOGIN.example.com.", true},
+		{"login.example.com", "api.example.com", false},
+		{"*.example.com", "api.example.com", true},
+		{"*.example.com", "a.b.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "badexample.com", false},
+	}
+	for _, tt := range tests {
+		if got := MatchDomain(tt.pattern, tt.domain); got != tt.wants {
+			t.Errorf("MatchDomain(%q, %q) = %v, want %v", tt.pattern, tt.domain, got, tt.wants)
+		}
+	}
+}
+
+func TestDNSPolicyListValidate(t *testing.T) {
+	policy := func(name, team string, spec DNSPolicySpec) DNSPolicy {
+		spec.NamespaceSelector = metav1.LabelSelector{MatchLabels: map[string]string{"team": team}}
+		return DNSPolicy{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: spec}
+	}
+	policies := &DNSPolicyList{Items: []DNSPolicy{
+		policy("web", "web", DNSPolicySpec{AllowedDomains: []string{"*.web.example.com"}, AllowedTypes: []RecordType{RecordTypeA, RecordTypeCNAME}}),
+		policy("web-login", "web", DNSPolicySpec{AllowedDomains: []string{"login.example.com"}, MinTTL: 60, MaxTTL: 3600}),
+		policy("ops", "ops", DNSPolicySpec{}),
+	}}
+
+	tests := []struct {
+		name    string
+		team    string
+		record  RecordSpec
+		allowed bool
+	}{
+		{name: "no policy selects the namespace", team: "other", record: RecordSpec{Name: "login.example.com", Type: RecordTypeA}, allowed: true},
+		{name: "empty policy allows everything", team: "ops", record: RecordSpec{Name: "login.example.com", Type: RecordTypeTXT}, allowed: true},
+		{name: "allowed domain and type", team: "web", record: RecordSpec{Name: "api.web.example.com", Type: RecordTypeA}, allowed: true},
+		{name: "type not allowed", team: "web", record: RecordSpec{Name: "api.web.example.com", Type: RecordTypeTXT}},
+		{name: "domain not allowed", team: "web", record: RecordSpec{Name: "api.example.com", Type: RecordTypeA}},
+		{name: "allowed by another policy", team: "web", record: RecordSpec{Name: "login.example.com", Type: RecordTypeTXT, TTL: 600}, allowed: true},
+		{name: "ttl too low", team: "web", record: RecordSpec{Name: "login.example.com", Type: RecordTypeA, TTL: 30}},
+		{name: "ttl too high", team: "web", record: RecordSpec{Name: "login.example.com", Type: RecordTypeA, TTL: 7200}},
+		{name: "default ttl", team: "web", record: RecordSpec{Name: "login.example.com", Type: RecordTypeA}, allowed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policies.Validate(map[string]string{"team": tt.team}, &tt.record)
+			if tt.allowed && err != nil {
+				t.Errorf("expected the record to be allowed, got %v", err)
+			}
+			if !tt.allowed && err == nil {
+				t.Error("expected a violation")
+			}
+		})
+	}
+}
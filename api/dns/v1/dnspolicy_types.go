@@ -0,0 +1,67 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DNSPolicySpec defines which Records the selected namespaces may claim
+type DNSPolicySpec struct {
+	// Namespaces the policy applies to, an empty selector selects all namespaces
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// Domains the Records may claim, "*.sample.com" matches any subdomain of sample.com
+	// If empty, any domain is allowed
+	AllowedDomains []string `json:"allowedDomains,omitempty"`
+	// If empty, any record type is allowed
+	AllowedTypes []RecordType `json:"allowedTypes,omitempty"`
+	// Records without ttl use the default of the provider and are not checked
+	MinTTL int `json:"minTTL,omitempty"`
+	MaxTTL int `json:"maxTTL,omitempty"`
+}
+
+// DNSPolicyStatus defines the observed state of DNSPolicy
+type DNSPolicyStatus struct {
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Domains",type=string,JSONPath=`.spec.allowedDomains`
+// +kubebuilder:printcolumn:name="Types",type=string,JSONPath=`.spec.allowedTypes`
+
+// DNSPolicy restricts the domains, record types and ttl a namespace may claim
+type DNSPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DNSPolicySpec   `json:"spec,omitempty"`
+	Status DNSPolicyStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DNSPolicyList contains a list of DNSPolicy
+type DNSPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DNSPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DNSPolicy{}, &DNSPolicyList{})
+}
@@ -1,12 +1,17 @@
 package v1
 
 import (
+	"fmt"
+	"slices"
 	"strings"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 )
 
+const OwnershipMarkerPrefix = "kube-dns-manager:"
+
 func (s *ProviderSelector) Matches(record *Record) (bool, error) {
 	if s.Domain != "" {
 		if record.Spec.Name != s.Domain && !strings.HasSuffix(record.Spec.Name, "."+s.Domain) {
@@ -25,6 +30,78 @@ func (s *ProviderSelector) Matches(record *Record) (bool, error) {
 	return true, nil
 }
 
+// SelectProviders returns the providers the record should be pushed to: every matching Mirror provider
+// and the preferred one of the matching Exclusive providers
+func SelectProviders(providers []ProviderObject, record *Record) ([]ProviderObject, error) {
+	selected := make([]ProviderObject, 0, len(providers))
+	var exclusive ProviderObject
+	for _, provider := range providers {
+		if ok, err := provider.GetSpec().Selector.Matches(record); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		if provider.GetSpec().MatchMode != ProviderMatchModeExclusive {
+			selected = append(selected, provider)
+		} else if exclusive == nil || preferProvider(provider, exclusive) {
+			exclusive = provider
+		}
+	}
+	if exclusive != nil {
+		selected = append(selected, exclusive)
+	}
+	return selected, nil
+}
+
+// preferProvider reports whether a is preferred over b: higher priority first, then the longer (more specific) domain,
+// then a namespaced Provider over a ClusterProvider, then the name for a stable result
+func preferProvider(a, b ProviderObject) bool {
+	if a.GetSpec().Priority != b.GetSpec().Priority {
+		return a.GetSpec().Priority > b.GetSpec().Priority
+	}
+	if len(a.GetSpec().Selector.Domain) != len(b.GetSpec().Selector.Domain) {
+		return len(a.GetSpec().Selector.Domain) > len(b.GetSpec().Selector.Domain)
+	}
+	if (a.GetNamespace() == "") != (b.GetNamespace() == "") {
+		return a.GetNamespace() != ""
+	}
+	return a.GetName() < b.GetName()
+}
+
+// Marker returns the ownership marker written to records on the provider side, empty if pruning is disabled
+func (c *ProviderPruneConfig) Marker(uid types.UID) string {
+	if c == nil || !c.Enabled {
+		return ""
+	}
+	if c.OwnerID != "" {
+		return OwnershipMarkerPrefix + c.OwnerID
+	}
+	return OwnershipMarkerPrefix + string(uid)
+}
+
+// Check returns an error if the record is not supported by the provider, nil capabilities support everything
+func (c *ProviderCapabilities) Check(record *RecordSpec) error {
+	if c == nil {
+		return nil
+	}
+	if len(c.RecordTypes) != 0 && !slices.Contains(c.RecordTypes, record.Type) {
+		return fmt.Errorf("record type %s is not supported by the provider", record.Type)
+	}
+	if proxied := record.ExtraBool(ExtraKeyProxied); proxied != nil && *proxied && !c.Proxy {
+		return fmt.Errorf("proxied records are not supported by the provider")
+	}
+	if record.TTL == 0 || slices.Contains(c.ExtraTTLs, record.TTL) {
+		return nil
+	}
+	if c.MinTTL != 0 && record.TTL < c.MinTTL {
+		return fmt.Errorf("ttl %d is less than the minimum %d supported by the provider", record.TTL, c.MinTTL)
+	}
+	if c.MaxTTL != 0 && record.TTL > c.MaxTTL {
+		return fmt.Errorf("ttl %d is greater than the maximum %d supported by the provider", record.TTL, c.MaxTTL)
+	}
+	return nil
+}
+
 func (p *Provider) GetSpec() *ProviderSpec     { return &p.Spec }
 func (p *Provider) GetStatus() *ProviderStatus { return &p.Status }
 func (p *Provider) New() ProviderObject        { return &Provider{} }
@@ -0,0 +1,114 @@
+package v1
+
+import (
+	"slices"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestProviderCapabilitiesCheck(t *testing.T) {
+	cloudflare := &ProviderCapabilities{MinTTL: 60, MaxTTL: 86400, ExtraTTLs: []int{1}, Proxy: true}
+	adguard := &ProviderCapabilities{RecordTypes: []RecordType{RecordTypeA, RecordTypeAAAA, RecordTypeCNAME}}
+	proxied := map[string]string{ExtraKeyProxied: "true"}
+
+	tests := []struct {
+		name    string
+		caps    *ProviderCapabilities
+		record  RecordSpec
+		wantErr bool
+	}{
+		{name: "nil capabilities", record: RecordSpec{Type: RecordTypeTXT, TTL: 5, Extra: proxied}},
+		{name: "supported type", caps: adguard, record: RecordSpec{Type: RecordTypeCNAME}},
+		{name: "unsupported type", caps: adguard, record: RecordSpec{Type: RecordTypeTXT}, wantErr: true},
+		{name: "default ttl", caps: cloudflare, record: RecordSpec{Type: RecordTypeA}},
+		{name: "extra ttl", caps: cloudflare, record: RecordSpec{Type: RecordTypeA, TTL: 1}},
+		{name: "ttl too low", caps: cloudflare, record: RecordSpec{Type: RecordTypeA, TTL: 30}, wantErr: true},
+		{name: "ttl too high", caps: cloudflare, record: RecordSpec{Type: RecordTypeA, TTL: 86401}, wantErr: true},
+		{name: "proxied", caps: cloudflare, record: RecordSpec{Type: RecordTypeA, Extra: proxied}},
+		{name: "proxy not supported", caps: adguard, record: RecordSpec{Type: RecordTypeA, Extra: proxied}, wantErr: true},
+		{name: "not proxied", caps: adguard, record: RecordSpec{Type: RecordTypeA, Extra: map[string]string{ExtraKeyProxied: "false"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.caps.Check(&tt.record); (err != nil) != tt.wantErr {
+				t.Errorf("Check = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSelectProviders(t *testing.T) {
+	provider := func(namespace, name, domain string, mode ProviderMatchMode, priority int) ProviderObject {
+		spec := ProviderSpec{Selector: ProviderSelector{Domain: domain}, MatchMode: mode, Priority: priority}
+		if namespace == "" {
+			return &ClusterProvider{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: spec}
+		}
+		return &Provider{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}, Spec: spec}
+	}
+	record := &Record{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "api"},
+		Spec:       RecordSpec{Name: "api.internal.example.com", Type: RecordTypeA, Value: "10.0.0.1"},
+	}
+
+	tests := []struct {
+		name      string
+		providers []ProviderObject
+		selected  []string
+	}{
+		{
+			name:      "mirror providers all selected",
+			providers: []ProviderObject{provider("", "public", "example.com", ProviderMatchModeMirror, 0), provider("default", "internal", "internal.example.com", ProviderMatchModeMirror, 0)},
+			selected:  []string{"public", "internal"},
+		},
+		{
+			name:      "not matching",
+			providers: []ProviderObject{provider("", "other", "example.org", ProviderMatchModeExclusive, 0)},
+			selected:  []string{},
+		},
+		{
+			name:      "higher priority wins",
+			providers: []ProviderObject{provider("", "a", "internal.example.com", ProviderMatchModeExclusive, 0), provider("", "b", "example.com", ProviderMatchModeExclusive, 10)},
+			selected:  []string{"b"},
+		},
+		{
+			name:      "more specific domain wins",
+			providers: []ProviderObject{provider("", "a", "example.com", ProviderMatchModeExclusive, 0), provider("", "b", "internal.example.com", ProviderMatchModeExclusive, 0)},
+			selected:  []string{"b"},
+		},
+		{
+			name:      "namespaced provider wins",
+			providers: []ProviderObject{provider("", "a", "example.com", ProviderMatchModeExclusive, 0), provider("default", "b", "example.com", ProviderMatchModeExclusive, 0)},
+			selected:  []string{"b"},
+		},
+		{
+			name:      "name breaks ties",
+			providers: []ProviderObject{provider("", "b", "example.com", ProviderMatchModeExclusive, 0), provider("", "a", "example.com", ProviderMatchModeExclusive, 0)},
+			selected:  []string{"a"},
+		},
+		{
+			name: "mirror providers and one exclusive",
+			providers: []ProviderObject{
+				provider("", "exclusive-low", "example.com", ProviderMatchModeExclusive, 0),
+				provider("", "mirror", "example.com", ProviderMatchModeMirror, 0),
+				provider("", "exclusive-high", "example.com", ProviderMatchModeExclusive, 1),
+			},
+			selected: []string{"mirror", "exclusive-high"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := SelectProviders(tt.providers, record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := make([]string, len(selected))
+			for i, provider := range selected {
+				names[i] = provider.GetName()
+			}
+			if !slices.Equal(names, tt.selected) {
+				t.Errorf("selected %v, want %v", names, tt.selected)
+			}
+		})
+	}
+}
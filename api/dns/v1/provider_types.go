@@ -24,7 +24,7 @@ import (
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
-// +kubebuilder:validation:Enum=ALIYUN;CLOUDFLARE;JOB;ADGUARD
+// +kubebuilder:validation:Enum=ALIYUN;CLOUDFLARE;JOB;ADGUARD;PIHOLE;COREDNS_CONFIGMAP;ETCD;EXEC;PLUGIN
 type ProviderType string
 
 const (
@@ -32,6 +32,11 @@ const (
 	ProviderTypeCloudflare ProviderType = "CLOUDFLARE"
 	ProviderTypeJob        ProviderType = "JOB"
 	ProviderTypeAdguard    ProviderType = "ADGUARD"
+	ProviderTypePihole     ProviderType = "PIHOLE"
+	ProviderTypeCoreDNS    ProviderType = "COREDNS_CONFIGMAP"
+	ProviderTypeEtcd       ProviderType = "ETCD"
+	ProviderTypeExec       ProviderType = "EXEC"
+	ProviderTypePlugin     ProviderType = "PLUGIN"
 )
 
 // When to write back data to record's data field
@@ -75,12 +80,123 @@ type JobProviderConfig struct {
 
 	DataTemplate       GoTemplateString   `json:"dataTemplate,omitempty"`
 	DataUpdateStrategy DataUpdateStrategy `json:"dataUpdateStrategy,omitempty"`
+
+	// The termination message of the finished Pod is available to the templates as .Output
+	// If true, the Pod logs are also available as .Logs
+	CaptureLogs bool `json:"captureLogs,omitempty"`
+	// Maximum size in bytes of the captured output and logs
+	// +kubebuilder:default:=4096
+	MaxOutputBytes int `json:"maxOutputBytes,omitempty"`
+	// If true, the output of a completed create or update Job is used as the ID of the record,
+	// the following Jobs get it as .RecordID
+	OutputAsID bool `json:"outputAsID,omitempty"`
+	// Number of times a failed Job is recreated before the failure is reported, the failed Jobs are deleted.
+	// The provider then gives up on the action until the Record changes, see the annotation dns.xzzpig.com/job-failures
+	// +kubebuilder:validation:Minimum=0
+	MaxRetries int `json:"maxRetries,omitempty"`
+	// Injected into Jobs which do not set it, so Jobs left behind by deleted Records are cleaned up.
+	// A Job deleted before its result was recorded is not run again, the provider gives up on the action as for failures
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
 }
 
+// Records of type A, AAAA and CNAME are supported, the value may contain several answers separated by commas or spaces
 type AdguardProviderConfig struct {
 	URL      string `json:"url"`
 	Username string `json:"username,omitempty"`
 	Password string `json:"password,omitempty"`
+	// Timeout of each request to AdGuard Home
+	// +kubebuilder:default:="30s"
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+	// PEM encoded CA certificates trusted in addition to the system ones when verifying AdGuard Home
+	CABundle string `json:"caBundle,omitempty"`
+	// Skip verifying the certificate of AdGuard Home
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+type PiholeProviderConfig struct {
+	URL string `json:"url"`
+	// Password of the web interface or an application password, used to open a session with the REST API of Pi-hole v6
+	Password string `json:"password,omitempty"`
+	// API token of Pi-hole v5, if set the legacy admin/api.php endpoint is used instead of the REST API
+	Token string `json:"token,omitempty"`
+}
+
+// Format of the file rendered into the ConfigMap
+// Hosts: /etc/hosts format for the hosts plugin, only A and AAAA records are supported
+// Zone: RFC 1035 zone file for the file plugin
+// +kubebuilder:validation:Enum=Hosts;Zone
+type CoreDNSFormat string
+
+const (
+	CoreDNSFormatHosts CoreDNSFormat = "Hosts"
+	CoreDNSFormatZone  CoreDNSFormat = "Zone"
+)
+
+type CoreDNSProviderConfig struct {
+	// Name of the ConfigMap the records are rendered into
+	Name string `json:"name"`
+	// Namespace of the ConfigMap, defaults to the namespace of the Provider or kube-system for a ClusterProvider.
+	// A namespaced Provider can only use its own namespace
+	Namespace string `json:"namespace,omitempty"`
+	// +kubebuilder:default:=Hosts
+	Format CoreDNSFormat `json:"format,omitempty"`
+	// Key of the rendered file in the ConfigMap, defaults to hosts or db.<zone>.
+	// Only a ClusterProvider can choose another key, e.g. to share a ConfigMap with the Corefile.
+	// The records the file is rendered from are kept under <key>.records.json
+	Key string `json:"key,omitempty"`
+	// Origin of the zone file, if empty, spec.selector.domain will be used
+	Zone string `json:"zone,omitempty"`
+	// TTL of records which do not specify one
+	// +kubebuilder:default:=300
+	TTL int `json:"ttl,omitempty"`
+}
+
+// Records are written in the SkyDNS message layout read by the etcd plugin of CoreDNS
+type EtcdProviderConfig struct {
+	Endpoints []string `json:"endpoints"`
+	// Prefix of the keys, must match the path of the etcd plugin
+	// +kubebuilder:default:="/skydns"
+	Prefix   string `json:"prefix,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// PEM encoded CA certificates used to verify the etcd servers
+	CACert string `json:"caCert,omitempty"`
+	// PEM encoded client certificate and key used to authenticate to the etcd servers
+	ClientCert string `json:"clientCert,omitempty"`
+	ClientKey  string `json:"clientKey,omitempty"`
+	// Skip verifying the certificates of the etcd servers
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+	// +kubebuilder:default:="5s"
+	DialTimeout metav1.Duration `json:"dialTimeout,omitempty"`
+}
+
+// The command is run in the manager container for every operation, it gets the operation as JSON on stdin
+// and may print {"id": "...", "data": "..."} on stdout, a non-zero exit code fails the operation.
+// Tools of a sidecar can be shared with the manager container through a volume
+type ExecProviderConfig struct {
+	// Command and arguments, e.g. ["/scripts/nsupdate.sh"].
+	// Only a ClusterProvider can run commands, unless the executable is allowed by the --exec-allowed-commands flag of the manager
+	Command []string `json:"command"`
+	// Environment variables of the command, only PATH is passed on from the environment of the manager
+	Env map[string]string `json:"env,omitempty"`
+	// Working directory of the command, defaults to the working directory of the manager
+	WorkingDir string `json:"workingDir,omitempty"`
+	// The command is killed if it does not finish in time
+	// +kubebuilder:default:="30s"
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+}
+
+// The operations are sent to a plugin serving the gRPC service kdm.provider.v1.DNSProvider,
+// e.g. a sidecar listening on a Unix socket in a shared volume or a Service in the cluster
+type PluginProviderConfig struct {
+	// Address of the plugin, either unix:///path/to/socket or host:port, connected without transport security.
+	// Only a ClusterProvider can use plugins, unless the address is allowed by the --plugin-allowed-addresses flag of the manager
+	Address string `json:"address"`
+	// Settings passed to the plugin with every call
+	Config map[string]string `json:"config,omitempty"`
+	// Timeout of every call to the plugin
+	// +kubebuilder:default:="10s"
+	Timeout metav1.Duration `json:"timeout,omitempty"`
 }
 
 // ProviderSpec defines the desired state of Provider
@@ -91,6 +207,44 @@ type ProviderSpec struct {
 	Cloudflare *CloudflareProviderConfig `json:"cloudflare,omitempty"`
 	Job        *JobProviderConfig        `json:"job,omitempty"`
 	Adguard    *AdguardProviderConfig    `json:"adguard,omitempty"`
+	Pihole     *PiholeProviderConfig     `json:"pihole,omitempty"`
+	CoreDNS    *CoreDNSProviderConfig    `json:"coredns,omitempty"`
+	Etcd       *EtcdProviderConfig       `json:"etcd,omitempty"`
+	Exec       *ExecProviderConfig       `json:"exec,omitempty"`
+	Plugin     *PluginProviderConfig     `json:"plugin,omitempty"`
+	Prune      *ProviderPruneConfig      `json:"prune,omitempty"`
+	// Periodically probe the provider so revoked credentials or removed zones are detected
+	HealthCheck *ProviderHealthCheckConfig `json:"healthCheck,omitempty"`
+	// How the provider shares Records with the other providers matching them
+	// +kubebuilder:default:=Mirror
+	MatchMode ProviderMatchMode `json:"matchMode,omitempty"`
+	// Priority among the Exclusive providers matching the same Record, the highest wins
+	Priority int `json:"priority,omitempty"`
+	// Overrides the capabilities declared by the provider type, e.g. to describe the backend of an EXEC, JOB or PLUGIN provider
+	Capabilities *ProviderCapabilities `json:"capabilities,omitempty"`
+	// Default deletion policy for records managed by this provider, can be overridden by the Record
+	// +kubebuilder:default:=Delete
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+type ProviderPruneConfig struct {
+	// Delete records on the provider side which carry our ownership marker but are not referenced by any Record
+	Enabled bool `json:"enabled,omitempty"`
+	// Identifies the owner in the ownership marker written to the provider, defaults to the UID of the provider
+	// Set it explicitly to keep ownership of existing records when the provider is recreated
+	OwnerID string `json:"ownerID,omitempty"`
+	// How long an orphaned record must be observed before it is deleted
+	// +kubebuilder:default:="10m"
+	GracePeriod metav1.Duration `json:"gracePeriod,omitempty"`
+	// How often the provider side is scanned for orphaned records
+	// +kubebuilder:default:="10m"
+	Interval metav1.Duration `json:"interval,omitempty"`
+}
+
+type ProviderHealthCheckConfig struct {
+	// How often the provider is probed
+	// +kubebuilder:default:="5m"
+	Interval metav1.Duration `json:"interval,omitempty"`
 }
 
 type ProviderSelector struct {
@@ -101,8 +255,61 @@ type ProviderSelector struct {
 
 // ProviderStatus defines the observed state of Provider
 type ProviderStatus struct {
-	Ready  bool   `json:"ready"`
-	Reason string `json:"reason,omitempty"`
+	Ready  bool                 `json:"ready"`
+	Reason string               `json:"reason,omitempty"`
+	Prune  *ProviderPruneStatus `json:"prune,omitempty"`
+	// Capabilities declared by the provider type or overridden by the spec, Records are checked against them before being pushed
+	Capabilities *ProviderCapabilities `json:"capabilities,omitempty"`
+	// Last time the provider was probed by the health check
+	LastProbeTime *metav1.Time `json:"lastProbeTime,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+const (
+	// The provider is built and usable
+	ProviderConditionReady = "Ready"
+	// The credentials of the provider are accepted by the backend
+	ProviderConditionAuthenticated = "Authenticated"
+	// The zone managed by the provider exists on the backend
+	ProviderConditionZoneFound = "ZoneFound"
+)
+
+type ProviderCapabilities struct {
+	// Record types supported by the provider, all types are supported if empty
+	RecordTypes []RecordType `json:"recordTypes,omitempty"`
+	// Minimum TTL accepted by the provider, unbounded if 0
+	MinTTL int `json:"minTTL,omitempty"`
+	// Maximum TTL accepted by the provider, unbounded if 0
+	MaxTTL int `json:"maxTTL,omitempty"`
+	// TTL values accepted outside the bounds, e.g. 1 meaning automatic TTL on Cloudflare
+	ExtraTTLs []int `json:"extraTTLs,omitempty"`
+	// Whether the provider can proxy traffic for records
+	Proxy bool `json:"proxy,omitempty"`
+	// Maximum number of records with the same name, unlimited if 0
+	MaxRecordsPerName int `json:"maxRecordsPerName,omitempty"`
+	// Whether the backend supports batch changes, informational only: Records are pushed one at a time
+	Batch bool `json:"batch,omitempty"`
+}
+
+type ProviderPruneStatus struct {
+	LastPruneTime *metav1.Time `json:"lastPruneTime,omitempty"`
+	Message       string       `json:"message,omitempty"`
+	// Total number of orphaned records deleted from the provider
+	Pruned int `json:"pruned,omitempty"`
+	// Orphaned records waiting for the grace period to expire
+	Orphans []ProviderOrphanRecord `json:"orphans,omitempty"`
+	// IDs of the records left on the provider side by Records deleted with the Retain policy, they are never pruned
+	Retained []string `json:"retained,omitempty"`
+}
+
+type ProviderOrphanRecord struct {
+	ID        string      `json:"id"`
+	Name      string      `json:"name,omitempty"`
+	Type      RecordType  `json:"type,omitempty"`
+	Value     string      `json:"value,omitempty"`
+	FirstSeen metav1.Time `json:"firstSeen"`
 }
 
 // +kubebuilder:object:generate=false
@@ -1,6 +1,10 @@
 package v1
 
-import "strings"
+import (
+	"fmt"
+	"net"
+	"strings"
+)
 
 func (r *RecordList) Get(namespace, name string) *Record {
 	for i := range r.Items {
@@ -36,6 +40,69 @@ func (r *RecordSpec) ExtraStrings(key string) []string {
 	return nil
 }
 
+// GetDeletionPolicy returns the deletion policy of the record, falling back to the provider's policy
+func (r *RecordSpec) GetDeletionPolicy(provider *ProviderSpec) DeletionPolicy {
+	if r.DeletionPolicy != "" {
+		return r.DeletionPolicy
+	}
+	if provider != nil && provider.DeletionPolicy != "" {
+		return provider.DeletionPolicy
+	}
+	return DeletionPolicyDelete
+}
+
+// ConflictsWith reports whether both records claim the same remote record: a name has a single CNAME record,
+// so CNAME records of the same name always conflict, whatever their values. Records of the other types with
+// the same name conflict only if their values are equal, different values coexist as a multi-value record
+func (r *RecordSpec) ConflictsWith(other *RecordSpec) bool {
+	if !strings.EqualFold(r.Name, other.Name) || r.Type != other.Type {
+		return false
+	}
+	if r.Type == RecordTypeCNAME {
+		return true
+	}
+	return r.Value == other.Value
+}
+
+// OlderThan reports whether the record was created before the other one, ties are broken by namespace and name
+func (r *Record) OlderThan(other *Record) bool {
+	if !r.CreationTimestamp.Equal(&other.CreationTimestamp) {
+		return r.CreationTimestamp.Before(&other.CreationTimestamp)
+	}
+	if r.Namespace != other.Namespace {
+		return r.Namespace < other.Namespace
+	}
+	return r.Name < other.Name
+}
+
+// ReverseName returns the name of the PTR record for the address of an A/AAAA record
+func (r *RecordSpec) ReverseName() (string, error) {
+	ip := net.ParseIP(r.Value)
+	if ip == nil {
+		return "", fmt.Errorf("invalid ip address %s", r.Value)
+	}
+	if r.Type == RecordTypeA {
+		ipv4 := ip.To4()
+		if ipv4 == nil {
+			return "", fmt.Errorf("invalid ipv4 address %s", r.Value)
+		}
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", ipv4[3], ipv4[2], ipv4[1], ipv4[0]), nil
+	}
+	if r.Type == RecordTypeAAAA && ip.To4() == nil {
+		const hex = "0123456789abcdef"
+		name := new(strings.Builder)
+		for i := len(ip) - 1; i >= 0; i-- {
+			name.WriteByte(hex[ip[i]&0x0f])
+			name.WriteByte('.')
+			name.WriteByte(hex[ip[i]>>4])
+			name.WriteByte('.')
+		}
+		name.WriteString("ip6.arpa")
+		return name.String(), nil
+	}
+	return "", fmt.Errorf("can not create reverse record for %s record %s", r.Type, r.Value)
+}
+
 func (s *RecordStatus) FindProviderStatus(p NamespacedName) *RecordProviderStatus {
 	for _, provider := range s.Providers {
 		if provider.NamespacedName.Equal(&p) {
@@ -0,0 +1,86 @@
+package v1
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConflictsWith(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  RecordSpec
+		wants bool
+	}{
+		{"same CNAME", RecordSpec{Name: "api.example.com", Type: RecordTypeCNAME, Value: "lb.example.com"}, RecordSpec{Name: "api.example.com", Type: RecordTypeCNAME, Value: "lb.example.com"}, true},
+		{"different CNAME values", RecordSpec{Name: "api.example.com", Type: RecordTypeCNAME, Value: "a.example.com"}, RecordSpec{Name: "api.example.com", Type: RecordTypeCNAME, Value: "b.example.com"}, true},
+		{"CNAME names differ in case", RecordSpec{Name: "API.example.com", Type: RecordTypeCNAME, Value: "a.example.com"}, RecordSpec{Name: "api.example.com", Type: RecordTypeCNAME, Value: "b.example.com"}, true},
+		{"same A value", RecordSpec{Name: "api.example.com", Type: RecordTypeA, Value: "10.0.0.1"}, RecordSpec{Name: "api.example.com", Type: RecordTypeA, Value: "10.0.0.1"}, true},
+		{"multi-value A", RecordSpec{Name: "api.example.com", Type: RecordTypeA, Value: "10.0.0.1"}, RecordSpec{Name: "api.example.com", Type: RecordTypeA, Value: "10.0.0.2"}, false},
+		{"different types", RecordSpec{Name: "api.example.com", Type: RecordTypeA, Value: "10.0.0.1"}, RecordSpec{Name: "api.example.com", Type: RecordTypeAAAA, Value: "::1"}, false},
+		{"different names", RecordSpec{Name: "a.example.com", Type: RecordTypeCNAME, Value: "lb.example.com"}, RecordSpec{Name: "b.example.com", Type: RecordTypeCNAME, Value: "lb.example.com"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.ConflictsWith(&tt.b); got != tt.wants {
+				t.Errorf("a.ConflictsWith(b) = %v, want %v", got, tt.wants)
+			}
+			if got := tt.b.ConflictsWith(&tt.a); got != tt.wants {
+				t.Errorf("b.ConflictsWith(a) = %v, want %v", got, tt.wants)
+			}
+		})
+	}
+}
+
+func TestOlderThan(t *testing.T) {
+	now := time.Now()
+	record := func(namespace, name string, created time.Time) *Record {
+		return &Record{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, CreationTimestamp: metav1.NewTime(created)}}
+	}
+	tests := []struct {
+		name  string
+		a, b  *Record
+		wants bool
+	}{
+		{"created earlier", record("b", "b", now.Add(-time.Minute)), record("a", "a", now), true},
+		{"created later", record("a", "a", now), record("b", "b", now.Add(-time.Minute)), false},
+		{"same time, namespace first", record("a", "z", now), record("b", "a", now), true},
+		{"same time and namespace, name first", record("a", "a", now), record("a", "b", now), true},
+		{"itself", record("a", "a", now), record("a", "a", now), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.OlderThan(tt.b); got != tt.wants {
+				t.Errorf("OlderThan = %v, want %v", got, tt.wants)
+			}
+		})
+	}
+}
+
+func TestReverseName(t *testing.T) {
+	tests := []struct {
+		record  RecordSpec
+		wants   string
+		wantErr bool
+	}{
+		{record: RecordSpec{Type: RecordTypeA, Value: "192.168.1.10"}, wants: "10.1.168.192.in-addr.arpa"},
+		{record: RecordSpec{Type: RecordTypeAAAA, Value: "2001:db8::1"}, wants: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa"},
+		{record: RecordSpec{Type: RecordTypeA, Value: "2001:db8::1"}, wantErr: true},
+		{record: RecordSpec{Type: RecordTypeAAAA, Value: "192.168.1.10"}, wantErr: true},
+		{record: RecordSpec{Type: RecordTypeA, Value: "not-an-ip"}, wantErr: true},
+		{record: RecordSpec{Type: RecordTypeCNAME, Value: "10.0.0.1"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := tt.record.ReverseName()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ReverseName(%s %s) = %q, want an error", tt.record.Type, tt.record.Value, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.wants {
+			t.Errorf("ReverseName(%s %s) = %q, %v, want %q", tt.record.Type, tt.record.Value, got, err, tt.wants)
+		}
+	}
+}
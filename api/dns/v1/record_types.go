@@ -23,6 +23,20 @@ import (
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+const (
+	// RecordConditionConflict is true when another Record claims the same name and type on a shared provider
+	RecordConditionConflict = "Conflict"
+	// RecordConditionPolicyViolation is true when the Record is not allowed by the DNSPolicies selecting its namespace
+	RecordConditionPolicyViolation = "PolicyViolation"
+
+	// LabelReverseOf is set on PTR Records created for the Record with this name,
+	// the value is empty if the name is not a valid label value
+	LabelReverseOf = "dns.xzzpig.com/reverse-of"
+
+	// ExtraKeyProxied asks the provider to proxy the traffic of the record, only providers declaring the proxy capability accept it
+	ExtraKeyProxied = "dns.xzzpig.com/cloudflare/proxied"
+)
+
 // RecordSpec defines the desired state of Record
 type RecordSpec struct {
 	Name  string            `json:"name"`
@@ -30,6 +44,10 @@ type RecordSpec struct {
 	Value string            `json:"value"`
 	TTL   int               `json:"ttl,omitempty"`
 	Extra map[string]string `json:"extra,omitempty"`
+	// If empty, the deletionPolicy of the provider will be used
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// Create a PTR Record in the in-addr.arpa/ip6.arpa zone for A/AAAA records
+	Reverse bool `json:"reverse,omitempty"`
 }
 
 // RecordStatus defines the observed state of Record
@@ -38,6 +56,9 @@ type RecordStatus struct {
 	AllReady  bool                    `json:"allReady"`
 	Message   string                  `json:"message,omitempty"`
 	Providers []*RecordProviderStatus `json:"providers,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 type RecordProviderStatus struct {
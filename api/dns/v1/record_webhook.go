@@ -0,0 +1,100 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var recordlog = logf.Log.WithName("record-resource")
+
+// SetupWebhookWithManager will setup the manager to manage the webhooks
+func (r *Record) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithValidator(&RecordValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-dns-xzzpig-com-v1-record,mutating=false,failurePolicy=fail,sideEffects=None,groups=dns.xzzpig.com,resources=records,verbs=create;update,versions=v1,name=vrecord.kb.io,admissionReviewVersions=v1
+
+// RecordValidator rejects Records which are not allowed by the DNSPolicies selecting their namespace
+// +kubebuilder:object:generate=false
+type RecordValidator struct {
+	Client client.Reader
+}
+
+var _ webhook.CustomValidator = &RecordValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *RecordValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	record, ok := obj.(*Record)
+	if !ok {
+		return nil, fmt.Errorf("expected a Record but got a %T", obj)
+	}
+	recordlog.Info("validate create", "name", record.Name)
+	return nil, v.validate(ctx, record)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *RecordValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldRecord, ok := oldObj.(*Record)
+	if !ok {
+		return nil, fmt.Errorf("expected a Record but got a %T", oldObj)
+	}
+	record, ok := newObj.(*Record)
+	if !ok {
+		return nil, fmt.Errorf("expected a Record but got a %T", newObj)
+	}
+	// metadata only updates (e.g. finalizer removal) must always pass
+	if equality.Semantic.DeepEqual(oldRecord.Spec, record.Spec) {
+		return nil, nil
+	}
+	recordlog.Info("validate update", "name", record.Name)
+	return nil, v.validate(ctx, record)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *RecordValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *RecordValidator) validate(ctx context.Context, record *Record) error {
+	policyList := &DNSPolicyList{}
+	if err := v.Client.List(ctx, policyList); err != nil {
+		return err
+	}
+	if len(policyList.Items) == 0 {
+		return nil
+	}
+	namespace := &corev1.Namespace{}
+	if err := v.Client.Get(ctx, client.ObjectKey{Name: record.Namespace}, namespace); err != nil {
+		return err
+	}
+	return policyList.Validate(namespace.Labels, &record.Spec)
+}
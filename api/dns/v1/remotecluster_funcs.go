@@ -0,0 +1,52 @@
+package v1
+
+import (
+	"fmt"
+	"hash/fnv"
+	"maps"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GetClusterName returns the name identifying the remote cluster
+func (c *RemoteCluster) GetClusterName() string {
+	if c.Spec.ClusterName != "" {
+		return c.Spec.ClusterName
+	}
+	return c.Name
+}
+
+// MirrorName returns the name of the local Record mirroring the remote Record namespace/name
+func (c *RemoteCluster) MirrorName(namespace, name string) string {
+	mirrorName := fmt.Sprintf("%s-%s-%s", c.GetClusterName(), namespace, name)
+	if len(mirrorName) <= 253 {
+		return mirrorName
+	}
+	h := fnv.New32a()
+	h.Write([]byte(mirrorName))
+	return fmt.Sprintf("%s-%08x", mirrorName[:244], h.Sum32())
+}
+
+// MirrorRecord returns the local Record mirroring the remote one, labeled with the identity of the cluster
+func (c *RemoteCluster) MirrorRecord(remote *Record) *Record {
+	record := &Record{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   c.Namespace,
+			Name:        c.MirrorName(remote.Namespace, remote.Name),
+			Labels:      maps.Clone(remote.Labels),
+			Annotations: map[string]string{AnnotationRemoteRecord: remote.Namespace + "/" + remote.Name},
+		},
+		Spec: *remote.Spec.DeepCopy(),
+	}
+	if record.Labels == nil {
+		record.Labels = make(map[string]string)
+	}
+	record.Labels[LabelCluster] = c.GetClusterName()
+	if len(c.Spec.Extra) != 0 {
+		if record.Spec.Extra == nil {
+			record.Spec.Extra = make(map[string]string)
+		}
+		maps.Copy(record.Spec.Extra, c.Spec.Extra)
+	}
+	return record
+}
@@ -0,0 +1,55 @@
+package v1
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMirrorName(t *testing.T) {
+	cluster := &RemoteCluster{ObjectMeta: metav1.ObjectMeta{Name: "east"}}
+	if name := cluster.MirrorName("default", "web"); name != "east-default-web" {
+		t.Errorf("MirrorName = %s, want east-default-web", name)
+	}
+
+	long := strings.Repeat("a", 250)
+	name := cluster.MirrorName("default", long)
+	if len(name) > 253 {
+		t.Errorf("MirrorName is %d characters long", len(name))
+	}
+	if other := cluster.MirrorName("default", long+"b"); other == name {
+		t.Error("truncated names of different Records collide")
+	}
+}
+
+func TestMirrorRecord(t *testing.T) {
+	cluster := &RemoteCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "mirror", Name: "east"},
+		Spec:       RemoteClusterSpec{ClusterName: "cluster-east", Extra: map[string]string{ExtraKeyProxied: "true"}},
+	}
+	remote := &Record{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", Labels: map[string]string{"app": "web"}},
+		Spec:       RecordSpec{Name: "web.example.com", Type: RecordTypeA, Value: "10.0.0.1", Extra: map[string]string{"other": "value"}},
+	}
+	record := cluster.MirrorRecord(remote)
+
+	if record.Namespace != "mirror" || record.Name != "cluster-east-default-web" {
+		t.Errorf("unexpected mirror %s/%s", record.Namespace, record.Name)
+	}
+	if record.Labels[LabelCluster] != "cluster-east" || record.Labels["app"] != "web" {
+		t.Errorf("unexpected labels %v", record.Labels)
+	}
+	if record.Annotations[AnnotationRemoteRecord] != "default/web" {
+		t.Errorf("unexpected annotations %v", record.Annotations)
+	}
+	if record.Spec.Extra[ExtraKeyProxied] != "true" || record.Spec.Extra["other"] != "value" {
+		t.Errorf("extra not merged: %v", record.Spec.Extra)
+	}
+	if _, ok := remote.Labels[LabelCluster]; ok {
+		t.Error("labels of the remote Record modified")
+	}
+	if _, ok := remote.Spec.Extra[ExtraKeyProxied]; ok {
+		t.Error("extra of the remote Record modified")
+	}
+}
@@ -0,0 +1,74 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// LabelCluster is set on Records mirrored from a RemoteCluster to the name of the remote cluster
+	LabelCluster = "dns.xzzpig.com/cluster"
+	// AnnotationRemoteRecord is set on Records mirrored from a RemoteCluster to the namespace/name of the remote Record
+	AnnotationRemoteRecord = "dns.xzzpig.com/remote-record"
+)
+
+// SecretKeyReference selects a key of a Secret in the namespace of the referencing object
+type SecretKeyReference struct {
+	Name string `json:"name"`
+	// +kubebuilder:default:=kubeconfig
+	Key string `json:"key,omitempty"`
+}
+
+// RemoteClusterSpec defines the remote cluster whose Records are mirrored into the namespace of the RemoteCluster
+type RemoteClusterSpec struct {
+	// Secret holding the kubeconfig used to access the remote cluster
+	KubeConfigSecretRef SecretKeyReference `json:"kubeConfigSecretRef"`
+	// Name of the cluster set as the dns.xzzpig.com/cluster label of the mirrored Records, defaults to the name of the RemoteCluster
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	ClusterName string `json:"clusterName,omitempty"`
+	// Namespace of the remote cluster to watch, all namespaces are watched if empty
+	Namespace string `json:"namespace,omitempty"`
+	// Selects the remote Records to mirror, all Records are mirrored if empty
+	Selector metav1.LabelSelector `json:"selector,omitempty"`
+	// Merged into the extra of the mirrored Records and passed to the providers as is, e.g. to proxy the records of the cluster
+	Extra map[string]string `json:"extra,omitempty"`
+}
+
+// RemoteClusterStatus defines the observed state of RemoteCluster
+type RemoteClusterStatus struct {
+	Ready  bool   `json:"ready"`
+	Reason string `json:"reason,omitempty"`
+	// Number of Records mirrored from the remote cluster
+	Records int `json:"records"`
+	// Last time the Records were synced from the remote cluster
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.spec.clusterName`
+// +kubebuilder:printcolumn:name="Records",type=integer,JSONPath=`.status.records`
+// +kubebuilder:printcolumn:name="Ready",type=boolean,JSONPath=`.status.ready`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.reason`
+
+// RemoteCluster mirrors the Records of another cluster, so they are applied by the local Providers
+type RemoteCluster struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RemoteClusterSpec   `json:"spec,omitempty"`
+	Status RemoteClusterStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// RemoteClusterList contains a list of RemoteCluster
+type RemoteClusterList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []RemoteCluster `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&RemoteCluster{}, &RemoteClusterList{})
+}
@@ -34,6 +34,8 @@ type ResourceWatcherStatus struct {
 	Reason    string          `json:"reason,omitempty"`
 	Checked   bool            `json:"-"`
 	Resources []WatchResource `json:"resources"`
+	// Hash of the inputs of the last successful render, the template is not rendered again until it changes
+	RenderHash string `json:"renderHash,omitempty"`
 }
 
 type WatchResource struct {
@@ -0,0 +1,83 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TemplateLibrarySpec defines the desired state of TemplateLibrary
+type TemplateLibrarySpec struct {
+	// Named partials, templates include them as "<library name>.<partial name>", e.g. {{ include "lib.hostName" . }}
+	// Partial names must not contain dots
+	// +kubebuilder:validation:XValidation:rule="self.all(name, !name.contains('.'))",message="partial names must not contain dots"
+	Partials map[string]GoTemplateString `json:"partials"`
+}
+
+// TemplateLibraryStatus defines the observed state of TemplateLibrary
+type TemplateLibraryStatus struct {
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// TemplateLibrary is the Schema for the templatelibraries API,
+// its partials can be included by the Templates and Generators of its namespace
+type TemplateLibrary struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TemplateLibrarySpec   `json:"spec,omitempty"`
+	Status TemplateLibraryStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// TemplateLibraryList contains a list of TemplateLibrary
+type TemplateLibraryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TemplateLibrary `json:"items"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster
+
+// ClusterTemplateLibrary is the Schema for the clustertemplatelibraries API,
+// its partials can be included by all templates, a TemplateLibrary of the same name takes precedence in its namespace
+type ClusterTemplateLibrary struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TemplateLibrarySpec   `json:"spec,omitempty"`
+	Status TemplateLibraryStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterTemplateLibraryList contains a list of ClusterTemplateLibrary
+type ClusterTemplateLibraryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterTemplateLibrary `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&TemplateLibrary{}, &TemplateLibraryList{})
+	SchemeBuilder.Register(&ClusterTemplateLibrary{}, &ClusterTemplateLibraryList{})
+}
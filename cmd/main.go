@@ -19,7 +19,9 @@ package main
 import (
 	"crypto/tls"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -27,6 +29,7 @@ import (
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
@@ -37,13 +40,19 @@ import (
 
 	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
 	dnscontroller "github.com/xzzpig/kube-dns-manager/internal/controller/dns"
+	"github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider"
 
 	// +kubebuilder:scaffold:imports
 
 	_ "github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider/adguard"
 	_ "github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider/alidns"
 	_ "github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider/cloudflare"
+	_ "github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider/coredns"
+	_ "github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider/etcd"
+	execprovider "github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider/exec"
 	_ "github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider/job"
+	_ "github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider/pihole"
+	pluginprovider "github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider/plugin"
 )
 
 var (
@@ -59,11 +68,25 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "zone" {
+		if err := runZone(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var enableWebhooks bool
+	var providerReadyz bool
+	var triggerWindows string
+	var renderLimits dnscontroller.RenderLimits
+	var execAllowedCommands string
+	var pluginAllowedAddresses string
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -75,6 +98,27 @@ func main() {
 		"If set, the metrics endpoint is served securely via HTTPS. Use --metrics-secure=false to use HTTP instead.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"If set, the admission webhooks are served, requires serving certificates for the webhook server")
+	flag.BoolVar(&providerReadyz, "provider-readyz", false,
+		"If set, the ready check fails while the last health check of any provider failed")
+	flag.StringVar(&triggerWindows, "trigger-windows", dnscontroller.DefaultTriggerWindows,
+		"Comma separated <kind>=<duration> windows, changes of a watched resource kind in its window "+
+			"are coalesced into one render of the ResourceWatchers")
+	flag.DurationVar(&renderLimits.Timeout, "render-timeout", dnscontroller.DefaultRenderTimeout,
+		"Maximum duration of a render of a ResourceWatcher template, 0 for no limit")
+	flag.IntVar(&renderLimits.MaxOutputBytes, "render-max-output-bytes", dnscontroller.DefaultRenderMaxOutputBytes,
+		"Maximum output size of a render of a ResourceWatcher template, 0 for no limit")
+	flag.IntVar(&renderLimits.MaxLookups, "render-max-lookups", dnscontroller.DefaultRenderMaxLookups,
+		"Maximum number of objects looked up by a render of a ResourceWatcher template, 0 for no limit")
+	flag.IntVar(&renderLimits.MaxSteps, "render-max-steps", dnscontroller.DefaultRenderMaxSteps,
+		"Maximum number of function calls and outputs of a render of a ResourceWatcher template, 0 for no limit")
+	flag.StringVar(&execAllowedCommands, "exec-allowed-commands", "",
+		"Comma separated executables EXEC providers may run, also from namespaced Providers. "+
+			"If empty, only ClusterProviders can use EXEC")
+	flag.StringVar(&pluginAllowedAddresses, "plugin-allowed-addresses", "",
+		"Comma separated addresses PLUGIN providers may connect to, also from namespaced Providers. "+
+			"If empty, only ClusterProviders can use PLUGIN")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -83,6 +127,19 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	if execAllowedCommands != "" {
+		execprovider.AllowedCommands = strings.Split(execAllowedCommands, ",")
+	}
+	if pluginAllowedAddresses != "" {
+		pluginprovider.AllowedAddresses = strings.Split(pluginAllowedAddresses, ",")
+	}
+
+	triggerWindowsByKind, err := dnscontroller.ParseTriggerWindows(triggerWindows)
+	if err != nil {
+		setupLog.Error(err, "invalid --trigger-windows")
+		os.Exit(1)
+	}
+
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancellation and
@@ -166,36 +223,61 @@ func main() {
 		os.Exit(1)
 	}
 	if err = (&dnscontroller.ResourceWatcherReconciler{
-		Client:   mgr.GetClient(),
-		Scheme:   mgr.GetScheme(),
-		Template: dnscontroller.NewTemplate("watcher"),
-		Recorder: mgr.GetEventRecorderFor("resource-watcher-controller"),
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		Template:       dnscontroller.NewTemplate("watcher"),
+		Recorder:       mgr.GetEventRecorderFor("resource-watcher-controller"),
+		TriggerWindows: triggerWindowsByKind,
+		RenderLimits:   renderLimits,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ResourceWatcher")
 		os.Exit(1)
 	}
+	providerRegistry := provider.NewRegistry()
+	if err = mgr.Add(providerRegistry); err != nil {
+		setupLog.Error(err, "unable to add provider registry")
+		os.Exit(1)
+	}
 	if err = (&dnscontroller.RecordReconciler{
-		Client:   mgr.GetClient(),
-		Scheme:   mgr.GetScheme(),
-		Recorder: mgr.GetEventRecorderFor("record-controller"),
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		Recorder:  mgr.GetEventRecorderFor("record-controller"),
+		Registry:  providerRegistry,
+		Clientset: kubernetes.NewForConfigOrDie(mgr.GetConfig()),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Record")
 		os.Exit(1)
 	}
 	if err = (&dnscontroller.ProviderReconciler[*dnsv1.Provider]{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Registry: providerRegistry,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Provider")
 		os.Exit(1)
 	}
 	if err = (&dnscontroller.ProviderReconciler[*dnsv1.ClusterProvider]{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Registry: providerRegistry,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ClusterProvider")
 		os.Exit(1)
 	}
+	if err = (&dnscontroller.RemoteClusterReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("remote-cluster-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "RemoteCluster")
+		os.Exit(1)
+	}
+	if enableWebhooks {
+		if err = (&dnsv1.Record{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Record")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -206,6 +288,12 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if providerReadyz {
+		if err := mgr.AddReadyzCheck("providers", providerRegistry.ReadyzCheck); err != nil {
+			setupLog.Error(err, "unable to set up provider ready check")
+			os.Exit(1)
+		}
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
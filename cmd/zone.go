@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+	"github.com/xzzpig/kube-dns-manager/internal/zonefile"
+)
+
+const zoneUsage = `Usage:
+  manager zone export --provider [namespace/]name [--origin zone] [--output file] [--kubeconfig file]
+  manager zone import --file file --namespace namespace [--origin zone] [--label key=value] [--apply] [--kubeconfig file]
+`
+
+// labelFlags collects repeated --label key=value flags
+type labelFlags map[string]string
+
+func (l labelFlags) String() string {
+	return fmt.Sprint(map[string]string(l))
+}
+
+func (l labelFlags) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("label must be key=value, got %q", value)
+	}
+	l[key] = val
+	return nil
+}
+
+// runZone runs the zone subcommand which converts between Records and RFC 1035 zone files
+func runZone(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing zone subcommand\n%s", zoneUsage)
+	}
+	ctx := ctrl.SetupSignalHandler()
+	switch args[0] {
+	case "export":
+		return zoneExport(ctx, args[1:])
+	case "import":
+		return zoneImport(ctx, args[1:])
+	}
+	return fmt.Errorf("unknown zone subcommand %q\n%s", args[0], zoneUsage)
+}
+
+// newZoneFlagSet returns the flag set of a zone subcommand with the --kubeconfig flag,
+// the flags of the manager are not parsed on this path
+func newZoneFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	kubeconfig := fs.String("kubeconfig", "", "Paths to a kubeconfig, defaults to $KUBECONFIG, ~/.kube/config or the in-cluster config")
+	return fs, kubeconfig
+}
+
+// newZoneClient returns a client of the cluster in kubeconfig, it returns an error instead of exiting if there is none
+func newZoneClient(kubeconfig string) (client.Client, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	return client.New(config, client.Options{Scheme: scheme})
+}
+
+// getProvider returns the Provider namespace/name or the ClusterProvider name
+func getProvider(ctx context.Context, cli client.Client, ref string) (dnsv1.ProviderObject, error) {
+	if namespace, name, ok := strings.Cut(ref, "/"); ok {
+		provider := &dnsv1.Provider{}
+		return provider, cli.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, provider)
+	}
+	provider := &dnsv1.ClusterProvider{}
+	return provider, cli.Get(ctx, client.ObjectKey{Name: ref}, provider)
+}
+
+// exportedRecords returns the specs of the Records the provider is selected for, the same way the Record controller selects them
+func exportedRecords(ctx context.Context, cli client.Client, target dnsv1.ProviderObject) ([]dnsv1.RecordSpec, error) {
+	recordList := &dnsv1.RecordList{}
+	if err := cli.List(ctx, recordList, client.InNamespace(target.GetNamespace())); err != nil {
+		return nil, err
+	}
+	providerList := &dnsv1.ProviderList{}
+	if err := cli.List(ctx, providerList, client.InNamespace(target.GetNamespace())); err != nil {
+		return nil, err
+	}
+	clusterProviderList := &dnsv1.ClusterProviderList{}
+	if err := cli.List(ctx, clusterProviderList); err != nil {
+		return nil, err
+	}
+
+	records := make([]dnsv1.RecordSpec, 0, len(recordList.Items))
+	for i := range recordList.Items {
+		record := &recordList.Items[i]
+		if !exportable(record, target) {
+			continue
+		}
+		providers := make([]dnsv1.ProviderObject, 0, len(providerList.Items)+len(clusterProviderList.Items))
+		for j := range providerList.Items {
+			if providerList.Items[j].Namespace == record.Namespace {
+				providers = append(providers, &providerList.Items[j])
+			}
+		}
+		for j := range clusterProviderList.Items {
+			providers = append(providers, &clusterProviderList.Items[j])
+		}
+		selected, err := dnsv1.SelectProviders(providers, record)
+		if err != nil {
+			return nil, err
+		}
+		for _, provider := range selected {
+			if provider.GetNamespace() == target.GetNamespace() && provider.GetName() == target.GetName() {
+				records = append(records, record.Spec)
+				break
+			}
+		}
+	}
+	return records, nil
+}
+
+// exportable reports whether the Record is served by the provider: Records being deleted, violating a DNSPolicy
+// or losing a conflict are not pushed to the provider, so they are left out of the zone
+func exportable(record *dnsv1.Record, target dnsv1.ProviderObject) bool {
+	if !record.DeletionTimestamp.IsZero() || meta.IsStatusConditionTrue(record.Status.Conditions, dnsv1.RecordConditionPolicyViolation) {
+		return false
+	}
+	if meta.IsStatusConditionTrue(record.Status.Conditions, dnsv1.RecordConditionConflict) {
+		// the conflict may be on another provider only, the Record is served if it holds a record on this one
+		status := record.Status.FindProviderStatus(dnsv1.NamespacedName{Namespace: target.GetNamespace(), Name: target.GetName()})
+		return status != nil && status.RecordID != ""
+	}
+	return true
+}
+
+func zoneExport(ctx context.Context, args []string) error {
+	fs, kubeconfig := newZoneFlagSet("zone export")
+	providerRef := fs.String("provider", "", "The Provider as namespace/name, or the name of a ClusterProvider")
+	origin := fs.String("origin", "", "The origin of the zone, defaults to the domain of the provider selector")
+	ttl := fs.Int("ttl", zonefile.DefaultTTL, "The TTL of records which do not specify one")
+	output := fs.String("output", "", "The file to write the zone to, defaults to stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *providerRef == "" {
+		return fmt.Errorf("--provider is required\n%s", zoneUsage)
+	}
+	cli, err := newZoneClient(*kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	provider, err := getProvider(ctx, cli, *providerRef)
+	if err != nil {
+		return err
+	}
+	if *origin == "" {
+		*origin = provider.GetSpec().Selector.Domain
+	}
+	if *origin == "" {
+		return fmt.Errorf("provider %s has no selector domain, --origin is required", *providerRef)
+	}
+	records, err := exportedRecords(ctx, cli, provider)
+	if err != nil {
+		return err
+	}
+	records = slices.DeleteFunc(records, func(record dnsv1.RecordSpec) bool {
+		if zonefile.InZone(record.Name, *origin) {
+			return false
+		}
+		fmt.Fprintf(os.Stderr, "warning: skipped record %s %s which is not in zone %s\n", record.Name, record.Type, *origin)
+		return true
+	})
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	zone := &zonefile.Zone{Origin: *origin, TTL: *ttl, Serial: zonefile.NextSerial(0, time.Now())}
+	return zonefile.Write(w, zone, records)
+}
+
+var invalidLabelChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// recordObjectName returns a stable DNS-1123 name for the Record object of an imported record,
+// every label of the record name is sanitized on its own and labels left empty are dropped
+func recordObjectName(spec *dnsv1.RecordSpec) string {
+	h := fnv.New32a()
+	h.Write([]byte(spec.Value))
+	suffix := fmt.Sprintf("-%s-%08x", strings.ToLower(string(spec.Type)), h.Sum32())
+
+	labels := make([]string, 0)
+	for _, label := range strings.Split(strings.ToLower(spec.Name), ".") {
+		if label == "*" {
+			label = "wildcard"
+		}
+		label = strings.Trim(invalidLabelChars.ReplaceAllString(label, "-"), "-")
+		if len(label) > 63 {
+			label = strings.TrimRight(label[:63], "-")
+		}
+		if label != "" {
+			labels = append(labels, label)
+		}
+	}
+	name := strings.Join(labels, ".")
+	if maxLength := 253 - len(suffix); len(name) > maxLength {
+		name = strings.TrimRight(name[:maxLength], "-.")
+	}
+	if name == "" {
+		name = "root"
+	}
+	return name + suffix
+}
+
+func zoneImport(ctx context.Context, args []string) error {
+	fs, kubeconfig := newZoneFlagSet("zone import")
+	file := fs.String("file", "", "The zone file to import, - for stdin")
+	namespace := fs.String("namespace", "default", "The namespace to create the Records in")
+	origin := fs.String("origin", "", "The origin of relative names until a $ORIGIN directive is found")
+	labels := labelFlags{}
+	fs.Var(labels, "label", "A label added to every Record as key=value, can be repeated")
+	apply := fs.Bool("apply", false, "Create the Records instead of printing them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("--file is required\n%s", zoneUsage)
+	}
+	var cli client.Client
+	if *apply {
+		var err error
+		if cli, err = newZoneClient(*kubeconfig); err != nil {
+			return err
+		}
+	}
+
+	var r io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	specs, skipped, err := zonefile.Parse(r, *origin)
+	if err != nil {
+		return err
+	}
+	for _, s := range skipped {
+		fmt.Fprintf(os.Stderr, "warning: skipped unsupported record %s\n", s)
+	}
+
+	for i, spec := range specs {
+		record := &dnsv1.Record{Spec: spec}
+		record.APIVersion = dnsv1.GroupVersion.String()
+		record.Kind = "Record"
+		record.Namespace = *namespace
+		record.Name = recordObjectName(&spec)
+		if len(labels) != 0 {
+			record.Labels = labels
+		}
+
+		if !*apply {
+			data, err := yaml.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				fmt.Println("---")
+			}
+			fmt.Print(string(data))
+			continue
+		}
+		if err := cli.Create(ctx, record); apierrors.IsAlreadyExists(err) {
+			fmt.Printf("record %s/%s already exists\n", record.Namespace, record.Name)
+		} else if err != nil {
+			return err
+		} else {
+			fmt.Printf("record %s/%s created\n", record.Namespace, record.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+)
+
+func TestExportable(t *testing.T) {
+	target := &dnsv1.ClusterProvider{ObjectMeta: metav1.ObjectMeta{Name: "zone"}}
+	now := metav1.Now()
+	condition := func(conditionType string) []metav1.Condition {
+		return []metav1.Condition{{Type: conditionType, Status: metav1.ConditionTrue}}
+	}
+	pushed := []*dnsv1.RecordProviderStatus{{NamespacedName: dnsv1.NamespacedName{Name: "zone"}, RecordID: "id"}}
+	pushedElsewhere := []*dnsv1.RecordProviderStatus{{NamespacedName: dnsv1.NamespacedName{Name: "other"}, RecordID: "id"}}
+
+	tests := []struct {
+		name   string
+		record dnsv1.Record
+		wants  bool
+	}{
+		{name: "served", wants: true},
+		{name: "deleting", record: dnsv1.Record{ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now}}},
+		{name: "policy violation", record: dnsv1.Record{Status: dnsv1.RecordStatus{Conditions: condition(dnsv1.RecordConditionPolicyViolation)}}},
+		{name: "conflict", record: dnsv1.Record{Status: dnsv1.RecordStatus{Conditions: condition(dnsv1.RecordConditionConflict), Providers: pushedElsewhere}}},
+		{name: "conflict on another provider", record: dnsv1.Record{Status: dnsv1.RecordStatus{Conditions: condition(dnsv1.RecordConditionConflict), Providers: pushed}}, wants: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exportable(&tt.record, target); got != tt.wants {
+				t.Errorf("exportable = %v, want %v", got, tt.wants)
+			}
+		})
+	}
+}
+
+func TestRecordObjectName(t *testing.T) {
+	long := strings.Repeat("a", 70)
+	tests := []struct {
+		name   string
+		record string
+		prefix string
+	}{
+		{name: "plain", record: "www.example.com", prefix: "www.example.com-"},
+		{name: "underscore labels", record: "_sip._tcp.example.com", prefix: "sip.tcp.example.com-"},
+		{name: "wildcard", record: "*.example.com", prefix: "wildcard.example.com-"},
+		{name: "empty label", record: "_.example.com", prefix: "example.com-"},
+		{name: "long label", record: long + ".example.com", prefix: strings.Repeat("a", 63) + ".example.com-"},
+		{name: "long name", record: strings.Repeat("abcdefghi.", 30) + "com", prefix: "abcdefghi."},
+		{name: "root", record: "", prefix: "root-"},
+		{name: "root with dot", record: ".", prefix: "root-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := recordObjectName(&dnsv1.RecordSpec{Name: tt.record, Type: dnsv1.RecordTypeSRV, Value: "0 5 5060 sip.example.com"})
+			if !strings.HasPrefix(name, tt.prefix) {
+				t.Errorf("expected %s to start with %s", name, tt.prefix)
+			}
+			if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+				t.Errorf("%s is not a valid name: %v", name, errs)
+			}
+			for _, label := range strings.Split(name, ".") {
+				if len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+					t.Errorf("%s has an invalid label %s", name, label)
+				}
+			}
+		})
+	}
+}
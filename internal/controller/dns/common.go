@@ -11,13 +11,27 @@ const (
 	ownerReferencesField = ".metadata.ownerReferences"
 	resourcesField       = ".status.resources"
 	providersField       = ".status.providers"
+	recordNameField      = ".spec.name"
 	finalizerLabel       = "dns.xzzpig.com/finalizer"
+	reverseRecordSuffix  = "-ptr"
 )
 
 var (
 	ErrorWaitRecords = errors.New("waiting for Records")
 	ErrorUnknownKind = errors.New("unknown kind")
 	ErrorNoTemplate  = errors.New("no template specified")
+
+	ErrorRenderTimeout        = errors.New("template render timed out")
+	ErrorRenderOutputTooLarge = errors.New("template output too large")
+	ErrorRenderLookupLimit    = errors.New("too many lookups in template")
+	ErrorRenderStepLimit      = errors.New("too many steps in template")
+	ErrorRenderIncludeDepth   = errors.New("includes nested too deeply")
+	ErrorRenderAborted        = errors.New("template render aborted")
+
+	ErrorPruneNotSupported = errors.New("provider does not support listing records for pruning")
+
+	// ErrorWaitRemoteRecords is returned while the initial list of the Records of a remote cluster is running
+	ErrorWaitRemoteRecords = errors.New("waiting for the Records of the remote cluster")
 )
 
 func addFinalizer[T client.Object](object T) (changed bool) {
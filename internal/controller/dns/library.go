@@ -0,0 +1,237 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+)
+
+// maxIncludeDepth limits the nesting of include calls, e.g. of a partial including itself
+const maxIncludeDepth = 100
+
+// cachedTemplate is a parsed template with the partials of the libraries it includes
+type cachedTemplate struct {
+	tpl        *template.Template
+	generation int64
+	// Names of the libraries looked up for the template and the UIDs and generations they resolved to
+	libraries   []string
+	fingerprint string
+}
+
+// walkNodes calls visit for node and its descendants until visit returns true
+func walkNodes(node parse.Node, visit func(parse.Node) bool) bool {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return false
+	}
+	if visit(node) {
+		return true
+	}
+	var children []parse.Node
+	switch n := node.(type) {
+	case *parse.ListNode:
+		children = n.Nodes
+	case *parse.ActionNode:
+		children = []parse.Node{n.Pipe}
+	case *parse.PipeNode:
+		for _, cmd := range n.Cmds {
+			children = append(children, cmd)
+		}
+	case *parse.CommandNode:
+		children = n.Args
+	case *parse.ChainNode:
+		children = []parse.Node{n.Node}
+	case *parse.IfNode:
+		children = []parse.Node{n.Pipe, n.List, n.ElseList}
+	case *parse.RangeNode:
+		children = []parse.Node{n.Pipe, n.List, n.ElseList}
+	case *parse.WithNode:
+		children = []parse.Node{n.Pipe, n.List, n.ElseList}
+	case *parse.TemplateNode:
+		children = []parse.Node{n.Pipe}
+	}
+	for _, child := range children {
+		if walkNodes(child, visit) {
+			return true
+		}
+	}
+	return false
+}
+
+// includeName returns the name of the template included by cmd, empty if the name is not a constant.
+// ok is false if cmd does not call include
+func includeName(cmd *parse.CommandNode) (name string, ok bool) {
+	if len(cmd.Args) == 0 {
+		return "", false
+	}
+	if ident, isIdent := cmd.Args[0].(*parse.IdentifierNode); !isIdent || ident.Ident != "include" {
+		return "", false
+	}
+	if len(cmd.Args) > 1 {
+		if str, isString := cmd.Args[1].(*parse.StringNode); isString {
+			return str.Text, true
+		}
+	}
+	return "", true
+}
+
+// missingLibraries returns the libraries of the templates included by set but not defined in it,
+// a partial is included as "<library>.<partial>"
+func missingLibraries(set *template.Template, loaded map[string]bool) []string {
+	var libraries []string
+	add := func(name string) {
+		if name == "" || set.Lookup(name) != nil {
+			return
+		}
+		if i := strings.LastIndex(name, "."); i > 0 && !loaded[name[:i]] && !slices.Contains(libraries, name[:i]) {
+			libraries = append(libraries, name[:i])
+		}
+	}
+	for _, t := range set.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		walkNodes(t.Tree.Root, func(node parse.Node) bool {
+			switch n := node.(type) {
+			case *parse.TemplateNode:
+				add(n.Name)
+			case *parse.CommandNode:
+				if name, ok := includeName(n); ok {
+					add(name)
+				}
+			}
+			return false
+		})
+	}
+	slices.Sort(libraries)
+	return libraries
+}
+
+// getLibrary returns the partials of the library visible to the templates of the namespace,
+// a TemplateLibrary of the namespace takes precedence over a ClusterTemplateLibrary.
+// The library is tracked by the watcher even if it does not exist, so it is rendered again once it is created
+func (r *ResourceWatcherReconciler) getLibrary(ctx context.Context, data *TemplateData, namespace, name string) (spec *dnsv1.TemplateLibrarySpec, fingerprint string, err error) {
+	if namespace != "" {
+		library := &dnsv1.TemplateLibrary{}
+		err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, library)
+		if err == nil {
+			data.track(dnsv1.WatchResourceKindTemplateLibrary, library)
+			return &library.Spec, fmt.Sprintf("%s/%s/%d", dnsv1.WatchResourceKindTemplateLibrary, library.UID, library.Generation), nil
+		}
+		if !apierrors.IsNotFound(err) {
+			return nil, "", err
+		}
+		data.trackMissing(dnsv1.WatchResourceKindTemplateLibrary, namespace, name)
+	}
+	library := &dnsv1.ClusterTemplateLibrary{}
+	err = r.Get(ctx, client.ObjectKey{Name: name}, library)
+	if err == nil {
+		data.track(dnsv1.WatchResourceKindClusterTemplateLibrary, library)
+		return &library.Spec, fmt.Sprintf("%s/%s/%d", dnsv1.WatchResourceKindClusterTemplateLibrary, library.UID, library.Generation), nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, "", err
+	}
+	data.trackMissing(dnsv1.WatchResourceKindClusterTemplateLibrary, "", name)
+	return nil, "missing", nil
+}
+
+// resolveLibraries looks up the libraries and returns the fingerprint of the objects they resolve to
+func (r *ResourceWatcherReconciler) resolveLibraries(ctx context.Context, data *TemplateData, namespace string, libraries []string) (string, error) {
+	fingerprints := make(map[string]string, len(libraries))
+	for _, name := range libraries {
+		_, fingerprint, err := r.getLibrary(ctx, data, namespace, name)
+		if err != nil {
+			return "", err
+		}
+		fingerprints[name] = fingerprint
+	}
+	return joinFingerprints(libraries, fingerprints), nil
+}
+
+func joinFingerprints(libraries []string, fingerprints map[string]string) string {
+	items := make([]string, len(libraries))
+	for i, name := range libraries {
+		items[i] = name + "=" + fingerprints[name]
+	}
+	return strings.Join(items, ",")
+}
+
+// buildTemplate parses the template into a copy of r.Template together with the partials of the libraries it includes
+func (r *ResourceWatcherReconciler) buildTemplate(ctx context.Context, data *TemplateData, key, namespace string, generation int64, tplString dnsv1.GoTemplateString) (*cachedTemplate, error) {
+	set, err := r.Template.Clone()
+	if err != nil {
+		return nil, err
+	}
+	tpl, err := set.New(key).Parse(string(tplString))
+	if err != nil {
+		return nil, err
+	}
+
+	cached := &cachedTemplate{tpl: tpl, generation: generation}
+	loaded := make(map[string]bool)
+	fingerprints := make(map[string]string)
+	for missing := missingLibraries(set, loaded); len(missing) > 0; missing = missingLibraries(set, loaded) {
+		for _, name := range missing {
+			loaded[name] = true
+			cached.libraries = append(cached.libraries, name)
+			spec, fingerprint, err := r.getLibrary(ctx, data, namespace, name)
+			if err != nil {
+				return nil, err
+			}
+			fingerprints[name] = fingerprint
+			// a missing library fails the render when its partials are included
+			if spec == nil {
+				continue
+			}
+			for partial, partialString := range spec.Partials {
+				// libraries created before the validation of the names
+				if strings.Contains(partial, ".") {
+					return nil, fmt.Errorf("library %s: partial name %q contains a dot", name, partial)
+				}
+				if _, err := set.New(name + "." + partial).Parse(string(partialString)); err != nil {
+					return nil, fmt.Errorf("library %s: %w", name, err)
+				}
+			}
+		}
+	}
+	slices.Sort(cached.libraries)
+	cached.fingerprint = joinFingerprints(cached.libraries, fingerprints)
+	return cached, nil
+}
+
+// include executes a template of set for the include function of a render, nested includes are limited
+func (d *TemplateData) include(set *template.Template) func(name string, data any) (string, error) {
+	return func(name string, data any) (string, error) {
+		if err := d.render.enterInclude(); err != nil {
+			return "", err
+		}
+		defer d.render.leaveInclude()
+		buffer := &limitedBuilder{max: d.render.limits.MaxOutputBytes}
+		if err := set.ExecuteTemplate(buffer, name, data); err != nil {
+			return "", err
+		}
+		return buffer.String(), nil
+	}
+}
+
+// limitedBuilder collects the output of an include within the output limit of the render
+type limitedBuilder struct {
+	strings.Builder
+	max int
+}
+
+func (b *limitedBuilder) Write(p []byte) (int, error) {
+	if b.max > 0 && b.Len()+len(p) > b.max {
+		return 0, fmt.Errorf("%w: more than %d bytes", ErrorRenderOutputTooLarge, b.max)
+	}
+	return b.Builder.Write(p)
+}
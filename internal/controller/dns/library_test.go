@@ -0,0 +1,145 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+)
+
+func newLibraryReconciler(t *testing.T, objects ...client.Object) *ResourceWatcherReconciler {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := dnsv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	cli := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+	return &ResourceWatcherReconciler{Client: cli, Scheme: scheme, Template: NewTemplate("watcher"), templates: make(map[string]*cachedTemplate)}
+}
+
+func library(namespace, name string, partials map[string]dnsv1.GoTemplateString) client.Object {
+	if namespace == "" {
+		return &dnsv1.ClusterTemplateLibrary{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: dnsv1.TemplateLibrarySpec{Partials: partials}}
+	}
+	return &dnsv1.TemplateLibrary{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}, Spec: dnsv1.TemplateLibrarySpec{Partials: partials}}
+}
+
+func TestMissingLibraries(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		loaded   map[string]bool
+		wants    []string
+	}{
+		{name: "no include", template: `{{ .Name }}`},
+		{name: "include", template: `{{ include "net.host" . }}{{ template "dns.ttl" . }}`, wants: []string{"dns", "net"}},
+		{name: "library name with dots", template: `{{ include "example.com.host" . }}`, wants: []string{"example.com"}},
+		{name: "defined template", template: `{{ define "local.name" }}{{ end }}{{ include "local.name" . }}`},
+		{name: "loaded", template: `{{ include "net.host" . }}{{ include "dns.ttl" . }}`, loaded: map[string]bool{"net": true}, wants: []string{"dns"}},
+		{name: "no library", template: `{{ include "host" . }}`},
+		{name: "computed name", template: `{{ include (printf "net.%s" .Name) . }}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := NewTemplate("test")
+			if _, err := set.Parse(tt.template); err != nil {
+				t.Fatal(err)
+			}
+			if got := missingLibraries(set, tt.loaded); !slices.Equal(got, tt.wants) {
+				t.Errorf("missingLibraries = %v, want %v", got, tt.wants)
+			}
+		})
+	}
+}
+
+func TestLibraries(t *testing.T) {
+	objects := []client.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		library("", "net", map[string]dnsv1.GoTemplateString{"host": `cluster-{{ .Name }}`}),
+		library("", "fqdn", map[string]dnsv1.GoTemplateString{"name": `{{ include "net.host" . }}.{{ include "zone.name" . }}`}),
+		library("", "zone", map[string]dnsv1.GoTemplateString{"name": `example.com`}),
+		library("", "example.com", map[string]dnsv1.GoTemplateString{"host": `dotted-{{ .Name }}`}),
+		library("", "loop", map[string]dnsv1.GoTemplateString{"self": `{{ include "loop.self" . }}`}),
+		library("", "legacy", map[string]dnsv1.GoTemplateString{"a.b": `legacy`}),
+		library("team", "net", map[string]dnsv1.GoTemplateString{"host": `team-{{ .Name }}`}),
+	}
+	tests := []struct {
+		name      string
+		namespace string
+		template  string
+		wants     string
+		libraries []string
+		wantErr   bool
+		// the error must wrap it
+		wantErrIs error
+		// the template fails to build
+		wantBuildErr bool
+	}{
+		{name: "cluster library", namespace: "default", template: `{{ include "net.host" . }}`, wants: "cluster-web", libraries: []string{"net"}},
+		{name: "shadowed by the namespace", namespace: "team", template: `{{ include "net.host" . }}`, wants: "team-web", libraries: []string{"net"}},
+		{name: "cluster template", template: `{{ include "net.host" . }}`, wants: "cluster-web", libraries: []string{"net"}},
+		{name: "nested libraries", namespace: "default", template: `{{ include "fqdn.name" . }}`, wants: "cluster-web.example.com", libraries: []string{"fqdn", "net", "zone"}},
+		{name: "library name with dots", namespace: "default", template: `{{ include "example.com.host" . }}`, wants: "dotted-web", libraries: []string{"example.com"}},
+		{name: "template action", namespace: "default", template: `{{ template "zone.name" . }}`, wants: "example.com", libraries: []string{"zone"}},
+		{name: "missing library", namespace: "default", template: `{{ include "missing.host" . }}`, libraries: []string{"missing"}, wantErr: true},
+		{name: "include nested too deeply", namespace: "default", template: `{{ include "loop.self" . }}`, libraries: []string{"loop"}, wantErr: true, wantErrIs: ErrorRenderIncludeDepth},
+		{name: "partial name with a dot", namespace: "default", template: `{{ include "legacy.other" . }}`, wantBuildErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newLibraryReconciler(t, objects...)
+			watcher := &dnsv1.ResourceWatcher{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "watcher"}}
+			data := NewTemplateData(context.Background(), watcher, r.Client, RenderLimits{})
+			cached, err := r.buildTemplate(context.Background(), &data, "test", tt.namespace, 1, dnsv1.GoTemplateString(tt.template))
+			if tt.wantBuildErr {
+				if err == nil {
+					t.Fatal("expected the template to fail to build")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(cached.libraries, tt.libraries) {
+				t.Errorf("libraries = %v, want %v", cached.libraries, tt.libraries)
+			}
+			for _, name := range tt.libraries {
+				tracked := slices.ContainsFunc(watcher.Status.Resources, func(resource dnsv1.WatchResource) bool {
+					return resource.Name == name && (resource.Kind == dnsv1.WatchResourceKindClusterTemplateLibrary ||
+						resource.Kind == dnsv1.WatchResourceKindTemplateLibrary && resource.Namespace == tt.namespace)
+				})
+				if !tracked {
+					t.Errorf("library %s not tracked: %v", name, watcher.Status.Resources)
+				}
+			}
+
+			output, err := data.execute(cached.tpl, map[string]string{"Name": "web"})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", output)
+				}
+				if tt.wantErrIs != nil && !errors.Is(err, tt.wantErrIs) {
+					t.Fatalf("expected %v, got %v", tt.wantErrIs, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output != tt.wants {
+				t.Errorf("output = %q, want %q", output, tt.wants)
+			}
+		})
+	}
+}
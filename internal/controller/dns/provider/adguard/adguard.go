@@ -3,22 +3,36 @@ package adguard
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"slices"
+	"strings"
+	"time"
 
 	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
 	"github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider"
 )
 
 var (
-	ErrRequestFailed = errors.New("request failed")
+	ErrRequestFailed   = errors.New("request failed")
+	ErrInvalidAnswer   = errors.New("invalid answer")
+	errUpdateNotExists = errors.New("rewrite update endpoint not supported")
 )
 
+const DefaultTimeout = 30 * time.Second
+
 type AdguardProvider struct {
-	url url.URL
+	url      url.URL
+	username string
+	password string
+	client   *http.Client
 }
 
 type AdguardRecord struct {
@@ -26,114 +40,223 @@ type AdguardRecord struct {
 	Answer string `json:"answer"`
 }
 
-func (p *AdguardProvider) List(ctx context.Context) (records []AdguardRecord, err error) {
-	url, err := p.url.Parse("control/rewrite/list")
-	if err != nil {
-		return nil, err
+// adguardID is stored as the id of a Record, it holds the rewrites created for the Record
+type adguardID struct {
+	Domain  string           `json:"domain"`
+	Type    dnsv1.RecordType `json:"type,omitempty"`
+	Answers []string         `json:"answers,omitempty"`
+	// Answer is the single answer stored by older versions
+	Answer string `json:"answer,omitempty"`
+}
+
+func (id *adguardID) rewrites() []AdguardRecord {
+	answers := id.Answers
+	if len(answers) == 0 && id.Answer != "" {
+		answers = []string{id.Answer}
 	}
-	resp, err := http.Get(url.String())
-	if err != nil {
-		return nil, err
+	rewrites := make([]AdguardRecord, 0, len(answers))
+	for _, answer := range answers {
+		rewrites = append(rewrites, AdguardRecord{Domain: id.Domain, Answer: answer})
 	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	return rewrites
+}
+
+// newID builds the id of the record, checking the answers against the record type
+func newID(record *dnsv1.RecordSpec) (*adguardID, error) {
+	answers := strings.FieldsFunc(record.Value, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' })
+	if len(answers) == 0 {
+		return nil, fmt.Errorf("%w: empty value", ErrInvalidAnswer)
 	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.Join(ErrRequestFailed, errors.New(string(body)))
+	if record.Type != dnsv1.RecordTypeA && record.Type != dnsv1.RecordTypeAAAA && record.Type != dnsv1.RecordTypeCNAME {
+		return nil, fmt.Errorf("%w: record type %s is not supported", ErrInvalidAnswer, record.Type)
 	}
-	err = json.Unmarshal(body, &records)
-	if err != nil {
+	slices.Sort(answers)
+	answers = slices.Compact(answers)
+	for _, answer := range answers {
+		ip := net.ParseIP(answer)
+		if record.Type == dnsv1.RecordTypeA && (ip == nil || ip.To4() == nil) ||
+			record.Type == dnsv1.RecordTypeAAAA && (ip == nil || ip.To4() != nil) ||
+			record.Type == dnsv1.RecordTypeCNAME && ip != nil {
+			return nil, fmt.Errorf("%w: %s is not valid for %s record", ErrInvalidAnswer, answer, record.Type)
+		}
+	}
+	return &adguardID{Domain: record.Name, Type: record.Type, Answers: answers}, nil
+}
+
+func parseID(id string) (*adguardID, error) {
+	result := &adguardID{}
+	if err := json.Unmarshal([]byte(id), result); err != nil {
 		return nil, err
 	}
-	return records, nil
+	return result, nil
 }
 
-func (p *AdguardProvider) create(record *AdguardRecord) (err error) {
-	url, err := p.url.Parse("control/rewrite/add")
+func (id *adguardID) String() string {
+	data, _ := json.Marshal(id)
+	return string(data)
+}
+
+// do sends a request to AdGuard Home and decodes the JSON response into out if it is not nil
+func (p *AdguardProvider) do(ctx context.Context, method string, path string, in any, out any) error {
+	u, err := p.url.Parse(path)
 	if err != nil {
 		return err
 	}
-	data, err := json.Marshal(record)
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
 	if err != nil {
 		return err
 	}
-	resp, err := http.Post(url.String(), "application/json", bytes.NewReader(data))
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if p.username != "" {
+		req.SetBasicAuth(p.username, p.password)
+	}
+	resp, err := p.client.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	data, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return err
 	}
-	if resp.StatusCode != http.StatusOK {
-		return errors.Join(ErrRequestFailed, errors.New(string(body)))
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return errors.Join(provider.ErrUnauthenticated, errors.New(string(data)))
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		if path == "control/rewrite/update" {
+			return errUpdateNotExists
+		}
+		fallthrough
+	default:
+		return errors.Join(ErrRequestFailed, errors.New(string(data)))
 	}
-	return nil
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
 }
 
-func (p *AdguardProvider) Create(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
-	record := AdguardRecord{Domain: payload.Record.Name, Answer: payload.Record.Value}
-	id, err := json.Marshal(record)
-	if err != nil {
+// List returns all the rewrites of AdGuard Home
+func (p *AdguardProvider) List(ctx context.Context) (records []AdguardRecord, err error) {
+	err = p.do(ctx, http.MethodGet, "control/rewrite/list", nil, &records)
+	return records, err
+}
+
+func (p *AdguardProvider) create(ctx context.Context, record *AdguardRecord) error {
+	return p.do(ctx, http.MethodPost, "control/rewrite/add", record, nil)
+}
+
+func (p *AdguardProvider) delete(ctx context.Context, record *AdguardRecord) error {
+	return p.do(ctx, http.MethodPost, "control/rewrite/delete", record, nil)
+}
+
+// update replaces the rewrite target with update, falling back to delete and add
+// if AdGuard Home does not have the update endpoint
+func (p *AdguardProvider) update(ctx context.Context, target *AdguardRecord, update *AdguardRecord) error {
+	err := p.do(ctx, http.MethodPut, "control/rewrite/update", map[string]*AdguardRecord{"target": target, "update": update}, nil)
+	if !errors.Is(err, errUpdateNotExists) {
 		return err
 	}
-	err = p.create(&record)
-	if err != nil {
+	if err := p.delete(ctx, target); err != nil {
 		return err
 	}
-	payload.Id = string(id)
-	return nil
+	return p.create(ctx, update)
 }
 
-func (p *AdguardProvider) Update(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
-	if payload.Id != "" {
-		oldRecord := AdguardRecord{}
-		err = json.Unmarshal([]byte(payload.Id), &oldRecord)
-		if err != nil {
+// sync makes the rewrites of the record on AdGuard Home match desired,
+// rewrites of the same domain which are not owned by the record are left untouched.
+// A desired rewrite which already exists is adopted instead of added again, as Pi-hole entries are,
+// so a retry after the id of a created rewrite was lost does not fail
+func (p *AdguardProvider) sync(ctx context.Context, owned []AdguardRecord, desired []AdguardRecord) error {
+	existing, err := p.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	var toDelete, toCreate []AdguardRecord
+	for _, record := range owned {
+		if !slices.Contains(desired, record) && slices.Contains(existing, record) {
+			toDelete = append(toDelete, record)
+		}
+	}
+	for _, record := range desired {
+		if !slices.Contains(existing, record) {
+			toCreate = append(toCreate, record)
+		}
+	}
+
+	for len(toDelete) > 0 && len(toCreate) > 0 {
+		if err := p.update(ctx, &toDelete[0], &toCreate[0]); err != nil {
 			return err
 		}
-		if oldRecord.Domain == payload.Record.Name && oldRecord.Answer == payload.Record.Value {
-			return nil
+		toDelete, toCreate = toDelete[1:], toCreate[1:]
+	}
+	for i := range toDelete {
+		if err := p.delete(ctx, &toDelete[i]); err != nil {
+			return err
 		}
-		if err = p.delete(&oldRecord); err != nil {
+	}
+	for i := range toCreate {
+		if err := p.create(ctx, &toCreate[i]); err != nil {
 			return err
 		}
 	}
-	err = p.Create(ctx, payload)
-	return err
+	return nil
 }
 
-func (p *AdguardProvider) delete(record *AdguardRecord) (err error) {
-	url, err := p.url.Parse("control/rewrite/delete")
+func (p *AdguardProvider) Create(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
+	id, err := newID(payload.Record)
 	if err != nil {
 		return err
 	}
-	data, err := json.Marshal(record)
-	if err != nil {
+	if err := p.sync(ctx, nil, id.rewrites()); err != nil {
 		return err
 	}
-	resp, err := http.Post(url.String(), "application/json", bytes.NewReader(data))
+	payload.Id = id.String()
+	return nil
+}
+
+func (p *AdguardProvider) Update(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
+	id, err := newID(payload.Record)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err
+	var owned []AdguardRecord
+	if payload.Id != "" {
+		oldID, err := parseID(payload.Id)
+		if err != nil {
+			return err
+		}
+		owned = oldID.rewrites()
 	}
-	if resp.StatusCode != http.StatusOK {
-		return errors.Join(ErrRequestFailed, errors.New(string(body)))
+	if err := p.sync(ctx, owned, id.rewrites()); err != nil {
+		return err
 	}
+	payload.Id = id.String()
 	return nil
 }
 
 func (p *AdguardProvider) Delete(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
-	record := AdguardRecord{Domain: payload.Record.Name, Answer: payload.Record.Value}
-	err = p.delete(&record)
-	if err != nil {
+	owned := []AdguardRecord{{Domain: payload.Record.Name, Answer: payload.Record.Value}}
+	if payload.Id != "" {
+		id, err := parseID(payload.Id)
+		if err != nil {
+			return err
+		}
+		owned = id.rewrites()
+	}
+	if err := p.sync(ctx, owned, nil); err != nil {
 		return err
 	}
 	payload.Id = ""
@@ -141,18 +264,55 @@ func (p *AdguardProvider) Delete(ctx context.Context, payload *provider.DnsProvi
 	return nil
 }
 
+func (p *AdguardProvider) HealthCheck(ctx context.Context) error {
+	return p.do(ctx, http.MethodGet, "control/status", nil, nil)
+}
+
+// newHTTPClient builds the client used to access AdGuard Home from the provider config
+func newHTTPClient(config *dnsv1.AdguardProviderConfig) (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	if config.CABundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(config.CABundle)) {
+			return nil, fmt.Errorf("adguard provider: no valid certificate found in caBundle")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	timeout := config.Timeout.Duration
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
 func init() {
 	provider.Register(dnsv1.ProviderTypeAdguard, func(ctx context.Context, provider dnsv1.ProviderObject) (provider.DNSProvider, error) {
 		spec := provider.GetSpec()
+		if spec.Adguard == nil {
+			return nil, fmt.Errorf("adguard provider requires adguard config")
+		}
 		p := new(AdguardProvider)
 		u, err := url.Parse(spec.Adguard.URL)
 		if err != nil {
 			return nil, err
 		}
-		if provider.GetSpec().Adguard.Username != "" {
-			u.User = url.UserPassword(provider.GetSpec().Adguard.Username, provider.GetSpec().Adguard.Password)
+		if !strings.HasSuffix(u.Path, "/") {
+			u.Path += "/"
 		}
 		p.url = *u
+		p.username = spec.Adguard.Username
+		p.password = spec.Adguard.Password
+		if p.client, err = newHTTPClient(spec.Adguard); err != nil {
+			return nil, err
+		}
 		return p, nil
+	}, dnsv1.ProviderCapabilities{
+		RecordTypes: []dnsv1.RecordType{dnsv1.RecordTypeA, dnsv1.RecordTypeAAAA, dnsv1.RecordTypeCNAME},
 	})
 }
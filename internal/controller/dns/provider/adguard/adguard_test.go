@@ -0,0 +1,179 @@
+package adguard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+	"github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider"
+)
+
+// fakeAdguard emulates the rewrite endpoints of AdGuard Home
+type fakeAdguard struct {
+	mu       sync.Mutex
+	rewrites []AdguardRecord
+	noUpdate bool
+	updates  int
+}
+
+func (f *fakeAdguard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if user, password, _ := r.BasicAuth(); user != "admin" || password != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/control/status":
+	case "/control/rewrite/list":
+		_ = json.NewEncoder(w).Encode(f.rewrites)
+	case "/control/rewrite/add":
+		record := AdguardRecord{}
+		_ = json.NewDecoder(r.Body).Decode(&record)
+		f.rewrites = append(f.rewrites, record)
+	case "/control/rewrite/delete":
+		record := AdguardRecord{}
+		_ = json.NewDecoder(r.Body).Decode(&record)
+		f.rewrites = slices.DeleteFunc(f.rewrites, func(r AdguardRecord) bool { return r == record })
+	case "/control/rewrite/update":
+		if f.noUpdate {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body := map[string]AdguardRecord{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		index := slices.Index(f.rewrites, body["target"])
+		if index < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.rewrites[index] = body["update"]
+		f.updates++
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestProvider(t *testing.T, password string) (*fakeAdguard, provider.DNSProvider) {
+	fake := &fakeAdguard{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	p, err := provider.New(context.Background(), &dnsv1.Provider{Spec: dnsv1.ProviderSpec{
+		Type:    dnsv1.ProviderTypeAdguard,
+		Adguard: &dnsv1.AdguardProviderConfig{URL: server.URL, Username: "admin", Password: password},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, p
+}
+
+func TestMultipleValuesAndTypes(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestProvider(t, "secret")
+
+	a := &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "home.example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.1,10.0.0.2"}}
+	aaaa := &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "home.example.com", Type: dnsv1.RecordTypeAAAA, Value: "fd00::1"}}
+	for _, payload := range []*provider.DnsProviderPayload{a, aaaa} {
+		if err := p.Create(ctx, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(fake.rewrites) != 3 || a.Id == aaaa.Id {
+		t.Fatalf("unexpected rewrites %v, ids %s %s", fake.rewrites, a.Id, aaaa.Id)
+	}
+
+	a.Record = &dnsv1.RecordSpec{Name: "home.example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.1,10.0.0.3"}
+	if err := p.Update(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if fake.updates != 1 || !slices.Contains(fake.rewrites, AdguardRecord{Domain: "home.example.com", Answer: "10.0.0.3"}) || len(fake.rewrites) != 3 {
+		t.Fatalf("unexpected rewrites after update %v", fake.rewrites)
+	}
+
+	if err := p.Delete(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(fake.rewrites, []AdguardRecord{{Domain: "home.example.com", Answer: "fd00::1"}}) {
+		t.Fatalf("AAAA rewrite should be kept after deleting the A record: %v", fake.rewrites)
+	}
+}
+
+func TestUpdateFallback(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestProvider(t, "secret")
+	fake.noUpdate = true
+
+	// ids written by older versions only hold a single answer
+	payload := &provider.DnsProviderPayload{
+		Id:     `{"domain":"www.example.com","answer":"home.example.com"}`,
+		Record: &dnsv1.RecordSpec{Name: "www.example.com", Type: dnsv1.RecordTypeCNAME, Value: "lab.example.com"},
+	}
+	fake.rewrites = []AdguardRecord{{Domain: "www.example.com", Answer: "home.example.com"}}
+	if err := p.Update(ctx, payload); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(fake.rewrites, []AdguardRecord{{Domain: "www.example.com", Answer: "lab.example.com"}}) {
+		t.Fatalf("unexpected rewrites %v", fake.rewrites)
+	}
+}
+
+func TestAdoptIdentical(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestProvider(t, "secret")
+
+	payload := &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "home.example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.1"}}
+	if err := p.Create(ctx, payload); err != nil {
+		t.Fatal(err)
+	}
+	// the add succeeded but the id was lost with the status update, the retry adopts the rewrite
+	retry := &provider.DnsProviderPayload{Record: payload.Record}
+	if err := p.Create(ctx, retry); err != nil {
+		t.Fatal(err)
+	}
+	if retry.Id != payload.Id {
+		t.Fatalf("expected the rewrite to be adopted with id %s, got %s", payload.Id, retry.Id)
+	}
+	rewrites, err := p.(*AdguardProvider).List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(rewrites, fake.rewrites) || len(rewrites) != 1 {
+		t.Fatalf("unexpected rewrites after retry %v", rewrites)
+	}
+}
+
+func TestInvalidAnswer(t *testing.T) {
+	_, p := newTestProvider(t, "secret")
+	err := p.Create(context.Background(), &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "home.example.com", Type: dnsv1.RecordTypeAAAA, Value: "10.0.0.1"}})
+	if !errors.Is(err, ErrInvalidAnswer) {
+		t.Fatalf("expected ErrInvalidAnswer, got %v", err)
+	}
+}
+
+func TestHealthCheckUnauthenticated(t *testing.T) {
+	_, p := newTestProvider(t, "wrong")
+	err := p.(provider.DNSProviderHealthChecker).HealthCheck(context.Background())
+	if !errors.Is(err, provider.ErrUnauthenticated) {
+		t.Fatalf("expected ErrUnauthenticated, got %v", err)
+	}
+}
+
+func TestCanceledContext(t *testing.T) {
+	_, p := newTestProvider(t, "secret")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := p.(provider.DNSProviderHealthChecker).HealthCheck(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
@@ -19,6 +19,7 @@ const (
 type AliyunDNSProvider struct {
 	domainName string
 	client     *alidns.Client
+	marker     string
 }
 
 func (p *AliyunDNSProvider) getRR(domain string) *string {
@@ -82,6 +83,14 @@ func (p *AliyunDNSProvider) Create(ctx context.Context, payload *provider.DnsPro
 		return err
 	}
 	payload.Id = *result.Body.RecordId
+	if p.marker != "" {
+		if _, err := p.client.UpdateDomainRecordRemark(&alidns.UpdateDomainRecordRemarkRequest{
+			RecordId: result.Body.RecordId,
+			Remark:   &p.marker,
+		}); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -120,6 +129,67 @@ func (p *AliyunDNSProvider) Delete(ctx context.Context, payload *provider.DnsPro
 	return nil
 }
 
+func (p *AliyunDNSProvider) List(ctx context.Context) ([]provider.DnsProviderRecord, error) {
+	if p.marker == "" {
+		return nil, nil
+	}
+	records := make([]provider.DnsProviderRecord, 0)
+	pageSize := int64(500)
+	for pageNumber := int64(1); ; pageNumber++ {
+		result, err := p.client.DescribeDomainRecords(&alidns.DescribeDomainRecordsRequest{
+			DomainName: &p.domainName,
+			PageNumber: &pageNumber,
+			PageSize:   &pageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range result.Body.DomainRecords.Record {
+			if record.Remark == nil || *record.Remark != p.marker {
+				continue
+			}
+			name := p.domainName
+			if rr := tea.StringValue(record.RR); rr != "" && rr != "@" {
+				name = rr + "." + p.domainName
+			}
+			records = append(records, provider.DnsProviderRecord{
+				Id: tea.StringValue(record.RecordId),
+				Record: dnsv1.RecordSpec{
+					Name:  name,
+					Type:  dnsv1.RecordType(tea.StringValue(record.Type)),
+					Value: tea.StringValue(record.Value),
+					TTL:   int(tea.Int64Value(record.TTL)),
+				},
+			})
+		}
+		if pageNumber*pageSize >= tea.Int64Value(result.Body.TotalCount) {
+			break
+		}
+	}
+	return records, nil
+}
+
+func (p *AliyunDNSProvider) HealthCheck(ctx context.Context) error {
+	_, err := p.client.DescribeDomainInfo(&alidns.DescribeDomainInfoRequest{DomainName: &p.domainName})
+	return wrapHealthError(err)
+}
+
+// wrapHealthError wraps errors of rejected credentials or missing domains with the matching provider error
+func wrapHealthError(err error) error {
+	sdkError, ok := err.(*tea.SDKError)
+	if !ok {
+		return err
+	}
+	code := tea.StringValue(sdkError.Code)
+	switch {
+	case strings.HasPrefix(code, "InvalidAccessKeyId"), strings.HasPrefix(code, "Forbidden"), code == "SignatureDoesNotMatch":
+		return fmt.Errorf("%w: %w", provider.ErrUnauthenticated, err)
+	case strings.HasPrefix(code, "InvalidDomainName"):
+		return fmt.Errorf("%w: %w", provider.ErrZoneNotFound, err)
+	}
+	return err
+}
+
 func IsReccordNotFoundError(err error) bool {
 	if err == nil {
 		return false
@@ -167,11 +237,16 @@ func init() {
 			p.client = client
 		}
 
-		// Check if domain exists
-		if _, err := p.client.DescribeDomainInfo(&alidns.DescribeDomainInfoRequest{DomainName: &p.domainName}); err != nil {
-			return nil, err
-		}
+		p.marker = spec.Prune.Marker(provider.GetUID())
 
+		// the domain is checked by the health check of the Provider controller
 		return p, nil
+	}, dnsv1.ProviderCapabilities{
+		RecordTypes: []dnsv1.RecordType{
+			dnsv1.RecordTypeA, dnsv1.RecordTypeAAAA, dnsv1.RecordTypeCNAME, dnsv1.RecordTypeTXT,
+			dnsv1.RecordTypeMX, dnsv1.RecordTypeSRV, dnsv1.RecordTypeNS, dnsv1.RecordTypeCAA,
+		},
+		MinTTL: 1,
+		MaxTTL: 86400,
 	})
 }
@@ -2,7 +2,9 @@ package cloudflare
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/cloudflare/cloudflare-go"
 	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
@@ -10,7 +12,7 @@ import (
 )
 
 const (
-	ExtraKeyProxied = "dns.xzzpig.com/cloudflare/proxied"
+	ExtraKeyProxied = dnsv1.ExtraKeyProxied
 	ExtraKeyComment = "dns.xzzpig.com/cloudflare/comment"
 	ExtraKeyTags    = "dns.xzzpig.com/cloudflare/tags"
 )
@@ -19,6 +21,18 @@ type CloudflareProvider struct {
 	api               *cloudflare.API
 	zoneID            string
 	matchExistsRecord bool
+	marker            string
+}
+
+func (p *CloudflareProvider) comment(record *dnsv1.RecordSpec) string {
+	comment := record.Extra[ExtraKeyComment]
+	if p.marker == "" {
+		return comment
+	}
+	if comment == "" {
+		return p.marker
+	}
+	return comment + " " + p.marker
 }
 
 func (p *CloudflareProvider) find(ctx context.Context, record *dnsv1.RecordSpec) (id string, err error) {
@@ -45,7 +59,7 @@ func (p *CloudflareProvider) Create(ctx context.Context, payload *provider.DnsPr
 		Content: record.Value,
 		TTL:     record.TTL,
 		Proxied: record.ExtraBool(ExtraKeyProxied),
-		Comment: record.Extra[ExtraKeyComment],
+		Comment: p.comment(record),
 		Tags:    record.ExtraStrings(ExtraKeyTags),
 	})
 	if p.matchExistsRecord && IsRecordDuplicateError(err) {
@@ -62,6 +76,11 @@ func (p *CloudflareProvider) Create(ctx context.Context, payload *provider.DnsPr
 func (p *CloudflareProvider) Update(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
 	record := payload.Record
 
+	comment := record.ExtraString(ExtraKeyComment)
+	if p.marker != "" {
+		c := p.comment(record)
+		comment = &c
+	}
 	r, err := p.api.UpdateDNSRecord(ctx, cloudflare.ZoneIdentifier(p.zoneID), cloudflare.UpdateDNSRecordParams{
 		ID:      payload.Id,
 		Name:    record.Name,
@@ -69,7 +88,7 @@ func (p *CloudflareProvider) Update(ctx context.Context, payload *provider.DnsPr
 		Content: record.Value,
 		TTL:     record.TTL,
 		Proxied: record.ExtraBool(ExtraKeyProxied),
-		Comment: record.ExtraString(ExtraKeyComment),
+		Comment: comment,
 		Tags:    record.ExtraStrings(ExtraKeyTags),
 	})
 	if _, ok := err.(*cloudflare.NotFoundError); ok {
@@ -93,6 +112,32 @@ func (p *CloudflareProvider) Delete(ctx context.Context, payload *provider.DnsPr
 	return err
 }
 
+func (p *CloudflareProvider) List(ctx context.Context) ([]provider.DnsProviderRecord, error) {
+	if p.marker == "" {
+		return nil, nil
+	}
+	records, _, err := p.api.ListDNSRecords(ctx, cloudflare.ZoneIdentifier(p.zoneID), cloudflare.ListDNSRecordsParams{})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]provider.DnsProviderRecord, 0)
+	for _, record := range records {
+		if !strings.Contains(record.Comment, p.marker) {
+			continue
+		}
+		result = append(result, provider.DnsProviderRecord{
+			Id: record.ID,
+			Record: dnsv1.RecordSpec{
+				Name:  record.Name,
+				Type:  dnsv1.RecordType(record.Type),
+				Value: record.Content,
+				TTL:   record.TTL,
+			},
+		})
+	}
+	return result, nil
+}
+
 func IsRecordNotFoundError(err error) bool {
 	if err == nil {
 		return false
@@ -120,6 +165,25 @@ func IsRecordDuplicateError(err error) bool {
 	return false
 }
 
+func (p *CloudflareProvider) HealthCheck(ctx context.Context) error {
+	_, err := p.api.ZoneDetails(ctx, p.zoneID)
+	return wrapHealthError(err)
+}
+
+// wrapHealthError wraps errors of rejected credentials or missing zones with the matching provider error
+func wrapHealthError(err error) error {
+	var authenticationError *cloudflare.AuthenticationError
+	var authorizationError *cloudflare.AuthorizationError
+	var notFoundError *cloudflare.NotFoundError
+	switch {
+	case errors.As(err, &authenticationError), errors.As(err, &authorizationError):
+		return fmt.Errorf("%w: %w", provider.ErrUnauthenticated, err)
+	case errors.As(err, &notFoundError), err != nil && err.Error() == "zone could not be found":
+		return fmt.Errorf("%w: %w", provider.ErrZoneNotFound, err)
+	}
+	return err
+}
+
 func init() {
 	provider.Register(dnsv1.ProviderTypeCloudflare, func(ctx context.Context, provider dnsv1.ProviderObject) (provider.DNSProvider, error) {
 		spec := provider.GetSpec()
@@ -146,12 +210,18 @@ func init() {
 		}
 		zoneID, err := p.api.ZoneIDByName(zoneName)
 		if err != nil {
-			return nil, err
+			return nil, wrapHealthError(err)
 		}
 		p.zoneID = zoneID
 
 		p.matchExistsRecord = spec.Cloudflare.MatchExistsRecord
+		p.marker = spec.Prune.Marker(provider.GetUID())
 
 		return p, nil
+	}, dnsv1.ProviderCapabilities{
+		MinTTL:    60,
+		MaxTTL:    86400,
+		ExtraTTLs: []int{1},
+		Proxy:     true,
 	})
 }
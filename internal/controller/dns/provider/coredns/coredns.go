@@ -0,0 +1,283 @@
+package coredns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+	"github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider"
+	"github.com/xzzpig/kube-dns-manager/internal/zonefile"
+)
+
+const (
+	// Suffix of the key of the ConfigMap holding the records a rendered file is built from,
+	// so Providers rendering different files into one ConfigMap keep their records apart
+	KeyRecordsSuffix = ".records.json"
+	// Key of the ConfigMap holding the records of all files written by older versions,
+	// it is only read to seed the records of a file which have not been stored yet
+	KeyRecords = "records.json"
+	// Annotation of the ConfigMap holding the SOA serial of the zone file
+	AnnotationSerial = "dns.xzzpig.com/serial"
+
+	DefaultNamespace = "kube-system"
+	DefaultTTL       = 300
+)
+
+var (
+	ErrUnsupportedType = errors.New("record type is not supported by the hosts format")
+	// ErrForbiddenConfigMap is returned for a namespaced Provider configured to write outside of its namespace or its file
+	ErrForbiddenConfigMap = errors.New("configmap is not allowed for a namespaced provider")
+)
+
+type CoreDNSProvider struct {
+	key    types.NamespacedName
+	format dnsv1.CoreDNSFormat
+	file   string
+	zone   string
+	ttl    int
+}
+
+// CoreDNSRecord is a record stored in the ConfigMap
+type CoreDNSRecord struct {
+	Name  string           `json:"name"`
+	Type  dnsv1.RecordType `json:"type"`
+	Value string           `json:"value"`
+	TTL   int              `json:"ttl,omitempty"`
+}
+
+func (r *CoreDNSRecord) ID() string {
+	return fmt.Sprintf("%s/%s/%s", r.Name, r.Type, r.Value)
+}
+
+func compareRecords(a, b CoreDNSRecord) int {
+	return zonefile.CompareRecords(
+		dnsv1.RecordSpec{Name: a.Name, Type: a.Type, Value: a.Value},
+		dnsv1.RecordSpec{Name: b.Name, Type: b.Type, Value: b.Value},
+	)
+}
+
+func (p *CoreDNSProvider) check(record *dnsv1.RecordSpec) error {
+	if p.format == dnsv1.CoreDNSFormatHosts {
+		if record.Type != dnsv1.RecordTypeA && record.Type != dnsv1.RecordTypeAAAA {
+			return fmt.Errorf("%w: %s", ErrUnsupportedType, record.Type)
+		}
+		if net.ParseIP(record.Value) == nil {
+			return fmt.Errorf("invalid ip address %s", record.Value)
+		}
+		return nil
+	}
+	if record.Name != p.zone && !strings.HasSuffix(record.Name, "."+p.zone) {
+		return fmt.Errorf("record %s is not in zone %s", record.Name, p.zone)
+	}
+	return nil
+}
+
+// Capabilities implements provider.DNSProviderCapabilities, the hosts format only holds addresses
+func (p *CoreDNSProvider) Capabilities() dnsv1.ProviderCapabilities {
+	if p.format == dnsv1.CoreDNSFormatHosts {
+		return dnsv1.ProviderCapabilities{RecordTypes: []dnsv1.RecordType{dnsv1.RecordTypeA, dnsv1.RecordTypeAAAA}}
+	}
+	return dnsv1.ProviderCapabilities{}
+}
+
+// modify applies fn to the records stored in the ConfigMap and renders the file if they changed
+func (p *CoreDNSProvider) modify(ctx context.Context, fn func(records []CoreDNSRecord) []CoreDNSRecord) error {
+	cli, err := provider.GetClient(ctx)
+	if err != nil {
+		return err
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm := &corev1.ConfigMap{}
+		found := true
+		if err := cli.Get(ctx, p.key, cm); apierrors.IsNotFound(err) {
+			found = false
+			cm.Namespace = p.key.Namespace
+			cm.Name = p.key.Name
+		} else if err != nil {
+			return err
+		}
+
+		records := make([]CoreDNSRecord, 0)
+		data, stored := cm.Data[p.recordsKey()]
+		if !stored {
+			data = cm.Data[KeyRecords]
+		}
+		if data != "" {
+			if err := json.Unmarshal([]byte(data), &records); err != nil {
+				return err
+			}
+		}
+		if !stored {
+			// the legacy key may hold the records of other files sharing the ConfigMap
+			records = slices.DeleteFunc(records, func(r CoreDNSRecord) bool {
+				return p.check(&dnsv1.RecordSpec{Name: r.Name, Type: r.Type, Value: r.Value}) != nil
+			})
+		}
+		records = fn(records)
+		slices.SortFunc(records, compareRecords)
+		records = slices.CompactFunc(records, func(a, b CoreDNSRecord) bool { return a.ID() == b.ID() })
+		newData, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return err
+		}
+		if found && stored && data == string(newData) {
+			return nil
+		}
+
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[p.recordsKey()] = string(newData)
+		if p.format == dnsv1.CoreDNSFormatZone {
+			if cm.Annotations == nil {
+				cm.Annotations = make(map[string]string)
+			}
+			oldSerial, _ := strconv.ParseUint(cm.Annotations[AnnotationSerial], 10, 32)
+			serial := zonefile.NextSerial(oldSerial, time.Now())
+			cm.Annotations[AnnotationSerial] = strconv.FormatUint(serial, 10)
+			if cm.Data[p.file], err = p.renderZone(records, serial); err != nil {
+				return err
+			}
+		} else {
+			cm.Data[p.file] = p.renderHosts(records)
+		}
+
+		if !found {
+			return cli.Create(ctx, cm)
+		}
+		return cli.Update(ctx, cm)
+	})
+}
+
+// recordsKey is the key of the ConfigMap holding the records of the rendered file
+func (p *CoreDNSProvider) recordsKey() string {
+	return p.file + KeyRecordsSuffix
+}
+
+func (p *CoreDNSProvider) renderHosts(records []CoreDNSRecord) string {
+	var b strings.Builder
+	for _, record := range records {
+		fmt.Fprintf(&b, "%s %s\n", record.Value, record.Name)
+	}
+	return b.String()
+}
+
+func (p *CoreDNSProvider) renderZone(records []CoreDNSRecord, serial uint64) (string, error) {
+	specs := make([]dnsv1.RecordSpec, 0, len(records))
+	for _, record := range records {
+		specs = append(specs, dnsv1.RecordSpec{Name: record.Name, Type: record.Type, Value: record.Value, TTL: record.TTL})
+	}
+	var b strings.Builder
+	err := zonefile.Write(&b, &zonefile.Zone{Origin: p.zone, TTL: p.ttl, Serial: serial}, specs)
+	return b.String(), err
+}
+
+func newRecord(record *dnsv1.RecordSpec) CoreDNSRecord {
+	return CoreDNSRecord{Name: strings.ToLower(record.Name), Type: record.Type, Value: record.Value, TTL: record.TTL}
+}
+
+func (p *CoreDNSProvider) Create(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
+	if err := p.check(payload.Record); err != nil {
+		return err
+	}
+	record := newRecord(payload.Record)
+	if err := p.modify(ctx, func(records []CoreDNSRecord) []CoreDNSRecord {
+		return append(records, record)
+	}); err != nil {
+		return err
+	}
+	payload.Id = record.ID()
+	return nil
+}
+
+func (p *CoreDNSProvider) Update(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
+	if err := p.check(payload.Record); err != nil {
+		return err
+	}
+	record := newRecord(payload.Record)
+	if err := p.modify(ctx, func(records []CoreDNSRecord) []CoreDNSRecord {
+		records = slices.DeleteFunc(records, func(r CoreDNSRecord) bool { return r.ID() == payload.Id || r.ID() == record.ID() })
+		return append(records, record)
+	}); err != nil {
+		return err
+	}
+	payload.Id = record.ID()
+	return nil
+}
+
+func (p *CoreDNSProvider) Delete(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
+	if err := p.modify(ctx, func(records []CoreDNSRecord) []CoreDNSRecord {
+		return slices.DeleteFunc(records, func(r CoreDNSRecord) bool { return r.ID() == payload.Id })
+	}); err != nil {
+		return err
+	}
+	payload.Id = ""
+	return nil
+}
+
+func init() {
+	provider.Register(dnsv1.ProviderTypeCoreDNS, func(ctx context.Context, provider dnsv1.ProviderObject) (provider.DNSProvider, error) {
+		spec := provider.GetSpec()
+		if spec.CoreDNS == nil || spec.CoreDNS.Name == "" {
+			return nil, fmt.Errorf("coredns provider requires the name of the ConfigMap")
+		}
+		p := &CoreDNSProvider{
+			key:    types.NamespacedName{Namespace: spec.CoreDNS.Namespace, Name: spec.CoreDNS.Name},
+			format: spec.CoreDNS.Format,
+			file:   spec.CoreDNS.Key,
+			zone:   strings.TrimSuffix(strings.ToLower(spec.CoreDNS.Zone), "."),
+			ttl:    spec.CoreDNS.TTL,
+		}
+		if p.key.Namespace == "" {
+			p.key.Namespace = provider.GetNamespace()
+		}
+		if p.key.Namespace == "" {
+			p.key.Namespace = DefaultNamespace
+		}
+		if p.format == "" {
+			p.format = dnsv1.CoreDNSFormatHosts
+		}
+		if p.zone == "" {
+			p.zone = strings.ToLower(spec.Selector.Domain)
+		}
+		if p.ttl <= 0 {
+			p.ttl = DefaultTTL
+		}
+		if p.format == dnsv1.CoreDNSFormatZone && p.zone == "" {
+			return nil, fmt.Errorf("coredns provider requires a zone for the Zone format")
+		}
+		defaultFile := "hosts"
+		if p.format == dnsv1.CoreDNSFormatZone {
+			defaultFile = "db." + p.zone
+		}
+		if p.file == "" {
+			p.file = defaultFile
+		}
+		if p.file == KeyRecords || strings.HasSuffix(p.file, KeyRecordsSuffix) {
+			return nil, fmt.Errorf("coredns provider can not render into the key %s reserved for the records", p.file)
+		}
+		// the manager may write any ConfigMap, a namespaced Provider must not be able to replace
+		// the Corefile or the files of other Providers through it
+		if namespace := provider.GetNamespace(); namespace != "" {
+			if p.key.Namespace != namespace {
+				return nil, fmt.Errorf("%w: namespace %s is not the namespace of the provider", ErrForbiddenConfigMap, p.key.Namespace)
+			}
+			if p.file != defaultFile {
+				return nil, fmt.Errorf("%w: key %s is not the default key %s", ErrForbiddenConfigMap, p.file, defaultFile)
+			}
+		}
+		return p, nil
+	}, dnsv1.ProviderCapabilities{})
+}
@@ -0,0 +1,222 @@
+package coredns
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+	"github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider"
+)
+
+func newTestProvider(t *testing.T, config *dnsv1.CoreDNSProviderConfig) (context.Context, client.Client, provider.DNSProvider) {
+	cli := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+	ctx := context.WithValue(context.Background(), provider.CtxKeyClient, cli)
+	p, err := provider.New(ctx, &dnsv1.ClusterProvider{Spec: dnsv1.ProviderSpec{
+		Type:     dnsv1.ProviderTypeCoreDNS,
+		Selector: dnsv1.ProviderSelector{Domain: "example.com"},
+		CoreDNS:  config,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ctx, cli, p
+}
+
+func getConfigMap(t *testing.T, ctx context.Context, cli client.Client) *corev1.ConfigMap {
+	cm := &corev1.ConfigMap{}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: DefaultNamespace, Name: "custom-hosts"}, cm); err != nil {
+		t.Fatal(err)
+	}
+	return cm
+}
+
+func TestHosts(t *testing.T) {
+	ctx, cli, p := newTestProvider(t, &dnsv1.CoreDNSProviderConfig{Name: "custom-hosts"})
+
+	b := &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "b.example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.2"}}
+	a := &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "a.example.com", Type: dnsv1.RecordTypeAAAA, Value: "fd00::1"}}
+	for _, payload := range []*provider.DnsProviderPayload{b, a} {
+		if err := p.Create(ctx, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if hosts := getConfigMap(t, ctx, cli).Data["hosts"]; hosts != "fd00::1 a.example.com\n10.0.0.2 b.example.com\n" {
+		t.Fatalf("unexpected hosts %q", hosts)
+	}
+
+	b.Record = &dnsv1.RecordSpec{Name: "b.example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.3"}
+	if err := p.Update(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Delete(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if hosts := getConfigMap(t, ctx, cli).Data["hosts"]; hosts != "10.0.0.3 b.example.com\n" {
+		t.Fatalf("unexpected hosts %q", hosts)
+	}
+
+	err := p.Create(ctx, &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "c.example.com", Type: dnsv1.RecordTypeCNAME, Value: "b.example.com"}})
+	if err == nil {
+		t.Fatal("expected CNAME to be rejected by the hosts format")
+	}
+}
+
+func TestZone(t *testing.T) {
+	ctx, cli, p := newTestProvider(t, &dnsv1.CoreDNSProviderConfig{Name: "custom-hosts", Format: dnsv1.CoreDNSFormatZone, TTL: 60})
+
+	cname := &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "www.example.com", Type: dnsv1.RecordTypeCNAME, Value: "example.com"}}
+	if err := p.Create(ctx, cname); err != nil {
+		t.Fatal(err)
+	}
+	cm := getConfigMap(t, ctx, cli)
+	serial := cm.Annotations[AnnotationSerial]
+	zone := cm.Data["db.example.com"]
+	if !strings.Contains(zone, "$ORIGIN example.com.\n") || !strings.Contains(zone, " "+serial+" ") || !strings.HasSuffix(zone, "www.example.com.\t60\tIN\tCNAME\texample.com.\n") {
+		t.Fatalf("unexpected zone %q", zone)
+	}
+
+	// an unchanged record must not bump the serial
+	if err := p.Update(ctx, cname); err != nil {
+		t.Fatal(err)
+	}
+	if getConfigMap(t, ctx, cli).Annotations[AnnotationSerial] != serial {
+		t.Fatal("serial changed without a change of the records")
+	}
+
+	txt := &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "example.com", Type: dnsv1.RecordTypeTXT, Value: "hello world", TTL: 120}}
+	if err := p.Create(ctx, txt); err != nil {
+		t.Fatal(err)
+	}
+	cm = getConfigMap(t, ctx, cli)
+	if cm.Annotations[AnnotationSerial] == serial {
+		t.Fatal("serial not bumped after a change of the records")
+	}
+	if !strings.Contains(cm.Data["db.example.com"], "example.com.\t120\tIN\tTXT\t\"hello world\"\nwww.example.com.") {
+		t.Fatalf("unexpected zone %q", cm.Data["db.example.com"])
+	}
+
+	err := p.Create(ctx, &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "other.org", Type: dnsv1.RecordTypeA, Value: "10.0.0.1"}})
+	if err == nil {
+		t.Fatal("expected a record outside of the zone to be rejected")
+	}
+}
+
+func TestSharedConfigMap(t *testing.T) {
+	// records stored by older versions under the shared legacy key are seeded into the file they belong to
+	legacy := `[{"name":"old.example.com","type":"A","value":"10.0.0.9"},{"name":"txt.example.com","type":"TXT","value":"old"}]`
+	cli := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: DefaultNamespace, Name: "custom-hosts"},
+		Data:       map[string]string{KeyRecords: legacy},
+	}).Build()
+	ctx := context.WithValue(context.Background(), provider.CtxKeyClient, cli)
+	newProvider := func(config *dnsv1.CoreDNSProviderConfig) provider.DNSProvider {
+		p, err := provider.New(ctx, &dnsv1.ClusterProvider{Spec: dnsv1.ProviderSpec{
+			Type:     dnsv1.ProviderTypeCoreDNS,
+			Selector: dnsv1.ProviderSelector{Domain: "example.com"},
+			CoreDNS:  config,
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	hosts := newProvider(&dnsv1.CoreDNSProviderConfig{Name: "custom-hosts"})
+	zone := newProvider(&dnsv1.CoreDNSProviderConfig{Name: "custom-hosts", Format: dnsv1.CoreDNSFormatZone})
+
+	if err := hosts.Create(ctx, &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "a.example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := zone.Create(ctx, &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "www.example.com", Type: dnsv1.RecordTypeCNAME, Value: "example.com"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := hosts.Create(ctx, &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "b.example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.2"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	cm := getConfigMap(t, ctx, cli)
+	if data := cm.Data["hosts"]; data != "10.0.0.1 a.example.com\n10.0.0.2 b.example.com\n10.0.0.9 old.example.com\n" {
+		t.Fatalf("unexpected hosts %q", data)
+	}
+	if data := cm.Data["db.example.com"]; !strings.Contains(data, "www.example.com.") || !strings.Contains(data, "old.example.com.") || strings.Contains(data, "a.example.com.") {
+		t.Fatalf("unexpected zone %q", data)
+	}
+	if !strings.Contains(cm.Data["hosts"+KeyRecordsSuffix], "b.example.com") || strings.Contains(cm.Data["db.example.com"+KeyRecordsSuffix], "b.example.com") {
+		t.Fatalf("records of the files are not kept apart: %v", cm.Data)
+	}
+}
+
+func TestRecordsKey(t *testing.T) {
+	for _, key := range []string{KeyRecords, "hosts" + KeyRecordsSuffix} {
+		_, err := provider.New(context.Background(), &dnsv1.ClusterProvider{Spec: dnsv1.ProviderSpec{
+			Type:     dnsv1.ProviderTypeCoreDNS,
+			Selector: dnsv1.ProviderSelector{Domain: "example.com"},
+			CoreDNS:  &dnsv1.CoreDNSProviderConfig{Name: "custom-hosts", Key: key},
+		}})
+		if err == nil {
+			t.Errorf("expected the key %s holding records to be rejected", key)
+		}
+	}
+}
+
+func TestNamespacedProvider(t *testing.T) {
+	newProvider := func(config *dnsv1.CoreDNSProviderConfig) error {
+		_, err := provider.New(context.Background(), &dnsv1.Provider{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team"},
+			Spec: dnsv1.ProviderSpec{
+				Type:     dnsv1.ProviderTypeCoreDNS,
+				Selector: dnsv1.ProviderSelector{Domain: "example.com"},
+				CoreDNS:  config,
+			},
+		})
+		return err
+	}
+	tests := []struct {
+		name    string
+		config  dnsv1.CoreDNSProviderConfig
+		allowed bool
+	}{
+		{name: "own namespace", config: dnsv1.CoreDNSProviderConfig{Name: "hosts"}, allowed: true},
+		{name: "explicit own namespace", config: dnsv1.CoreDNSProviderConfig{Name: "hosts", Namespace: "team", Key: "hosts"}, allowed: true},
+		{name: "zone key", config: dnsv1.CoreDNSProviderConfig{Name: "zone", Format: dnsv1.CoreDNSFormatZone, Key: "db.example.com"}, allowed: true},
+		{name: "other namespace", config: dnsv1.CoreDNSProviderConfig{Name: "coredns", Namespace: "kube-system"}},
+		{name: "corefile", config: dnsv1.CoreDNSProviderConfig{Name: "coredns", Key: "Corefile"}},
+		{name: "arbitrary key", config: dnsv1.CoreDNSProviderConfig{Name: "hosts", Key: "other"}},
+		{name: "records key", config: dnsv1.CoreDNSProviderConfig{Name: "hosts", Key: KeyRecords}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newProvider(&tt.config)
+			if tt.allowed && err != nil {
+				t.Fatalf("expected the config to be allowed, got %v", err)
+			}
+			if !tt.allowed && err == nil {
+				t.Fatal("expected the config to be rejected")
+			}
+		})
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	_, _, hosts := newTestProvider(t, &dnsv1.CoreDNSProviderConfig{Name: "custom-hosts"})
+	caps := hosts.(provider.DNSProviderCapabilities).Capabilities()
+	if err := caps.Check(&dnsv1.RecordSpec{Type: dnsv1.RecordTypeCNAME}); err == nil {
+		t.Error("expected CNAME to be rejected by the capabilities of the hosts format")
+	}
+	if err := caps.Check(&dnsv1.RecordSpec{Type: dnsv1.RecordTypeAAAA}); err != nil {
+		t.Errorf("expected AAAA to be supported by the hosts format, got %v", err)
+	}
+
+	_, _, zone := newTestProvider(t, &dnsv1.CoreDNSProviderConfig{Name: "custom-hosts", Format: dnsv1.CoreDNSFormatZone})
+	caps = zone.(provider.DNSProviderCapabilities).Capabilities()
+	if err := caps.Check(&dnsv1.RecordSpec{Type: dnsv1.RecordTypeCNAME}); err != nil {
+		t.Errorf("expected CNAME to be supported by the zone format, got %v", err)
+	}
+}
@@ -0,0 +1,234 @@
+package etcd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+	"github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider"
+)
+
+const (
+	DefaultPrefix      = "/skydns"
+	DefaultDialTimeout = 5 * time.Second
+)
+
+var ErrInvalidValue = errors.New("invalid record value")
+
+// SkyDNSMessage is the value layout read by the etcd plugin of CoreDNS
+type SkyDNSMessage struct {
+	Host     string `json:"host,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	Priority int    `json:"priority,omitempty"`
+	Weight   int    `json:"weight,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Mail     bool   `json:"mail,omitempty"`
+	TTL      uint32 `json:"ttl,omitempty"`
+}
+
+type EtcdProvider struct {
+	kv     clientv3.KV
+	closer io.Closer
+	prefix string
+}
+
+// Key returns the key of the record: the prefix followed by the reversed labels of the name and a leaf
+// derived from the type and value, so several records can share the same name
+func (p *EtcdProvider) Key(record *dnsv1.RecordSpec) string {
+	labels := strings.Split(strings.TrimSuffix(strings.ToLower(record.Name), "."), ".")
+	slices.Reverse(labels)
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(string(record.Type) + " " + record.Value))
+	return path.Join(append(append([]string{p.prefix}, labels...), fmt.Sprintf("kdm-%08x", hash.Sum32()))...)
+}
+
+// NewMessage converts the record to a SkyDNS message
+// MX values are "<priority> <host>", SRV values are "<priority> <weight> <port> <host>"
+func NewMessage(record *dnsv1.RecordSpec) (*SkyDNSMessage, error) {
+	msg := &SkyDNSMessage{TTL: uint32(record.TTL)}
+	fields := strings.Fields(record.Value)
+	var err error
+	switch record.Type {
+	case dnsv1.RecordTypeA, dnsv1.RecordTypeAAAA:
+		ip := net.ParseIP(record.Value)
+		if ip == nil || (ip.To4() != nil) != (record.Type == dnsv1.RecordTypeA) {
+			return nil, fmt.Errorf("%w: %s is not valid for %s record", ErrInvalidValue, record.Value, record.Type)
+		}
+		msg.Host = record.Value
+	case dnsv1.RecordTypeCNAME:
+		if net.ParseIP(record.Value) != nil {
+			return nil, fmt.Errorf("%w: %s is not valid for %s record", ErrInvalidValue, record.Value, record.Type)
+		}
+		msg.Host = record.Value
+	case dnsv1.RecordTypeTXT:
+		msg.Text = record.Value
+	case dnsv1.RecordTypeMX:
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%w: MX record should be <priority> <host>", ErrInvalidValue)
+		}
+		msg.Mail = true
+		msg.Host = fields[1]
+		msg.Priority, err = strconv.Atoi(fields[0])
+	case dnsv1.RecordTypeSRV:
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("%w: SRV record should be <priority> <weight> <port> <host>", ErrInvalidValue)
+		}
+		msg.Host = fields[3]
+		if msg.Priority, err = strconv.Atoi(fields[0]); err == nil {
+			if msg.Weight, err = strconv.Atoi(fields[1]); err == nil {
+				msg.Port, err = strconv.Atoi(fields[2])
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%w: record type %s is not supported", ErrInvalidValue, record.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidValue, err)
+	}
+	return msg, nil
+}
+
+func (p *EtcdProvider) put(ctx context.Context, record *dnsv1.RecordSpec) (string, error) {
+	msg, err := NewMessage(record)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	key := p.Key(record)
+	if _, err := p.kv.Put(ctx, key, string(data)); err != nil {
+		return "", wrapError(err)
+	}
+	return key, nil
+}
+
+func (p *EtcdProvider) Create(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
+	key, err := p.put(ctx, payload.Record)
+	if err != nil {
+		return err
+	}
+	payload.Id = key
+	return nil
+}
+
+func (p *EtcdProvider) Update(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
+	key, err := p.put(ctx, payload.Record)
+	if err != nil {
+		return err
+	}
+	if payload.Id != "" && payload.Id != key {
+		if _, err := p.kv.Delete(ctx, payload.Id); err != nil {
+			return wrapError(err)
+		}
+	}
+	payload.Id = key
+	return nil
+}
+
+func (p *EtcdProvider) Delete(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
+	if _, err := p.kv.Delete(ctx, payload.Id); err != nil {
+		return wrapError(err)
+	}
+	payload.Id = ""
+	return nil
+}
+
+func (p *EtcdProvider) HealthCheck(ctx context.Context) error {
+	_, err := p.kv.Get(ctx, p.prefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+	return wrapError(err)
+}
+
+func (p *EtcdProvider) Close() error {
+	if p.closer == nil {
+		return nil
+	}
+	return p.closer.Close()
+}
+
+// wrapError wraps errors of rejected credentials with provider.ErrUnauthenticated
+func wrapError(err error) error {
+	if errors.Is(err, rpctypes.ErrAuthFailed) || errors.Is(err, rpctypes.ErrPermissionDenied) ||
+		errors.Is(err, rpctypes.ErrUserEmpty) || errors.Is(err, rpctypes.ErrInvalidAuthToken) {
+		return fmt.Errorf("%w: %w", provider.ErrUnauthenticated, err)
+	}
+	return err
+}
+
+// newTLSConfig builds the TLS config of the etcd client, nil if TLS is not configured
+func newTLSConfig(config *dnsv1.EtcdProviderConfig) (*tls.Config, error) {
+	if config.CACert == "" && config.ClientCert == "" && !config.InsecureSkipVerify {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	if config.CACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(config.CACert)) {
+			return nil, fmt.Errorf("etcd provider: no valid certificate found in caCert")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if config.ClientCert != "" {
+		cert, err := tls.X509KeyPair([]byte(config.ClientCert), []byte(config.ClientKey))
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func init() {
+	provider.Register(dnsv1.ProviderTypeEtcd, func(ctx context.Context, provider dnsv1.ProviderObject) (provider.DNSProvider, error) {
+		spec := provider.GetSpec()
+		if spec.Etcd == nil || len(spec.Etcd.Endpoints) == 0 {
+			return nil, fmt.Errorf("etcd provider requires endpoints")
+		}
+		tlsConfig, err := newTLSConfig(spec.Etcd)
+		if err != nil {
+			return nil, err
+		}
+		dialTimeout := spec.Etcd.DialTimeout.Duration
+		if dialTimeout <= 0 {
+			dialTimeout = DefaultDialTimeout
+		}
+		client, err := clientv3.New(clientv3.Config{
+			Endpoints:   spec.Etcd.Endpoints,
+			DialTimeout: dialTimeout,
+			TLS:         tlsConfig,
+			Username:    spec.Etcd.Username,
+			Password:    spec.Etcd.Password,
+		})
+		if err != nil {
+			return nil, wrapError(err)
+		}
+
+		p := &EtcdProvider{kv: client, closer: client, prefix: spec.Etcd.Prefix}
+		if p.prefix == "" {
+			p.prefix = DefaultPrefix
+		}
+		p.prefix = "/" + strings.Trim(p.prefix, "/")
+		return p, nil
+	}, dnsv1.ProviderCapabilities{
+		RecordTypes: []dnsv1.RecordType{
+			dnsv1.RecordTypeA, dnsv1.RecordTypeAAAA, dnsv1.RecordTypeCNAME,
+			dnsv1.RecordTypeTXT, dnsv1.RecordTypeMX, dnsv1.RecordTypeSRV,
+		},
+	})
+}
@@ -0,0 +1,189 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+	"github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider"
+)
+
+// startEtcd starts an embedded single member etcd server and returns its client endpoint
+func startEtcd(t *testing.T) string {
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	local := []url.URL{{Scheme: "http", Host: "127.0.0.1:0"}}
+	cfg.ListenClientUrls, cfg.AdvertiseClientUrls = local, local
+	cfg.ListenPeerUrls, cfg.AdvertisePeerUrls = local, local
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	server, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	select {
+	case <-server.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("etcd server not ready")
+	}
+	return "http://" + server.Clients[0].Addr().String()
+}
+
+func newTestProvider(t *testing.T, config *dnsv1.EtcdProviderConfig) (provider.DNSProvider, error) {
+	p, err := provider.New(context.Background(), &dnsv1.ClusterProvider{Spec: dnsv1.ProviderSpec{Type: dnsv1.ProviderTypeEtcd, Etcd: config}})
+	if err == nil {
+		t.Cleanup(func() { _ = p.(io.Closer).Close() })
+	}
+	return p, err
+}
+
+func newTestClient(t *testing.T, endpoint string, username, password string) *clientv3.Client {
+	client, err := clientv3.New(clientv3.Config{Endpoints: []string{endpoint}, DialTimeout: 5 * time.Second, Username: username, Password: password})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+// keys returns the keys and values under the prefix
+func keys(t *testing.T, client *clientv3.Client, prefix string) map[string]string {
+	resp, err := client.Get(context.Background(), prefix, clientv3.WithPrefix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make(map[string]string)
+	for _, kv := range resp.Kvs {
+		data[string(kv.Key)] = string(kv.Value)
+	}
+	return data
+}
+
+func TestLifecycle(t *testing.T) {
+	ctx := context.Background()
+	endpoint := startEtcd(t)
+	p, err := newTestProvider(t, &dnsv1.EtcdProviderConfig{Endpoints: []string{endpoint}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newTestClient(t, endpoint, "", "")
+
+	a := &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "a.Example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.1", TTL: 60}}
+	b := &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "a.example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.2"}}
+	for _, payload := range []*provider.DnsProviderPayload{a, b} {
+		if err := p.Create(ctx, payload); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(payload.Id, "/skydns/com/example/a/kdm-") {
+			t.Fatalf("unexpected key %s", payload.Id)
+		}
+	}
+	data := keys(t, client, DefaultPrefix)
+	if len(data) != 2 {
+		t.Fatalf("expected two keys for two values of the same name, got %v", data)
+	}
+	msg := SkyDNSMessage{}
+	if err := json.Unmarshal([]byte(data[a.Id]), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg != (SkyDNSMessage{Host: "10.0.0.1", TTL: 60}) {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+
+	oldID := b.Id
+	b.Record = &dnsv1.RecordSpec{Name: "a.example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.3"}
+	if err := p.Update(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	data = keys(t, client, DefaultPrefix)
+	if _, ok := data[oldID]; ok || b.Id == oldID || len(data) != 2 {
+		t.Fatalf("old key not replaced: %v", data)
+	}
+
+	if err := p.(provider.DNSProviderHealthChecker).HealthCheck(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, payload := range []*provider.DnsProviderPayload{a, b} {
+		if err := p.Delete(ctx, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data := keys(t, client, DefaultPrefix); len(data) != 0 {
+		t.Fatalf("keys left after delete: %v", data)
+	}
+}
+
+func TestNewMessage(t *testing.T) {
+	for _, c := range []struct {
+		record   dnsv1.RecordSpec
+		expected *SkyDNSMessage
+	}{
+		{dnsv1.RecordSpec{Type: dnsv1.RecordTypeAAAA, Value: "fd00::1"}, &SkyDNSMessage{Host: "fd00::1"}},
+		{dnsv1.RecordSpec{Type: dnsv1.RecordTypeCNAME, Value: "b.example.com"}, &SkyDNSMessage{Host: "b.example.com"}},
+		{dnsv1.RecordSpec{Type: dnsv1.RecordTypeTXT, Value: "hello world"}, &SkyDNSMessage{Text: "hello world"}},
+		{dnsv1.RecordSpec{Type: dnsv1.RecordTypeMX, Value: "10 mail.example.com"}, &SkyDNSMessage{Host: "mail.example.com", Priority: 10, Mail: true}},
+		{dnsv1.RecordSpec{Type: dnsv1.RecordTypeSRV, Value: "10 20 443 web.example.com"}, &SkyDNSMessage{Host: "web.example.com", Priority: 10, Weight: 20, Port: 443}},
+		{dnsv1.RecordSpec{Type: dnsv1.RecordTypeA, Value: "fd00::1"}, nil},
+		{dnsv1.RecordSpec{Type: dnsv1.RecordTypeMX, Value: "mail.example.com"}, nil},
+		{dnsv1.RecordSpec{Type: dnsv1.RecordTypeCAA, Value: `0 issue "letsencrypt.org"`}, nil},
+	} {
+		msg, err := NewMessage(&c.record)
+		if c.expected == nil {
+			if !errors.Is(err, ErrInvalidValue) {
+				t.Errorf("%s %s: expected ErrInvalidValue, got %v", c.record.Type, c.record.Value, err)
+			}
+			continue
+		}
+		if err != nil || *msg != *c.expected {
+			t.Errorf("%s %s: unexpected message %+v, %v", c.record.Type, c.record.Value, msg, err)
+		}
+	}
+}
+
+func TestUnauthenticated(t *testing.T) {
+	ctx := context.Background()
+	endpoint := startEtcd(t)
+	client := newTestClient(t, endpoint, "", "")
+	for _, op := range []func() error{
+		func() error { _, err := client.UserAdd(ctx, "root", "secret"); return err },
+		func() error { _, err := client.UserGrantRole(ctx, "root", "root"); return err },
+		func() error { _, err := client.AuthEnable(ctx); return err },
+	} {
+		if err := op(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := newTestProvider(t, &dnsv1.EtcdProviderConfig{Endpoints: []string{endpoint}, Username: "root", Password: "wrong"})
+	if !errors.Is(err, provider.ErrUnauthenticated) {
+		t.Fatalf("expected ErrUnauthenticated for a wrong password, got %v", err)
+	}
+
+	p, err := newTestProvider(t, &dnsv1.EtcdProviderConfig{Endpoints: []string{endpoint}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.(provider.DNSProviderHealthChecker).HealthCheck(ctx); !errors.Is(err, provider.ErrUnauthenticated) {
+		t.Fatalf("expected ErrUnauthenticated without credentials, got %v", err)
+	}
+
+	p, err = newTestProvider(t, &dnsv1.EtcdProviderConfig{Endpoints: []string{endpoint}, Username: "root", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.(provider.DNSProviderHealthChecker).HealthCheck(ctx); err != nil {
+		t.Fatalf("expected the health check to pass with valid credentials, got %v", err)
+	}
+}
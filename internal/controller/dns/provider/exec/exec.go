@@ -0,0 +1,201 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+	"github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider"
+)
+
+const (
+	DefaultTimeout = 30 * time.Second
+
+	// maxStderrBytes limits the stderr of a failed command in the returned error
+	maxStderrBytes = 1024
+)
+
+var (
+	ErrTimeout = errors.New("command timed out")
+	// ErrCommandNotAllowed is returned for a command which is not in AllowedCommands
+	ErrCommandNotAllowed = errors.New("command is not allowed")
+)
+
+// AllowedCommands are the executables EXEC providers may run, set by the --exec-allowed-commands flag of the manager.
+// The commands run with the service account of the manager, so if it is empty only ClusterProviders can use EXEC,
+// otherwise every command must be one of them, also for a ClusterProvider
+var AllowedCommands []string
+
+type ExecProvider struct {
+	command    []string
+	env        []string
+	workingDir string
+	timeout    time.Duration
+}
+
+// ExecRequest is written as JSON to the stdin of the command
+type ExecRequest struct {
+	// create, update or delete
+	Action string           `json:"action"`
+	ID     string           `json:"id,omitempty"`
+	Data   string           `json:"data,omitempty"`
+	Record dnsv1.RecordSpec `json:"record"`
+}
+
+// ExecResponse is read as JSON from the stdout of the command, an empty stdout keeps the id and data
+type ExecResponse struct {
+	ID   *string `json:"id,omitempty"`
+	Data *string `json:"data,omitempty"`
+}
+
+// ExitError is returned if the command exits with a non-zero code
+type ExitError struct {
+	Code   int
+	Stderr string
+}
+
+func (e *ExitError) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("command exited with code %d", e.Code)
+	}
+	return fmt.Sprintf("command exited with code %d: %s", e.Code, e.Stderr)
+}
+
+// defaultID identifies the record if the command does not print an id
+func defaultID(record *dnsv1.RecordSpec) string {
+	return fmt.Sprintf("%s/%s/%s", strings.ToLower(record.Name), record.Type, record.Value)
+}
+
+func (p *ExecProvider) run(ctx context.Context, action string, payload *provider.DnsProviderPayload) error {
+	request := ExecRequest{Action: action, ID: payload.Id, Data: payload.Data, Record: *payload.Record}
+	stdin, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	cmd := osexec.CommandContext(ctx, p.command[0], p.command[1:]...)
+	cmd.Dir = p.workingDir
+	// the environment of the manager may hold credentials, only PATH is passed on
+	cmd.Env = append([]string{"PATH=" + os.Getenv("PATH")}, p.env...)
+	cmd.Env = append(cmd.Env,
+		"RECORD_ACTION="+action,
+		"RECORD_ID="+payload.Id,
+		"RECORD_NAME="+payload.Record.Name,
+		"RECORD_TYPE="+string(payload.Record.Type),
+		"RECORD_VALUE="+payload.Record.Value,
+		"RECORD_TTL="+strconv.Itoa(payload.Record.TTL),
+	)
+	cmd.Stdin = bytes.NewReader(stdin)
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	// do not wait for children of the killed command which keep stdout open
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%w after %s", ErrTimeout, p.timeout)
+		}
+		exitErr := &osexec.ExitError{}
+		if errors.As(err, &exitErr) {
+			message := strings.TrimSpace(stderr.String())
+			if len(message) > maxStderrBytes {
+				message = message[:maxStderrBytes]
+			}
+			return &ExitError{Code: exitErr.ExitCode(), Stderr: message}
+		}
+		return err
+	}
+
+	response := ExecResponse{}
+	if output := bytes.TrimSpace(stdout.Bytes()); len(output) != 0 {
+		if err := json.Unmarshal(output, &response); err != nil {
+			return fmt.Errorf("invalid output of the command: %w", err)
+		}
+	}
+	if response.ID != nil {
+		payload.Id = *response.ID
+	}
+	if response.Data != nil {
+		payload.Data = *response.Data
+	}
+	return nil
+}
+
+func (p *ExecProvider) Create(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
+	payload.Id = ""
+	if err := p.run(ctx, "create", payload); err != nil {
+		return err
+	}
+	if payload.Id == "" {
+		payload.Id = defaultID(payload.Record)
+	}
+	return nil
+}
+
+func (p *ExecProvider) Update(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
+	if err := p.run(ctx, "update", payload); err != nil {
+		return err
+	}
+	if payload.Id == "" {
+		payload.Id = defaultID(payload.Record)
+	}
+	return nil
+}
+
+func (p *ExecProvider) Delete(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
+	if err := p.run(ctx, "delete", payload); err != nil {
+		return err
+	}
+	payload.Id = ""
+	payload.Data = ""
+	return nil
+}
+
+// checkCommand returns ErrCommandNotAllowed if the provider may not run the executable
+func checkCommand(provider dnsv1.ProviderObject, executable string) error {
+	if len(AllowedCommands) != 0 {
+		if !slices.Contains(AllowedCommands, executable) {
+			return fmt.Errorf("%w: %s is not in the allowed commands of the manager", ErrCommandNotAllowed, executable)
+		}
+		return nil
+	}
+	if provider.GetNamespace() != "" {
+		return fmt.Errorf("%w: only a ClusterProvider can run commands unless the manager allows them", ErrCommandNotAllowed)
+	}
+	return nil
+}
+
+func init() {
+	provider.Register(dnsv1.ProviderTypeExec, func(ctx context.Context, provider dnsv1.ProviderObject) (provider.DNSProvider, error) {
+		spec := provider.GetSpec()
+		if spec.Exec == nil || len(spec.Exec.Command) == 0 {
+			return nil, fmt.Errorf("exec provider requires a command")
+		}
+		if err := checkCommand(provider, spec.Exec.Command[0]); err != nil {
+			return nil, err
+		}
+		p := &ExecProvider{
+			command:    spec.Exec.Command,
+			workingDir: spec.Exec.WorkingDir,
+			timeout:    spec.Exec.Timeout.Duration,
+		}
+		for key, value := range spec.Exec.Env {
+			p.env = append(p.env, key+"="+value)
+		}
+		if p.timeout <= 0 {
+			p.timeout = DefaultTimeout
+		}
+		return p, nil
+	}, dnsv1.ProviderCapabilities{})
+}
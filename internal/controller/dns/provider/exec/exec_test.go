@@ -0,0 +1,154 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+	"github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider"
+)
+
+func newTestProvider(t *testing.T, script string, timeout time.Duration) provider.DNSProvider {
+	return newTestProviderIn(t, "", script, timeout)
+}
+
+func newTestProviderIn(t *testing.T, dir string, script string, timeout time.Duration) provider.DNSProvider {
+	p, err := provider.New(context.Background(), &dnsv1.ClusterProvider{Spec: dnsv1.ProviderSpec{
+		Type: dnsv1.ProviderTypeExec,
+		Exec: &dnsv1.ExecProviderConfig{
+			Command:    []string{"sh", "-c", script},
+			Env:        map[string]string{"PREFIX": "rec"},
+			WorkingDir: dir,
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeout != 0 {
+		p.(*ExecProvider).timeout = timeout
+	}
+	return p
+}
+
+func TestLifecycle(t *testing.T) {
+	// keep the request of the last call in the working directory
+	dir := t.TempDir()
+	p := newTestProviderIn(t, dir, `cat > request.json; printf '{"id": "%s-%s-%s", "data": "%s"}' "$PREFIX" "$RECORD_ACTION" "$RECORD_NAME" "$RECORD_VALUE"`, 0)
+	ctx := context.Background()
+
+	payload := &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "a.example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.1"}}
+	if err := p.Create(ctx, payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Id != "rec-create-a.example.com" {
+		t.Fatalf("unexpected id %q", payload.Id)
+	}
+	if payload.Data != "10.0.0.1" {
+		t.Fatalf("unexpected data %q", payload.Data)
+	}
+	request, err := os.ReadFile(filepath.Join(dir, "request.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(request) != `{"action":"create","record":{"name":"a.example.com","type":"A","value":"10.0.0.1"}}` {
+		t.Fatalf("unexpected request %s", request)
+	}
+
+	if err := p.Update(ctx, payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Id != "rec-update-a.example.com" {
+		t.Fatalf("unexpected id %q", payload.Id)
+	}
+	if request, _ := os.ReadFile(filepath.Join(dir, "request.json")); !strings.Contains(string(request), `"id":"rec-create-a.example.com","data":"10.0.0.1"`) {
+		t.Fatalf("previous id and data not passed: %s", request)
+	}
+
+	if err := p.Delete(ctx, payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Id != "" || payload.Data != "" {
+		t.Fatalf("id and data not cleared: %q %q", payload.Id, payload.Data)
+	}
+}
+
+func TestEmptyOutput(t *testing.T) {
+	p := newTestProvider(t, `cat > /dev/null`, 0)
+	payload := &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "A.example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.1"}}
+	if err := p.Create(context.Background(), payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Id != "a.example.com/A/10.0.0.1" {
+		t.Fatalf("unexpected default id %q", payload.Id)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	payload := &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "a.example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.1"}}
+
+	err := newTestProvider(t, `echo "zone not found" >&2; exit 3`, 0).Create(context.Background(), payload)
+	exitErr := &ExitError{}
+	if !errors.As(err, &exitErr) || exitErr.Code != 3 || exitErr.Stderr != "zone not found" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	err = newTestProvider(t, `sleep 5`, 100*time.Millisecond).Create(context.Background(), payload)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+
+	err = newTestProvider(t, `echo not json`, 0).Create(context.Background(), payload)
+	if err == nil {
+		t.Fatal("expected an error for an invalid output")
+	}
+}
+
+func TestCheckCommand(t *testing.T) {
+	clusterProvider := &dnsv1.ClusterProvider{}
+	namespacedProvider := &dnsv1.Provider{ObjectMeta: metav1.ObjectMeta{Namespace: "team"}}
+	tests := []struct {
+		name     string
+		provider dnsv1.ProviderObject
+		allowed  []string
+		command  string
+		wants    bool
+	}{
+		{name: "cluster provider", provider: clusterProvider, command: "sh", wants: true},
+		{name: "namespaced provider", provider: namespacedProvider, command: "sh"},
+		{name: "allowed for namespaced provider", provider: namespacedProvider, allowed: []string{"/scripts/nsupdate.sh"}, command: "/scripts/nsupdate.sh", wants: true},
+		{name: "not allowed for namespaced provider", provider: namespacedProvider, allowed: []string{"/scripts/nsupdate.sh"}, command: "sh"},
+		{name: "not allowed for cluster provider", provider: clusterProvider, allowed: []string{"/scripts/nsupdate.sh"}, command: "sh"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			AllowedCommands = tt.allowed
+			defer func() { AllowedCommands = nil }()
+			err := checkCommand(tt.provider, tt.command)
+			if tt.wants && err != nil {
+				t.Fatalf("expected the command to be allowed, got %v", err)
+			}
+			if !tt.wants && !errors.Is(err, ErrCommandNotAllowed) {
+				t.Fatalf("expected ErrCommandNotAllowed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMinimalEnvironment(t *testing.T) {
+	t.Setenv("MANAGER_SECRET", "secret")
+	p := newTestProvider(t, `printf '{"id": "%s-%s"}' "$MANAGER_SECRET" "$PREFIX"`, 0)
+	payload := &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "a.example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.1"}}
+	if err := p.Create(context.Background(), payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Id != "-rec" {
+		t.Fatalf("expected only the configured environment, got %q", payload.Id)
+	}
+}
@@ -3,9 +3,11 @@ package job
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"text/template"
 
@@ -13,44 +15,249 @@ import (
 	"github.com/xzzpig/kube-dns-manager/internal/controller/dns"
 	"github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider"
 	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/yaml"
 )
 
 var (
-	ErrClientNotFound  = errors.New("client not found in context")
-	ErrClientNotClient = errors.New("client is not a client.Client")
+	ErrClientNotFound  = provider.ErrClientNotFound
+	ErrClientNotClient = provider.ErrClientNotClient
 	ErrJobRunning      = errors.New("job is running")
+	// ErrJobGaveUp is returned instead of creating a Job for an action whose retries are exhausted
+	ErrJobGaveUp = errors.New("job retries exhausted")
+	// ErrJobResultLost is returned if the referenced Job was deleted before its result was recorded,
+	// e.g. by ttlSecondsAfterFinished. The action is not run again, as for ErrJobGaveUp
+	ErrJobResultLost = errors.New("job result lost")
 )
 
-const LabelAction = "dns.xzzpig.com/action"
+const (
+	LabelAction = provider.LabelJobAction
+	// LabelRecord and LabelRecordNamespace link the Job to the Record it was created for,
+	// LabelRecord is omitted if the name of the Record is not a valid label value
+	LabelRecord          = provider.LabelJobRecord
+	LabelRecordNamespace = provider.LabelJobRecordNamespace
+	// AnnotationRecord holds the namespace/name of the Record the Job was created for
+	AnnotationRecord = provider.AnnotationJobRecord
+	// AnnotationAttempt holds the number of the retries before the Job
+	AnnotationAttempt = "dns.xzzpig.com/attempt"
+	// AnnotationFailures is set on the Record to the actions the JOB providers gave up on, keyed by the provider.
+	// The action is not retried until the Record changes or the annotation is removed
+	AnnotationFailures = "dns.xzzpig.com/job-failures"
+
+	DefaultMaxOutputBytes = 4096
+
+	// Running Jobs are referenced as job:<namespace>/<name>;<record id> if OutputAsID is enabled
+	jobIDPrefix = "job:"
+)
 
 type JobProvider struct {
+	// namespace/name of the provider, the key of its failures in AnnotationFailures
+	name               string
 	namespace          string
 	createTemplate     *template.Template
 	updateTemplate     *template.Template
 	deleteTemplate     *template.Template
 	dataTemplate       *template.Template
 	dataUpdateStrategy dnsv1.DataUpdateStrategy
+	captureLogs        bool
+	maxOutputBytes     int
+	outputAsID         bool
+	maxRetries         int
+	// injected into Jobs which do not set it
+	ttlSecondsAfterFinished *int32
 }
 
 type JobExecutePayload struct {
 	*provider.DnsProviderPayload
 	Action string
+	// ID of the record from the output of the last completed Job, only set if OutputAsID is enabled
+	RecordID string
+	// Termination message of the finished Pod
+	Output string
+	// Logs of the finished Pod, only set if CaptureLogs is enabled
+	Logs string
+}
+
+// jobFailure is an action a provider gave up on after its retries failed
+type jobFailure struct {
+	Action string `json:"action"`
+	// Generation of the Record the action failed for
+	Generation int64  `json:"generation"`
+	Attempts   int    `json:"attempts"`
+	Message    string `json:"message,omitempty"`
 }
 
 func getClient(ctx context.Context) (client.Client, error) {
-	c := ctx.Value(provider.CtxKeyClient)
-	if c == nil {
-		return nil, ErrClientNotFound
+	return provider.GetClient(ctx)
+}
+
+func getFailures(record *dnsv1.Record) map[string]jobFailure {
+	failures := make(map[string]jobFailure)
+	if data := record.Annotations[AnnotationFailures]; data != "" {
+		// an invalid annotation is replaced by the next failure
+		_ = json.Unmarshal([]byte(data), &failures)
+	}
+	return failures
+}
+
+// gaveUp returns the failure of the action if the provider gave up on it for the current generation of the Record
+func (p *JobProvider) gaveUp(record *dnsv1.Record, action string) *jobFailure {
+	if record == nil {
+		return nil
+	}
+	failure, ok := getFailures(record)[p.name]
+	if !ok || failure.Action != action || failure.Generation != record.Generation {
+		return nil
+	}
+	return &failure
+}
+
+// setFailure persists the failure of the provider in the annotations of the Record, nil removes it.
+// Only the metadata is copied back into record, the status being reconciled must not be replaced
+func (p *JobProvider) setFailure(ctx context.Context, cli client.Client, record *dnsv1.Record, failure *jobFailure) error {
+	if record == nil || record.UID == "" {
+		return nil
+	}
+	failures := getFailures(record)
+	if _, ok := failures[p.name]; !ok && failure == nil {
+		return nil
+	}
+	if failure != nil {
+		failures[p.name] = *failure
+	} else {
+		delete(failures, p.name)
 	}
-	if client, ok := c.(client.Client); ok {
-		return client, nil
+
+	patched := record.DeepCopy()
+	if len(failures) == 0 {
+		delete(patched.Annotations, AnnotationFailures)
 	} else {
-		return nil, ErrClientNotClient
+		data, err := json.Marshal(failures)
+		if err != nil {
+			return err
+		}
+		if patched.Annotations == nil {
+			patched.Annotations = make(map[string]string)
+		}
+		patched.Annotations[AnnotationFailures] = string(data)
+	}
+	if err := cli.Patch(ctx, patched, client.MergeFrom(record)); err != nil {
+		return err
+	}
+	record.Annotations = patched.Annotations
+	record.ResourceVersion = patched.ResourceVersion
+	return nil
+}
+
+// parseID returns the running Job and the record ID referenced by the ID of the payload
+func (p *JobProvider) parseID(id string) (job *types.NamespacedName, recordID string) {
+	if !p.outputAsID {
+		if namespace, name, ok := strings.Cut(id, string(types.Separator)); ok {
+			return &types.NamespacedName{Namespace: namespace, Name: name}, ""
+		}
+		return nil, ""
+	}
+	if !strings.HasPrefix(id, jobIDPrefix) {
+		return nil, id
+	}
+	ref, recordID, _ := strings.Cut(strings.TrimPrefix(id, jobIDPrefix), ";")
+	namespace, name, _ := strings.Cut(ref, string(types.Separator))
+	return &types.NamespacedName{Namespace: namespace, Name: name}, recordID
+}
+
+// formatID returns the ID of the payload referencing the running Job
+func (p *JobProvider) formatID(job *batchv1.Job, recordID string) string {
+	ref := (&dnsv1.NamespacedName{Namespace: job.Namespace, Name: job.Name}).String()
+	if !p.outputAsID {
+		return ref
+	}
+	return jobIDPrefix + ref + ";" + recordID
+}
+
+func (p *JobProvider) truncate(s string) string {
+	if len(s) > p.maxOutputBytes {
+		return s[:p.maxOutputBytes]
+	}
+	return s
+}
+
+// captureOutput reads the termination message and, if enabled, the logs of the finished Pod of the Job
+func (p *JobProvider) captureOutput(ctx context.Context, cli client.Client, job *batchv1.Job, payload *JobExecutePayload) error {
+	if job.Spec.Selector == nil {
+		return nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(job.Spec.Selector)
+	if err != nil {
+		return err
+	}
+	podList := &corev1.PodList{}
+	if err := cli.List(ctx, podList, client.InNamespace(job.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return err
+	}
+
+	// prefer the succeeded Pod, then the latest one
+	var pod *corev1.Pod
+	for i := range podList.Items {
+		candidate := &podList.Items[i]
+		if pod == nil {
+			pod = candidate
+		} else if succeeded := candidate.Status.Phase == corev1.PodSucceeded; succeeded != (pod.Status.Phase == corev1.PodSucceeded) {
+			if succeeded {
+				pod = candidate
+			}
+		} else if pod.CreationTimestamp.Before(&candidate.CreationTimestamp) {
+			pod = candidate
+		}
+	}
+	if pod == nil {
+		return nil
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Terminated != nil && status.State.Terminated.Message != "" {
+			payload.Output = p.truncate(strings.TrimSpace(status.State.Terminated.Message))
+			break
+		}
+	}
+	if p.captureLogs {
+		clientset, err := provider.GetClientset(ctx)
+		if err != nil {
+			return err
+		}
+		limit := int64(p.maxOutputBytes)
+		logs, err := clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{LimitBytes: &limit}).DoRaw(ctx)
+		if err != nil {
+			return err
+		}
+		payload.Logs = p.truncate(string(logs))
+	}
+	return nil
+}
+
+// findCondition returns the condition of the given type if it is true
+func findCondition(job *batchv1.Job, conditionType batchv1.JobConditionType) *batchv1.JobCondition {
+	for i := range job.Status.Conditions {
+		if job.Status.Conditions[i].Type == conditionType && job.Status.Conditions[i].Status == corev1.ConditionTrue {
+			return &job.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+func (p *JobProvider) templateFor(action string) *template.Template {
+	switch action {
+	case "update":
+		return p.updateTemplate
+	case "delete":
+		return p.deleteTemplate
 	}
+	return p.createTemplate
 }
 
 func (p *JobProvider) executeJob(ctx context.Context, tpl *template.Template, payload *JobExecutePayload) (err error) {
@@ -59,21 +266,22 @@ func (p *JobProvider) executeJob(ctx context.Context, tpl *template.Template, pa
 		return err
 	}
 
-	if payload.Id != "" {
-		namespacedName := strings.Split(payload.Id, string(types.Separator))
+	jobKey, recordID := p.parseID(payload.Id)
+	payload.RecordID = recordID
+	if jobKey != nil {
 		job := batchv1.Job{}
-		err := cli.Get(ctx, types.NamespacedName{Namespace: namespacedName[0], Name: namespacedName[1]}, &job)
-		if err != nil {
-			if client.IgnoreNotFound(err) != nil {
-				return err
-			}
+		err := cli.Get(ctx, *jobKey, &job)
+		if apierrors.IsNotFound(err) {
+			return p.resultLost(ctx, cli, jobKey, payload)
+		} else if err != nil {
+			return err
 		} else {
-			// check job status
-			if len(job.Status.Conditions) == 0 {
-				return ErrJobRunning
-			}
-			if job.Status.Conditions[0].Type == "Complete" && job.Status.Conditions[0].Status == "True" {
-				backgroundDeletion := metav1.DeletePropagationBackground
+			backgroundDeletion := metav1.DeletePropagationBackground
+			// newer Kubernetes versions add SuccessCriteriaMet/FailureTarget before the final condition
+			if findCondition(&job, batchv1.JobComplete) != nil {
+				if err := p.captureOutput(ctx, cli, &job, payload); err != nil {
+					return err
+				}
 				if p.dataUpdateStrategy == dnsv1.DataUpdateStratagyOnComplete || p.dataUpdateStrategy == dnsv1.DataUpdateStratagyOnCompleteOrFailed {
 					buffer := new(bytes.Buffer)
 					if err := p.dataTemplate.Execute(buffer, payload); err != nil {
@@ -85,11 +293,23 @@ func (p *JobProvider) executeJob(ctx context.Context, tpl *template.Template, pa
 						}
 					}()
 				}
-				if err := cli.Delete(ctx, &job, &client.DeleteOptions{PropagationPolicy: &backgroundDeletion}); err != nil {
+				if err := cli.Delete(ctx, &job, &client.DeleteOptions{PropagationPolicy: &backgroundDeletion}); client.IgnoreNotFound(err) != nil {
 					return err
 				}
+				if err := p.setFailure(ctx, cli, payload.Object, nil); err != nil {
+					return err
+				}
+				if p.outputAsID && payload.Action != "delete" {
+					payload.Id = payload.Output
+					if payload.Id == "" {
+						return fmt.Errorf("job %s completed without an output to use as the record id", job.Name)
+					}
+				}
 				return nil
-			} else if job.Status.Conditions[0].Type == "Failed" && job.Status.Conditions[0].Status == "True" {
+			} else if failed := findCondition(&job, batchv1.JobFailed); failed != nil {
+				if err := p.captureOutput(ctx, cli, &job, payload); err != nil {
+					return err
+				}
 				if p.dataUpdateStrategy == dnsv1.DataUpdateStratagyOnCompleteOrFailed {
 					buffer := new(bytes.Buffer)
 					if err := p.dataTemplate.Execute(buffer, payload); err != nil {
@@ -97,16 +317,63 @@ func (p *JobProvider) executeJob(ctx context.Context, tpl *template.Template, pa
 					}
 					payload.Data = buffer.String()
 				}
-				if job.Labels[LabelAction] == "create" {
+				if err := cli.Delete(ctx, &job, &client.DeleteOptions{PropagationPolicy: &backgroundDeletion}); client.IgnoreNotFound(err) != nil {
+					return err
+				}
+
+				action := job.Labels[LabelAction]
+				attempt, _ := strconv.Atoi(job.Annotations[AnnotationAttempt])
+				if attempt < p.maxRetries {
+					payload.Action = action
+					return p.createJob(ctx, cli, p.templateFor(action), payload, attempt+1)
+				}
+				if action == "create" {
 					payload.Id = ""
+				} else if p.outputAsID {
+					payload.Id = recordID
+				}
+				// the attempts of the Job are lost with it, persist them so the next reconcile does not start over
+				failure := &jobFailure{Action: action, Attempts: attempt + 1, Message: fmt.Sprintf("%s: %s", failed.Reason, failed.Message)}
+				if payload.Object != nil {
+					failure.Generation = payload.Object.Generation
 				}
-				return fmt.Errorf("job failed, %s: %s", job.Status.Conditions[0].Reason, job.Status.Conditions[0].Message)
+				if err := p.setFailure(ctx, cli, payload.Object, failure); err != nil {
+					return err
+				}
+				return fmt.Errorf("job failed after %d attempts, %s", failure.Attempts, failure.Message)
 			} else {
 				return ErrJobRunning
 			}
 		}
 	}
 
+	if failure := p.gaveUp(payload.Object, payload.Action); failure != nil {
+		return fmt.Errorf("%w: %s failed after %d attempts, %s, change the Record or remove its annotation %s to retry",
+			ErrJobGaveUp, failure.Action, failure.Attempts, failure.Message, AnnotationFailures)
+	}
+	return p.createJob(ctx, cli, tpl, payload, 0)
+}
+
+// resultLost reports the referenced Job as deleted before its result was recorded.
+// Running the action again may apply it twice, so the provider gives up on it until the Record changes
+func (p *JobProvider) resultLost(ctx context.Context, cli client.Client, jobKey *types.NamespacedName, payload *JobExecutePayload) error {
+	if payload.Action == "create" {
+		payload.Id = ""
+	} else if p.outputAsID {
+		payload.Id = payload.RecordID
+	}
+	failure := &jobFailure{Action: payload.Action, Attempts: 1, Message: fmt.Sprintf("job %s was deleted before its result was recorded", jobKey)}
+	if payload.Object != nil {
+		failure.Generation = payload.Object.Generation
+	}
+	if err := p.setFailure(ctx, cli, payload.Object, failure); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s", ErrJobResultLost, failure.Message)
+}
+
+// createJob creates the Job of the action and references it by the ID of the payload, it returns ErrJobRunning on success
+func (p *JobProvider) createJob(ctx context.Context, cli client.Client, tpl *template.Template, payload *JobExecutePayload, attempt int) error {
 	buffer := new(bytes.Buffer)
 	if err := tpl.Execute(buffer, payload); err != nil {
 		return err
@@ -127,6 +394,25 @@ func (p *JobProvider) executeJob(ctx context.Context, tpl *template.Template, pa
 		job.Labels = make(map[string]string)
 	}
 	job.Labels[LabelAction] = payload.Action
+	if job.Annotations == nil {
+		job.Annotations = make(map[string]string)
+	}
+	job.Annotations[AnnotationAttempt] = strconv.Itoa(attempt)
+	if record := payload.Object; record != nil {
+		job.Annotations[AnnotationRecord] = record.Namespace + string(types.Separator) + record.Name
+		if len(validation.IsValidLabelValue(record.Name)) == 0 {
+			job.Labels[LabelRecord] = record.Name
+		}
+		job.Labels[LabelRecordNamespace] = record.Namespace
+		if record.Namespace == job.Namespace && record.UID != "" {
+			if err := controllerutil.SetOwnerReference(record, &job, cli.Scheme()); err != nil {
+				return err
+			}
+		}
+	}
+	if job.Spec.TTLSecondsAfterFinished == nil {
+		job.Spec.TTLSecondsAfterFinished = p.ttlSecondsAfterFinished
+	}
 
 	if p.dataUpdateStrategy == dnsv1.DataUpdateStrategyOnCreate {
 		buffer = new(bytes.Buffer)
@@ -143,20 +429,20 @@ func (p *JobProvider) executeJob(ctx context.Context, tpl *template.Template, pa
 		payload.Data = buffer.String()
 	}
 
-	payload.Id = (&dnsv1.NamespacedName{Namespace: job.Namespace, Name: job.Name}).String()
+	payload.Id = p.formatID(&job, payload.RecordID)
 	return ErrJobRunning
 }
 
 func (p *JobProvider) Create(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
-	return p.executeJob(ctx, p.createTemplate, &JobExecutePayload{payload, "create"})
+	return p.executeJob(ctx, p.createTemplate, &JobExecutePayload{DnsProviderPayload: payload, Action: "create"})
 }
 
 func (p *JobProvider) Update(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
-	return p.executeJob(ctx, p.updateTemplate, &JobExecutePayload{payload, "update"})
+	return p.executeJob(ctx, p.updateTemplate, &JobExecutePayload{DnsProviderPayload: payload, Action: "update"})
 }
 
 func (p *JobProvider) Delete(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
-	if err := p.executeJob(ctx, p.deleteTemplate, &JobExecutePayload{payload, "delete"}); err != nil {
+	if err := p.executeJob(ctx, p.deleteTemplate, &JobExecutePayload{DnsProviderPayload: payload, Action: "delete"}); err != nil {
 		return err
 	} else {
 		payload.Id = ""
@@ -169,8 +455,17 @@ func init() {
 	provider.Register(dnsv1.ProviderTypeJob, func(ctx context.Context, provider dnsv1.ProviderObject) (provider.DNSProvider, error) {
 		spec := provider.GetSpec()
 		p := new(JobProvider)
+		p.name = (&dnsv1.NamespacedName{Namespace: provider.GetNamespace(), Name: provider.GetName()}).String()
 		p.namespace = provider.GetNamespace()
 		p.dataUpdateStrategy = spec.Job.DataUpdateStrategy
+		p.captureLogs = spec.Job.CaptureLogs
+		p.maxOutputBytes = spec.Job.MaxOutputBytes
+		if p.maxOutputBytes <= 0 {
+			p.maxOutputBytes = DefaultMaxOutputBytes
+		}
+		p.outputAsID = spec.Job.OutputAsID
+		p.maxRetries = spec.Job.MaxRetries
+		p.ttlSecondsAfterFinished = spec.Job.TTLSecondsAfterFinished
 
 		tpl := dns.NewTemplate(provider.GetName())
 		if createTpl, err := tpl.New("create").Parse(string(spec.Job.CreateJobTemplate)); err != nil {
@@ -200,5 +495,5 @@ func init() {
 			}
 		}
 		return p, nil
-	})
+	}, dnsv1.ProviderCapabilities{})
 }
@@ -0,0 +1,279 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+	"github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider"
+)
+
+const jobTemplate = `
+metadata:
+  name: kdm-{{ .Action }}
+  namespace: default
+  annotations:
+    record-id: "{{ .RecordID }}"
+spec:
+  template:
+    spec:
+      restartPolicy: Never
+      containers:
+      - name: main
+        image: busybox
+`
+
+func newTestClient(t *testing.T) (client.Client, context.Context) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := dnsv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	cli := fake.NewClientBuilder().WithScheme(scheme).Build()
+	return cli, context.WithValue(context.Background(), provider.CtxKeyClient, cli)
+}
+
+func setConditions(t *testing.T, ctx context.Context, cli client.Client, name string, conditions ...batchv1.JobConditionType) *batchv1.Job {
+	job := &batchv1.Job{}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, job); err != nil {
+		t.Fatal(err)
+	}
+	job.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"job-name": name}}
+	if err := cli.Update(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	for _, condition := range conditions {
+		job.Status.Conditions = append(job.Status.Conditions, batchv1.JobCondition{Type: condition, Status: corev1.ConditionTrue})
+	}
+	if err := cli.Status().Update(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+// finishJob marks the Job complete and adds its Pod with the termination message
+func finishJob(t *testing.T, ctx context.Context, cli client.Client, name string, message string) {
+	setConditions(t, ctx, cli, name, batchv1.JobSuccessCriteriaMet, batchv1.JobComplete)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name + "-pod", Labels: map[string]string{"job-name": name}},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodSucceeded,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "main",
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: message}},
+			}},
+		},
+	}
+	if err := cli.Create(ctx, pod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOutputAsID(t *testing.T) {
+	cli, ctx := newTestClient(t)
+	p, err := provider.New(ctx, &dnsv1.ClusterProvider{Spec: dnsv1.ProviderSpec{
+		Type: dnsv1.ProviderTypeJob,
+		Job: &dnsv1.JobProviderConfig{
+			CreateJobTemplate:  jobTemplate,
+			DataTemplate:       "{{ .Output }}",
+			DataUpdateStrategy: dnsv1.DataUpdateStratagyOnComplete,
+			OutputAsID:         true,
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "a.example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.1"}}
+	if err := p.Create(ctx, payload); !errors.Is(err, ErrJobRunning) {
+		t.Fatalf("expected ErrJobRunning, got %v", err)
+	}
+	if payload.Id != "job:default/kdm-create;" {
+		t.Fatalf("unexpected id of the running job %q", payload.Id)
+	}
+	if err := p.Create(ctx, payload); !errors.Is(err, ErrJobRunning) {
+		t.Fatalf("expected ErrJobRunning while the job is running, got %v", err)
+	}
+
+	finishJob(t, ctx, cli, "kdm-create", "  record-123\n")
+	if err := p.Create(ctx, payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Id != "record-123" || payload.Data != "record-123" {
+		t.Fatalf("unexpected id %q and data %q", payload.Id, payload.Data)
+	}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: "default", Name: "kdm-create"}, &batchv1.Job{}); err == nil {
+		t.Fatal("completed job not deleted")
+	}
+
+	if err := p.Update(ctx, payload); !errors.Is(err, ErrJobRunning) {
+		t.Fatalf("expected ErrJobRunning, got %v", err)
+	}
+	if payload.Id != "job:default/kdm-update;record-123" {
+		t.Fatalf("unexpected id of the running job %q", payload.Id)
+	}
+	job := &batchv1.Job{}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: "default", Name: "kdm-update"}, job); err != nil {
+		t.Fatal(err)
+	}
+	if job.Annotations["record-id"] != "record-123" {
+		t.Fatalf("record id not passed to the update job: %v", job.Annotations)
+	}
+}
+
+func TestCompletedWithoutOutput(t *testing.T) {
+	cli, ctx := newTestClient(t)
+	p, err := provider.New(ctx, &dnsv1.ClusterProvider{Spec: dnsv1.ProviderSpec{
+		Type: dnsv1.ProviderTypeJob,
+		Job:  &dnsv1.JobProviderConfig{CreateJobTemplate: jobTemplate, OutputAsID: true},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "a.example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.1"}}
+	if err := p.Create(ctx, payload); !errors.Is(err, ErrJobRunning) {
+		t.Fatalf("expected ErrJobRunning, got %v", err)
+	}
+	finishJob(t, ctx, cli, "kdm-create", "")
+	if err := p.Create(ctx, payload); err == nil || payload.Id != "" {
+		t.Fatalf("expected an error and an empty id, got %v and %q", err, payload.Id)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	cli, ctx := newTestClient(t)
+	ttl := int32(600)
+	p, err := provider.New(ctx, &dnsv1.ClusterProvider{Spec: dnsv1.ProviderSpec{
+		Type: dnsv1.ProviderTypeJob,
+		Job:  &dnsv1.JobProviderConfig{CreateJobTemplate: jobTemplate, MaxRetries: 1, TTLSecondsAfterFinished: &ttl},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record := &dnsv1.Record{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "www", UID: "uid", Generation: 1}}
+	if err := cli.Create(ctx, record); err != nil {
+		t.Fatal(err)
+	}
+	payload := &provider.DnsProviderPayload{Record: &record.Spec, Object: record}
+	if err := p.Create(ctx, payload); !errors.Is(err, ErrJobRunning) {
+		t.Fatalf("expected ErrJobRunning, got %v", err)
+	}
+	job := setConditions(t, ctx, cli, "kdm-create", batchv1.JobFailureTarget)
+	if job.Labels[LabelRecord] != "www" || job.Labels[LabelRecordNamespace] != "default" || len(job.OwnerReferences) != 1 {
+		t.Fatalf("job not linked to the record: %v %v", job.Labels, job.OwnerReferences)
+	}
+	if job.Spec.TTLSecondsAfterFinished == nil || *job.Spec.TTLSecondsAfterFinished != ttl {
+		t.Fatal("ttlSecondsAfterFinished not injected")
+	}
+	if err := p.Update(ctx, payload); !errors.Is(err, ErrJobRunning) {
+		t.Fatalf("expected ErrJobRunning until the job failed, got %v", err)
+	}
+
+	// the first failure is retried with a new job
+	setConditions(t, ctx, cli, "kdm-create", batchv1.JobFailed)
+	if err := p.Update(ctx, payload); !errors.Is(err, ErrJobRunning) {
+		t.Fatalf("expected the failed job to be retried, got %v", err)
+	}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: "default", Name: "kdm-create"}, job); err != nil {
+		t.Fatal(err)
+	}
+	if job.Annotations[AnnotationAttempt] != "1" || job.Labels[LabelAction] != "create" {
+		t.Fatalf("unexpected retry job %v %v", job.Labels, job.Annotations)
+	}
+
+	// the failure of the last retry is reported and the job cleaned up
+	setConditions(t, ctx, cli, "kdm-create", batchv1.JobFailed)
+	if err := p.Update(ctx, payload); err == nil || errors.Is(err, ErrJobRunning) {
+		t.Fatalf("expected the failure to be reported, got %v", err)
+	}
+	if payload.Id != "" {
+		t.Fatalf("expected the id of a failed create to be reset, got %q", payload.Id)
+	}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: "default", Name: "kdm-create"}, job); err == nil {
+		t.Fatal("failed job not deleted")
+	}
+
+	// the provider gives up until the Record changes
+	if record.Annotations[AnnotationFailures] == "" {
+		t.Fatal("failure not persisted in the record")
+	}
+	stored := &dnsv1.Record{}
+	if err := cli.Get(ctx, client.ObjectKeyFromObject(record), stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Annotations[AnnotationFailures] != record.Annotations[AnnotationFailures] || stored.ResourceVersion != record.ResourceVersion {
+		t.Fatalf("failure not patched into the stored record: %v", stored.Annotations)
+	}
+	for i := 0; i < 2; i++ {
+		if err := p.Create(ctx, payload); !errors.Is(err, ErrJobGaveUp) {
+			t.Fatalf("expected ErrJobGaveUp, got %v", err)
+		}
+	}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: "default", Name: "kdm-create"}, job); err == nil {
+		t.Fatal("job created after giving up")
+	}
+
+	record.Generation++
+	if err := p.Create(ctx, payload); !errors.Is(err, ErrJobRunning) {
+		t.Fatalf("expected a new job for the changed record, got %v", err)
+	}
+	finishJob(t, ctx, cli, "kdm-create", "")
+	if err := p.Create(ctx, payload); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := record.Annotations[AnnotationFailures]; ok {
+		t.Fatalf("failure not cleared after the job completed: %v", record.Annotations)
+	}
+}
+
+func TestResultLost(t *testing.T) {
+	cli, ctx := newTestClient(t)
+	p, err := provider.New(ctx, &dnsv1.ClusterProvider{Spec: dnsv1.ProviderSpec{
+		Type: dnsv1.ProviderTypeJob,
+		Job:  &dnsv1.JobProviderConfig{CreateJobTemplate: jobTemplate, OutputAsID: true},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record := &dnsv1.Record{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "www", UID: "uid", Generation: 1}}
+	if err := cli.Create(ctx, record); err != nil {
+		t.Fatal(err)
+	}
+	payload := &provider.DnsProviderPayload{Record: &record.Spec, Object: record, Id: "record-123"}
+	if err := p.Update(ctx, payload); !errors.Is(err, ErrJobRunning) {
+		t.Fatalf("expected ErrJobRunning, got %v", err)
+	}
+
+	// the finished Job is deleted by its TTL before the provider recorded its result
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "kdm-update"}}
+	if err := cli.Delete(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Update(ctx, payload); !errors.Is(err, ErrJobResultLost) {
+		t.Fatalf("expected ErrJobResultLost, got %v", err)
+	}
+	if payload.Id != "record-123" {
+		t.Fatalf("expected the record id to be kept, got %q", payload.Id)
+	}
+	if err := cli.Get(ctx, client.ObjectKeyFromObject(job), job); err == nil {
+		t.Fatal("job recreated after its result was lost")
+	}
+	if err := p.Update(ctx, payload); !errors.Is(err, ErrJobGaveUp) {
+		t.Fatalf("expected the provider to give up on the action, got %v", err)
+	}
+}
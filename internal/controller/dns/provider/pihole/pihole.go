@@ -0,0 +1,380 @@
+package pihole
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+	"github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider"
+)
+
+var ErrRequestFailed = errors.New("request failed")
+
+const requestTimeout = 30 * time.Second
+
+// PiholeRecord is a Local DNS record (A/AAAA) or a CNAME record of Pi-hole
+type PiholeRecord struct {
+	Type   dnsv1.RecordType `json:"type"`
+	Domain string           `json:"domain"`
+	Value  string           `json:"value"`
+}
+
+// piholeAPI is implemented by the REST API of Pi-hole v6 and the legacy admin/api.php of Pi-hole v5
+type piholeAPI interface {
+	list(ctx context.Context) ([]PiholeRecord, error)
+	add(ctx context.Context, record *PiholeRecord) error
+	remove(ctx context.Context, record *PiholeRecord) error
+}
+
+type PiholeProvider struct {
+	api piholeAPI
+}
+
+func (p *PiholeProvider) find(ctx context.Context, record *PiholeRecord) (bool, error) {
+	records, err := p.api.list(ctx)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(records, *record), nil
+}
+
+// Create adds the entry of the record, an identical existing entry is adopted as AdGuard rewrites are,
+// so a retry after the id of an added entry was lost does not fail forever
+func (p *PiholeProvider) Create(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
+	record := PiholeRecord{Type: payload.Record.Type, Domain: payload.Record.Name, Value: payload.Record.Value}
+	id, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if exists, err := p.find(ctx, &record); err != nil {
+		return err
+	} else if !exists {
+		if err := p.api.add(ctx, &record); err != nil {
+			return err
+		}
+	}
+	payload.Id = string(id)
+	return nil
+}
+
+func (p *PiholeProvider) Update(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
+	if payload.Id != "" {
+		oldRecord := PiholeRecord{}
+		if err := json.Unmarshal([]byte(payload.Id), &oldRecord); err != nil {
+			return err
+		}
+		if oldRecord == (PiholeRecord{Type: payload.Record.Type, Domain: payload.Record.Name, Value: payload.Record.Value}) {
+			return nil
+		}
+		if err := p.api.remove(ctx, &oldRecord); err != nil {
+			return err
+		}
+	}
+	return p.Create(ctx, payload)
+}
+
+func (p *PiholeProvider) Delete(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
+	record := PiholeRecord{Type: payload.Record.Type, Domain: payload.Record.Name, Value: payload.Record.Value}
+	if payload.Id != "" {
+		if err := json.Unmarshal([]byte(payload.Id), &record); err != nil {
+			return err
+		}
+	}
+	if exists, err := p.find(ctx, &record); err != nil {
+		return err
+	} else if exists {
+		if err := p.api.remove(ctx, &record); err != nil {
+			return err
+		}
+	}
+	payload.Id = ""
+	payload.Data = ""
+	return nil
+}
+
+func (p *PiholeProvider) HealthCheck(ctx context.Context) error {
+	_, err := p.api.list(ctx)
+	return err
+}
+
+// Close logs out of the session of the REST API of Pi-hole v6, which otherwise occupies a seat until it expires
+func (p *PiholeProvider) Close() error {
+	if closer, ok := p.api.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// sessionAPI uses the REST API of Pi-hole v6, authenticated by a session opened with the password
+type sessionAPI struct {
+	url      url.URL
+	password string
+	client   *http.Client
+
+	mu  sync.Mutex
+	sid string
+}
+
+func (a *sessionAPI) login(ctx context.Context) error {
+	body, err := json.Marshal(map[string]string{"password": a.password})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url.JoinPath("api", "auth").String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	result := struct {
+		Session struct {
+			Valid bool   `json:"valid"`
+			Sid   string `json:"sid"`
+		} `json:"session"`
+	}{}
+	if err := doJSON(a.client, req, &result); err != nil {
+		return err
+	}
+	if !result.Session.Valid {
+		return fmt.Errorf("%w: invalid password", provider.ErrUnauthenticated)
+	}
+	a.sid = result.Session.Sid
+	return nil
+}
+
+// do sends the request with the session id, logging in again once if the session is missing or expired
+func (a *sessionAPI) do(ctx context.Context, method string, out any, elem ...string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for retry := 0; ; retry++ {
+		if a.sid == "" && a.password != "" {
+			if err := a.login(ctx); err != nil {
+				return err
+			}
+		}
+		req, err := http.NewRequestWithContext(ctx, method, a.url.JoinPath(append([]string{"api"}, elem...)...).String(), nil)
+		if err != nil {
+			return err
+		}
+		if a.sid != "" {
+			req.Header.Set("X-FTL-SID", a.sid)
+		}
+		err = doJSON(a.client, req, out)
+		if errors.Is(err, provider.ErrUnauthenticated) && retry == 0 && a.password != "" {
+			a.sid = ""
+			continue
+		}
+		return err
+	}
+}
+
+// Close deletes the session if one is open
+func (a *sessionAPI) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.sid == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, a.url.JoinPath("api", "auth").String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-FTL-SID", a.sid)
+	a.sid = ""
+	err = doJSON(a.client, req, nil)
+	if errors.Is(err, provider.ErrUnauthenticated) {
+		// the session has expired already
+		return nil
+	}
+	return err
+}
+
+func (a *sessionAPI) list(ctx context.Context) ([]PiholeRecord, error) {
+	result := struct {
+		Config struct {
+			DNS struct {
+				Hosts        []string `json:"hosts"`
+				CnameRecords []string `json:"cnameRecords"`
+			} `json:"dns"`
+		} `json:"config"`
+	}{}
+	if err := a.do(ctx, http.MethodGet, &result, "config", "dns"); err != nil {
+		return nil, err
+	}
+	records := make([]PiholeRecord, 0, len(result.Config.DNS.Hosts)+len(result.Config.DNS.CnameRecords))
+	for _, host := range result.Config.DNS.Hosts {
+		fields := strings.Fields(host)
+		if len(fields) < 2 {
+			continue
+		}
+		recordType := dnsv1.RecordTypeA
+		if strings.Contains(fields[0], ":") {
+			recordType = dnsv1.RecordTypeAAAA
+		}
+		for _, domain := range fields[1:] {
+			records = append(records, PiholeRecord{Type: recordType, Domain: domain, Value: fields[0]})
+		}
+	}
+	for _, cname := range result.Config.DNS.CnameRecords {
+		fields := strings.Split(cname, ",")
+		if len(fields) < 2 {
+			continue
+		}
+		records = append(records, PiholeRecord{Type: dnsv1.RecordTypeCNAME, Domain: fields[0], Value: fields[1]})
+	}
+	return records, nil
+}
+
+func (a *sessionAPI) item(record *PiholeRecord) []string {
+	if record.Type == dnsv1.RecordTypeCNAME {
+		return []string{"config", "dns", "cnameRecords", record.Domain + "," + record.Value}
+	}
+	return []string{"config", "dns", "hosts", record.Value + " " + record.Domain}
+}
+
+func (a *sessionAPI) add(ctx context.Context, record *PiholeRecord) error {
+	return a.do(ctx, http.MethodPut, nil, a.item(record)...)
+}
+
+func (a *sessionAPI) remove(ctx context.Context, record *PiholeRecord) error {
+	return a.do(ctx, http.MethodDelete, nil, a.item(record)...)
+}
+
+// tokenAPI uses the legacy admin/api.php of Pi-hole v5, authenticated by the API token
+type tokenAPI struct {
+	url    url.URL
+	token  string
+	client *http.Client
+}
+
+func (a *tokenAPI) do(ctx context.Context, out any, query url.Values) error {
+	u := a.url.JoinPath("admin", "api.php")
+	query.Set("auth", a.token)
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	body := json.RawMessage{}
+	if err := doJSON(a.client, req, &body); err != nil {
+		return err
+	}
+	// api.php answers an invalid token with an empty array instead of an error status
+	if string(bytes.TrimSpace(body)) == "[]" {
+		return fmt.Errorf("%w: invalid token", provider.ErrUnauthenticated)
+	}
+	return json.Unmarshal(body, out)
+}
+
+func (a *tokenAPI) call(ctx context.Context, query url.Values) error {
+	result := struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	}{}
+	if err := a.do(ctx, &result, query); err != nil {
+		return err
+	}
+	if !result.Success {
+		return errors.Join(ErrRequestFailed, errors.New(result.Message))
+	}
+	return nil
+}
+
+func (a *tokenAPI) list(ctx context.Context) ([]PiholeRecord, error) {
+	records := make([]PiholeRecord, 0)
+	for _, kind := range []string{"customdns", "customcname"} {
+		result := struct {
+			Data [][]string `json:"data"`
+		}{}
+		if err := a.do(ctx, &result, url.Values{kind: {""}, "action": {"get"}}); err != nil {
+			return nil, err
+		}
+		for _, data := range result.Data {
+			if len(data) < 2 {
+				continue
+			}
+			record := PiholeRecord{Type: dnsv1.RecordTypeCNAME, Domain: data[0], Value: data[1]}
+			if kind == "customdns" {
+				record.Type = dnsv1.RecordTypeA
+				if strings.Contains(data[1], ":") {
+					record.Type = dnsv1.RecordTypeAAAA
+				}
+			}
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (a *tokenAPI) query(action string, record *PiholeRecord) url.Values {
+	if record.Type == dnsv1.RecordTypeCNAME {
+		return url.Values{"customcname": {""}, "action": {action}, "domain": {record.Domain}, "target": {record.Value}}
+	}
+	return url.Values{"customdns": {""}, "action": {action}, "domain": {record.Domain}, "ip": {record.Value}}
+}
+
+func (a *tokenAPI) add(ctx context.Context, record *PiholeRecord) error {
+	return a.call(ctx, a.query("add", record))
+}
+
+func (a *tokenAPI) remove(ctx context.Context, record *PiholeRecord) error {
+	return a.call(ctx, a.query("delete", record))
+}
+
+// doJSON sends the request and decodes the JSON response into out if it is not nil
+func doJSON(client *http.Client, req *http.Request, out any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w: %s", provider.ErrUnauthenticated, resp.Status)
+	case resp.StatusCode >= 300:
+		body := struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}{}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return errors.Join(ErrRequestFailed, fmt.Errorf("%s: %s", resp.Status, body.Error.Message))
+	case out == nil:
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func init() {
+	provider.Register(dnsv1.ProviderTypePihole, func(ctx context.Context, provider dnsv1.ProviderObject) (provider.DNSProvider, error) {
+		spec := provider.GetSpec()
+		if spec.Pihole == nil {
+			return nil, fmt.Errorf("pihole provider requires pihole config")
+		}
+		u, err := url.Parse(spec.Pihole.URL)
+		if err != nil {
+			return nil, err
+		}
+		client := &http.Client{Timeout: requestTimeout}
+		p := new(PiholeProvider)
+		if spec.Pihole.Token != "" {
+			p.api = &tokenAPI{url: *u, token: spec.Pihole.Token, client: client}
+		} else {
+			p.api = &sessionAPI{url: *u, password: spec.Pihole.Password, client: client}
+		}
+		return p, nil
+	}, dnsv1.ProviderCapabilities{
+		RecordTypes: []dnsv1.RecordType{dnsv1.RecordTypeA, dnsv1.RecordTypeAAAA, dnsv1.RecordTypeCNAME},
+	})
+}
@@ -0,0 +1,252 @@
+package pihole
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+	"github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider"
+)
+
+// fakePihole emulates the Local DNS and CNAME endpoints of both Pi-hole APIs
+type fakePihole struct {
+	mu      sync.Mutex
+	hosts   []string
+	cnames  []string
+	logins  int
+	logouts int
+}
+
+const (
+	testPassword = "secret"
+	testToken    = "token"
+	testSid      = "sid"
+)
+
+func (f *fakePihole) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/admin/api.php" {
+		f.serveLegacy(w, r)
+		return
+	}
+
+	if r.URL.Path == "/api/auth" && r.Method == http.MethodDelete {
+		if r.Header.Get("X-FTL-SID") != testSid {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f.logouts++
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.URL.Path == "/api/auth" {
+		body := map[string]string{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		f.logins++
+		if body["password"] != testPassword {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"session":{"valid":true,"sid":"` + testSid + `"}}`))
+		return
+	}
+	if r.Header.Get("X-FTL-SID") != testSid {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/config/dns":
+		_ = json.NewEncoder(w).Encode(map[string]any{"config": map[string]any{"dns": map[string]any{"hosts": f.hosts, "cnameRecords": f.cnames}}})
+	case strings.HasPrefix(r.URL.Path, "/api/config/dns/hosts/"):
+		f.hosts = f.apply(w, r.Method, f.hosts, strings.TrimPrefix(r.URL.Path, "/api/config/dns/hosts/"))
+	case strings.HasPrefix(r.URL.Path, "/api/config/dns/cnameRecords/"):
+		f.cnames = f.apply(w, r.Method, f.cnames, strings.TrimPrefix(r.URL.Path, "/api/config/dns/cnameRecords/"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakePihole) apply(w http.ResponseWriter, method string, items []string, item string) []string {
+	index := slices.Index(items, item)
+	switch {
+	case method == http.MethodPut && index < 0:
+		w.WriteHeader(http.StatusCreated)
+		return append(items, item)
+	case method == http.MethodDelete && index >= 0:
+		w.WriteHeader(http.StatusNoContent)
+		return slices.Delete(items, index, index+1)
+	}
+	w.WriteHeader(http.StatusBadRequest)
+	_, _ = w.Write([]byte(`{"error":{"message":"Item already present or not found"}}`))
+	return items
+}
+
+func (f *fakePihole) serveLegacy(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("auth") != testToken {
+		_, _ = w.Write([]byte(`[]`))
+		return
+	}
+	items, item := &f.hosts, query.Get("ip")+" "+query.Get("domain")
+	if query.Has("customcname") {
+		items, item = &f.cnames, query.Get("domain")+","+query.Get("target")
+	}
+	switch query.Get("action") {
+	case "get":
+		data := make([][]string, 0)
+		for _, i := range *items {
+			if query.Has("customcname") {
+				data = append(data, strings.Split(i, ","))
+			} else {
+				fields := strings.Fields(i)
+				data = append(data, []string{fields[1], fields[0]})
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+	case "add":
+		if slices.Contains(*items, item) {
+			_, _ = w.Write([]byte(`{"success":false,"message":"This domain already has a custom DNS entry"}`))
+			return
+		}
+		*items = append(*items, item)
+		_, _ = w.Write([]byte(`{"success":true,"message":""}`))
+	case "delete":
+		*items = slices.DeleteFunc(*items, func(i string) bool { return i == item })
+		_, _ = w.Write([]byte(`{"success":true,"message":""}`))
+	}
+}
+
+func newTestProvider(t *testing.T, config *dnsv1.PiholeProviderConfig) (*fakePihole, provider.DNSProvider) {
+	fake := &fakePihole{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	config.URL = server.URL
+	p, err := provider.New(context.Background(), &dnsv1.Provider{Spec: dnsv1.ProviderSpec{Type: dnsv1.ProviderTypePihole, Pihole: config}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, p
+}
+
+func testLifecycle(t *testing.T, fake *fakePihole, p provider.DNSProvider) {
+	ctx := context.Background()
+
+	payload := &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "home.example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.1"}}
+	if err := p.Create(ctx, payload); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(fake.hosts, []string{"10.0.0.1 home.example.com"}) {
+		t.Fatalf("unexpected hosts after create: %v", fake.hosts)
+	}
+
+	// the add succeeded but the id was lost with the status update, the retry adopts the entry
+	retry := &provider.DnsProviderPayload{Record: payload.Record}
+	if err := p.Create(ctx, retry); err != nil {
+		t.Fatal(err)
+	}
+	if retry.Id != payload.Id {
+		t.Fatalf("expected the entry to be adopted with id %s, got %s", payload.Id, retry.Id)
+	}
+	if !slices.Equal(fake.hosts, []string{"10.0.0.1 home.example.com"}) {
+		t.Fatalf("unexpected hosts after retry: %v", fake.hosts)
+	}
+
+	payload.Record = &dnsv1.RecordSpec{Name: "home.example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.2"}
+	if err := p.Update(ctx, payload); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(fake.hosts, []string{"10.0.0.2 home.example.com"}) {
+		t.Fatalf("unexpected hosts after update: %v", fake.hosts)
+	}
+
+	cname := &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "www.example.com", Type: dnsv1.RecordTypeCNAME, Value: "home.example.com"}}
+	if err := p.Create(ctx, cname); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(fake.cnames, []string{"www.example.com,home.example.com"}) {
+		t.Fatalf("unexpected cnames after create: %v", fake.cnames)
+	}
+
+	for _, payload := range []*provider.DnsProviderPayload{payload, cname} {
+		if err := p.Delete(ctx, payload); err != nil {
+			t.Fatal(err)
+		}
+		if payload.Id != "" {
+			t.Fatalf("id not cleared after delete: %s", payload.Id)
+		}
+	}
+	if len(fake.hosts) != 0 || len(fake.cnames) != 0 {
+		t.Fatalf("records left after delete: %v %v", fake.hosts, fake.cnames)
+	}
+}
+
+func TestSessionAPI(t *testing.T) {
+	fake, p := newTestProvider(t, &dnsv1.PiholeProviderConfig{Password: testPassword})
+	testLifecycle(t, fake, p)
+	if fake.logins != 1 {
+		t.Fatalf("expected the session to be reused, got %d logins", fake.logins)
+	}
+	if err := p.(io.Closer).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fake.logouts != 1 {
+		t.Fatalf("expected the session to be logged out on close, got %d logouts", fake.logouts)
+	}
+	// nothing to log out of anymore
+	if err := p.(io.Closer).Close(); err != nil || fake.logouts != 1 {
+		t.Fatalf("unexpected second logout: %v, %d logouts", err, fake.logouts)
+	}
+}
+
+func TestSessionAPIRelogin(t *testing.T) {
+	fake, p := newTestProvider(t, &dnsv1.PiholeProviderConfig{Password: testPassword})
+	p.(*PiholeProvider).api.(*sessionAPI).sid = "expired"
+	if err := p.(provider.DNSProviderHealthChecker).HealthCheck(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if fake.logins != 1 {
+		t.Fatalf("expected one login after the session expired, got %d", fake.logins)
+	}
+}
+
+func TestSessionAPIUnauthenticated(t *testing.T) {
+	_, p := newTestProvider(t, &dnsv1.PiholeProviderConfig{Password: "wrong"})
+	err := p.(provider.DNSProviderHealthChecker).HealthCheck(context.Background())
+	if !errors.Is(err, provider.ErrUnauthenticated) {
+		t.Fatalf("expected ErrUnauthenticated, got %v", err)
+	}
+}
+
+func TestTokenAPI(t *testing.T) {
+	fake, p := newTestProvider(t, &dnsv1.PiholeProviderConfig{Token: testToken})
+	testLifecycle(t, fake, p)
+}
+
+func TestTokenAPIUnauthenticated(t *testing.T) {
+	_, p := newTestProvider(t, &dnsv1.PiholeProviderConfig{Token: "wrong"})
+	err := p.(provider.DNSProviderHealthChecker).HealthCheck(context.Background())
+	if !errors.Is(err, provider.ErrUnauthenticated) {
+		t.Fatalf("expected ErrUnauthenticated, got %v", err)
+	}
+}
+
+func TestSessionItemEscaping(t *testing.T) {
+	a := &sessionAPI{url: url.URL{Scheme: "http", Host: "pi.hole"}}
+	u := a.url.JoinPath(append([]string{"api"}, a.item(&PiholeRecord{Type: dnsv1.RecordTypeA, Domain: "a.example.com", Value: "10.0.0.1"})...)...)
+	if u.String() != "http://pi.hole/api/config/dns/hosts/10.0.0.1%20a.example.com" {
+		t.Fatalf("unexpected url %s", u.String())
+	}
+}
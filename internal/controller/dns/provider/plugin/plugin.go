@@ -0,0 +1,170 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+	pluginv1 "github.com/xzzpig/kube-dns-manager/api/plugin/v1"
+	"github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider"
+)
+
+const DefaultTimeout = 10 * time.Second
+
+var (
+	ErrNotImplemented = errors.New("not implemented by the plugin")
+	// ErrAddressNotAllowed is returned for an address which is not in AllowedAddresses
+	ErrAddressNotAllowed = errors.New("plugin address is not allowed")
+)
+
+// AllowedAddresses are the addresses PLUGIN providers may connect to, set by the --plugin-allowed-addresses flag of the manager.
+// The manager connects without transport security, so if it is empty only ClusterProviders can use PLUGIN,
+// otherwise every address must be one of them, also for a ClusterProvider
+var AllowedAddresses []string
+
+type PluginProvider struct {
+	conn    *grpc.ClientConn
+	client  pluginv1.DNSProviderClient
+	config  map[string]string
+	timeout time.Duration
+	// ownership marker sent with every call, empty if pruning is disabled
+	marker string
+}
+
+// fromStatus converts a gRPC status returned by the plugin to the errors of the provider package
+func fromStatus(method string, err error) error {
+	s, ok := status.FromError(err)
+	if !ok {
+		return fmt.Errorf("plugin %s: %w", method, err)
+	}
+	switch s.Code() {
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return fmt.Errorf("%w: %s", provider.ErrUnauthenticated, s.Message())
+	case codes.NotFound:
+		return fmt.Errorf("%w: %s", provider.ErrZoneNotFound, s.Message())
+	case codes.Unimplemented:
+		return fmt.Errorf("%s %w", method, ErrNotImplemented)
+	default:
+		return fmt.Errorf("plugin %s: %s: %s", method, s.Code(), s.Message())
+	}
+}
+
+// withTimeout returns the context of a call to the plugin
+func (p *PluginProvider) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, p.timeout)
+}
+
+func (p *PluginProvider) call(ctx context.Context, method string, payload *provider.DnsProviderPayload,
+	rpc func(context.Context, *pluginv1.Request, ...grpc.CallOption) (*pluginv1.Response, error)) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	req := &pluginv1.Request{Config: p.config, Id: payload.Id, Data: payload.Data, Record: toRecord(payload.Record), Marker: p.marker}
+	resp, err := rpc(ctx, req)
+	if err != nil {
+		return fromStatus(method, err)
+	}
+	payload.Id = resp.GetId()
+	payload.Data = resp.GetData()
+	return nil
+}
+
+func (p *PluginProvider) Create(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
+	payload.Id = ""
+	return p.call(ctx, "Create", payload, p.client.Create)
+}
+
+func (p *PluginProvider) Update(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
+	return p.call(ctx, "Update", payload, p.client.Update)
+}
+
+func (p *PluginProvider) Delete(ctx context.Context, payload *provider.DnsProviderPayload) (err error) {
+	if err := p.call(ctx, "Delete", payload, p.client.Delete); err != nil {
+		return err
+	}
+	payload.Id = ""
+	payload.Data = ""
+	return nil
+}
+
+// List fails with ErrNotImplemented if the plugin does not implement it,
+// the plugin only lists the records carrying the marker
+func (p *PluginProvider) List(ctx context.Context) ([]provider.DnsProviderRecord, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	resp, err := p.client.List(ctx, &pluginv1.ListRequest{Config: p.config, Marker: p.marker})
+	if err != nil {
+		return nil, fromStatus("List", err)
+	}
+	records := make([]provider.DnsProviderRecord, 0, len(resp.GetRecords()))
+	for _, record := range resp.GetRecords() {
+		records = append(records, provider.DnsProviderRecord{Id: record.GetId(), Record: fromRecord(record.GetRecord())})
+	}
+	return records, nil
+}
+
+// HealthCheck succeeds if the plugin does not implement it but is reachable
+func (p *PluginProvider) HealthCheck(ctx context.Context) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	_, err := p.client.HealthCheck(ctx, &pluginv1.HealthCheckRequest{Config: p.config, Marker: p.marker})
+	if err == nil {
+		return nil
+	}
+	if err := fromStatus("HealthCheck", err); !errors.Is(err, ErrNotImplemented) {
+		return err
+	}
+	return nil
+}
+
+func (p *PluginProvider) Close() error {
+	return p.conn.Close()
+}
+
+// checkAddress returns ErrAddressNotAllowed if the provider may not connect to the address
+func checkAddress(provider dnsv1.ProviderObject, address string) error {
+	if len(AllowedAddresses) != 0 {
+		if !slices.Contains(AllowedAddresses, address) {
+			return fmt.Errorf("%w: %s is not in the allowed addresses of the manager", ErrAddressNotAllowed, address)
+		}
+		return nil
+	}
+	if provider.GetNamespace() != "" {
+		return fmt.Errorf("%w: only a ClusterProvider can use plugins unless the manager allows their address", ErrAddressNotAllowed)
+	}
+	return nil
+}
+
+func init() {
+	provider.Register(dnsv1.ProviderTypePlugin, func(ctx context.Context, provider dnsv1.ProviderObject) (provider.DNSProvider, error) {
+		spec := provider.GetSpec()
+		if spec.Plugin == nil || spec.Plugin.Address == "" {
+			return nil, fmt.Errorf("plugin provider requires an address")
+		}
+		if err := checkAddress(provider, spec.Plugin.Address); err != nil {
+			return nil, err
+		}
+		conn, err := grpc.Dial(spec.Plugin.Address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return nil, err
+		}
+		p := &PluginProvider{
+			conn:    conn,
+			client:  pluginv1.NewDNSProviderClient(conn),
+			config:  spec.Plugin.Config,
+			timeout: spec.Plugin.Timeout.Duration,
+			marker:  spec.Prune.Marker(provider.GetUID()),
+		}
+		if p.timeout <= 0 {
+			p.timeout = DefaultTimeout
+		}
+		return p, nil
+	}, dnsv1.ProviderCapabilities{})
+}
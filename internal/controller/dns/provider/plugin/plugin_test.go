@@ -0,0 +1,261 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"google.golang.org/grpc"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+	"github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider"
+)
+
+// fakeProvider keeps the records in memory, the token in the config must be "secret"
+type fakeProvider struct {
+	records map[string]dnsv1.RecordSpec
+}
+
+func (f *fakeProvider) Create(ctx context.Context, payload *provider.DnsProviderPayload) error {
+	payload.Id = fmt.Sprintf("%s-%d", payload.Record.Name, len(f.records))
+	payload.Data = "created"
+	f.records[payload.Id] = *payload.Record
+	return nil
+}
+
+func (f *fakeProvider) Update(ctx context.Context, payload *provider.DnsProviderPayload) error {
+	if _, ok := f.records[payload.Id]; !ok {
+		return fmt.Errorf("record %s not found", payload.Id)
+	}
+	f.records[payload.Id] = *payload.Record
+	payload.Data = "updated"
+	return nil
+}
+
+func (f *fakeProvider) Delete(ctx context.Context, payload *provider.DnsProviderPayload) error {
+	delete(f.records, payload.Id)
+	return nil
+}
+
+// listingProvider implements the optional List
+type listingProvider struct {
+	*fakeProvider
+}
+
+func (l listingProvider) List(ctx context.Context) ([]provider.DnsProviderRecord, error) {
+	records := make([]provider.DnsProviderRecord, 0, len(l.records))
+	for id, record := range l.records {
+		records = append(records, provider.DnsProviderRecord{Id: id, Record: record})
+	}
+	return records, nil
+}
+
+// closingProvider counts its Close calls
+type closingProvider struct {
+	*fakeProvider
+	closed *atomic.Int32
+}
+
+func (c closingProvider) Close() error {
+	c.closed.Add(1)
+	return nil
+}
+
+// serve starts a plugin on a Unix socket and returns the provider connected to it
+func serve(t *testing.T, factory ProviderFactory, config map[string]string) provider.DNSProvider {
+	p, _ := serveWithServer(t, factory, config)
+	return p
+}
+
+func serveWithServer(t *testing.T, factory ProviderFactory, config map[string]string) (provider.DNSProvider, *Server) {
+	return serveSpec(t, factory, dnsv1.ProviderSpec{Plugin: &dnsv1.PluginProviderConfig{Config: config}})
+}
+
+// serveSpec starts a plugin on a Unix socket and returns the provider of spec connected to it
+func serveSpec(t *testing.T, factory ProviderFactory, spec dnsv1.ProviderSpec) (provider.DNSProvider, *Server) {
+	socket := filepath.Join(t.TempDir(), "plugin.sock")
+	lis, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	server := RegisterServer(s, factory)
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(func() {
+		s.Stop()
+		_ = server.Close()
+	})
+
+	spec.Type = dnsv1.ProviderTypePlugin
+	spec.Plugin.Address = "unix://" + socket
+	p, err := provider.New(context.Background(), &dnsv1.ClusterProvider{ObjectMeta: metav1.ObjectMeta{UID: "uid"}, Spec: spec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = p.(*PluginProvider).Close() })
+	return p, server
+}
+
+func TestLifecycle(t *testing.T) {
+	backend := &fakeProvider{records: make(map[string]dnsv1.RecordSpec)}
+	p := serve(t, func(ctx context.Context, config map[string]string, marker string) (provider.DNSProvider, error) {
+		if config["token"] != "secret" {
+			return nil, provider.ErrUnauthenticated
+		}
+		return listingProvider{backend}, nil
+	}, map[string]string{"token": "secret"})
+	ctx := context.Background()
+
+	payload := &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "a.example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.1"}}
+	if err := p.Create(ctx, payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Id != "a.example.com-0" || payload.Data != "created" {
+		t.Fatalf("unexpected id %q and data %q", payload.Id, payload.Data)
+	}
+
+	payload.Record.Value = "10.0.0.2"
+	if err := p.Update(ctx, payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Id != "a.example.com-0" || payload.Data != "updated" || backend.records[payload.Id].Value != "10.0.0.2" {
+		t.Fatalf("record not updated: %q %q %v", payload.Id, payload.Data, backend.records)
+	}
+
+	records, err := p.(provider.DNSProviderLister).List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Id != "a.example.com-0" || records[0].Record.Value != "10.0.0.2" {
+		t.Fatalf("unexpected records %v", records)
+	}
+	if err := p.(provider.DNSProviderHealthChecker).HealthCheck(ctx); err != nil {
+		t.Fatalf("expected a plugin without health check to be healthy, got %v", err)
+	}
+
+	if err := p.Delete(ctx, payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Id != "" || len(backend.records) != 0 {
+		t.Fatalf("record not deleted: %q %v", payload.Id, backend.records)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	p := serve(t, func(ctx context.Context, config map[string]string, marker string) (provider.DNSProvider, error) {
+		if config["token"] != "secret" {
+			return nil, provider.ErrUnauthenticated
+		}
+		return &fakeProvider{records: make(map[string]dnsv1.RecordSpec)}, nil
+	}, map[string]string{"token": "wrong"})
+	ctx := context.Background()
+
+	payload := &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "a.example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.1"}}
+	if err := p.Create(ctx, payload); !errors.Is(err, provider.ErrUnauthenticated) {
+		t.Fatalf("expected ErrUnauthenticated, got %v", err)
+	}
+	if err := p.(provider.DNSProviderHealthChecker).HealthCheck(ctx); !errors.Is(err, provider.ErrUnauthenticated) {
+		t.Fatalf("expected ErrUnauthenticated, got %v", err)
+	}
+
+	p = serve(t, func(ctx context.Context, config map[string]string, marker string) (provider.DNSProvider, error) {
+		return &fakeProvider{records: make(map[string]dnsv1.RecordSpec)}, nil
+	}, nil)
+	payload.Id = "missing"
+	if err := p.Update(ctx, payload); err == nil || payload.Id != "missing" {
+		t.Fatalf("expected an error keeping the id, got %v and %q", err, payload.Id)
+	}
+	if _, err := p.(provider.DNSProviderLister).List(ctx); !errors.Is(err, ErrNotImplemented) {
+		t.Fatalf("expected ErrNotImplemented, got %v", err)
+	}
+}
+
+func TestServerReusesProviders(t *testing.T) {
+	builds, closed := &atomic.Int32{}, &atomic.Int32{}
+	p, server := serveWithServer(t, func(ctx context.Context, config map[string]string, marker string) (provider.DNSProvider, error) {
+		builds.Add(1)
+		return closingProvider{&fakeProvider{records: make(map[string]dnsv1.RecordSpec)}, closed}, nil
+	}, map[string]string{"token": "secret", "zone": "example.com"})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		payload := &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "a.example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.1"}}
+		if err := p.Create(ctx, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if builds.Load() != 1 {
+		t.Fatalf("provider built %d times for the same config, want once", builds.Load())
+	}
+	if closed.Load() != 0 {
+		t.Fatalf("provider closed while served")
+	}
+	if err := server.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if closed.Load() != 1 {
+		t.Fatalf("provider closed %d times by Close, want once", closed.Load())
+	}
+}
+
+func TestMarker(t *testing.T) {
+	markers := make(chan string, 1)
+	p, _ := serveSpec(t, func(ctx context.Context, config map[string]string, marker string) (provider.DNSProvider, error) {
+		markers <- marker
+		return listingProvider{&fakeProvider{records: make(map[string]dnsv1.RecordSpec)}}, nil
+	}, dnsv1.ProviderSpec{
+		Plugin: &dnsv1.PluginProviderConfig{},
+		Prune:  &dnsv1.ProviderPruneConfig{Enabled: true, OwnerID: "cluster-a"},
+	})
+	ctx := context.Background()
+
+	if err := p.(provider.DNSProviderHealthChecker).HealthCheck(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if marker := <-markers; marker != dnsv1.OwnershipMarkerPrefix+"cluster-a" {
+		t.Fatalf("expected the marker of the owner to be sent, got %q", marker)
+	}
+	// the calls carry the same marker, so the provider is reused by them
+	if err := p.Create(ctx, &provider.DnsProviderPayload{Record: &dnsv1.RecordSpec{Name: "a.example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.(provider.DNSProviderLister).List(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(markers) != 0 {
+		t.Fatalf("provider built again with the marker %q", <-markers)
+	}
+}
+
+func TestCheckAddress(t *testing.T) {
+	cluster := &dnsv1.ClusterProvider{}
+	namespaced := &dnsv1.Provider{ObjectMeta: metav1.ObjectMeta{Namespace: "default"}}
+	tests := []struct {
+		name     string
+		allowed  []string
+		provider dnsv1.ProviderObject
+		address  string
+		wantErr  bool
+	}{
+		{name: "cluster provider", provider: cluster, address: "10.0.0.1:50051"},
+		{name: "namespaced provider", provider: namespaced, address: "10.0.0.1:50051", wantErr: true},
+		{name: "allowed address", allowed: []string{"unix:///plugins/registrar.sock"}, provider: namespaced, address: "unix:///plugins/registrar.sock"},
+		{name: "address not allowed", allowed: []string{"unix:///plugins/registrar.sock"}, provider: cluster, address: "10.0.0.1:50051", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			AllowedAddresses = tt.allowed
+			defer func() { AllowedAddresses = nil }()
+			err := checkAddress(tt.provider, tt.address)
+			if tt.wantErr != errors.Is(err, ErrAddressNotAllowed) {
+				t.Errorf("checkAddress = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package plugin
+
+import (
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+	pluginv1 "github.com/xzzpig/kube-dns-manager/api/plugin/v1"
+)
+
+// The plugin protocol is the gRPC service kdm.provider.v1.DNSProvider defined in api/plugin/v1/provider.proto,
+// plugins in any language generate their server from it, plugins in Go can use the package pluginv1.
+// Plugins return UNAUTHENTICATED or NOT_FOUND when the credentials or the zone are rejected by the backend.
+
+func toRecord(record *dnsv1.RecordSpec) *pluginv1.Record {
+	return &pluginv1.Record{
+		Name:  record.Name,
+		Type:  string(record.Type),
+		Value: record.Value,
+		Ttl:   int32(record.TTL),
+		Extra: record.Extra,
+	}
+}
+
+func fromRecord(record *pluginv1.Record) dnsv1.RecordSpec {
+	return dnsv1.RecordSpec{
+		Name:  record.GetName(),
+		Type:  dnsv1.RecordType(record.GetType()),
+		Value: record.GetValue(),
+		TTL:   int(record.GetTtl()),
+		Extra: record.GetExtra(),
+	}
+}
@@ -0,0 +1,156 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pluginv1 "github.com/xzzpig/kube-dns-manager/api/plugin/v1"
+	"github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider"
+)
+
+// ProviderFactory builds the DNSProvider serving the calls with the config of a calling provider.
+// marker is the ownership marker the DNSProvider writes to its records and lists them by, empty if pruning is disabled
+type ProviderFactory = func(ctx context.Context, config map[string]string, marker string) (provider.DNSProvider, error)
+
+// Server serves the plugin protocol with the DNSProviders of a ProviderFactory,
+// List and HealthCheck are served if the DNSProvider implements DNSProviderLister and DNSProviderHealthChecker.
+//
+// A DNSProvider is built once per config and marker and reused by the following calls,
+// Close closes the DNSProviders implementing io.Closer.
+type Server struct {
+	pluginv1.UnimplementedDNSProviderServer
+
+	factory   ProviderFactory
+	mu        sync.Mutex
+	providers map[string]provider.DNSProvider
+}
+
+// RegisterServer serves the plugin protocol on s with the DNSProviders built by factory,
+// the returned Server must be closed once s is stopped
+func RegisterServer(s grpc.ServiceRegistrar, factory ProviderFactory) *Server {
+	server := &Server{factory: factory, providers: make(map[string]provider.DNSProvider)}
+	pluginv1.RegisterDNSProviderServer(s, server)
+	return server
+}
+
+// toStatus converts an error of a DNSProvider to a gRPC status
+func toStatus(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, provider.ErrUnauthenticated):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, provider.ErrZoneNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		return status.Error(codes.Unknown, err.Error())
+	}
+}
+
+// provider returns the DNSProvider built for the config and marker, building it on the first call
+func (s *Server) provider(ctx context.Context, config map[string]string, marker string) (provider.DNSProvider, error) {
+	// maps are encoded with sorted keys, so equal configs have the same key
+	key, err := json.Marshal(map[string]any{"config": config, "marker": marker})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if dnsProvider, ok := s.providers[string(key)]; ok {
+		return dnsProvider, nil
+	}
+	dnsProvider, err := s.factory(ctx, config, marker)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	s.providers[string(key)] = dnsProvider
+	return dnsProvider, nil
+}
+
+// Close closes the DNSProviders built by the Server
+func (s *Server) Close() error {
+	s.mu.Lock()
+	providers := s.providers
+	s.providers = make(map[string]provider.DNSProvider)
+	s.mu.Unlock()
+
+	var errs []error
+	for _, dnsProvider := range providers {
+		if closer, ok := dnsProvider.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Server) call(ctx context.Context, req *pluginv1.Request, op func(provider.DNSProvider, context.Context, *provider.DnsProviderPayload) error) (*pluginv1.Response, error) {
+	dnsProvider, err := s.provider(ctx, req.GetConfig(), req.GetMarker())
+	if err != nil {
+		return nil, err
+	}
+	if req.GetRecord() == nil {
+		return nil, status.Error(codes.InvalidArgument, "request without a record")
+	}
+	record := fromRecord(req.GetRecord())
+	payload := &provider.DnsProviderPayload{Id: req.GetId(), Data: req.GetData(), Record: &record}
+	if err := op(dnsProvider, ctx, payload); err != nil {
+		return nil, toStatus(err)
+	}
+	return &pluginv1.Response{Id: payload.Id, Data: payload.Data}, nil
+}
+
+func (s *Server) Create(ctx context.Context, req *pluginv1.Request) (*pluginv1.Response, error) {
+	return s.call(ctx, req, provider.DNSProvider.Create)
+}
+
+func (s *Server) Update(ctx context.Context, req *pluginv1.Request) (*pluginv1.Response, error) {
+	return s.call(ctx, req, provider.DNSProvider.Update)
+}
+
+func (s *Server) Delete(ctx context.Context, req *pluginv1.Request) (*pluginv1.Response, error) {
+	return s.call(ctx, req, provider.DNSProvider.Delete)
+}
+
+func (s *Server) List(ctx context.Context, req *pluginv1.ListRequest) (*pluginv1.ListResponse, error) {
+	dnsProvider, err := s.provider(ctx, req.GetConfig(), req.GetMarker())
+	if err != nil {
+		return nil, err
+	}
+	lister, ok := dnsProvider.(provider.DNSProviderLister)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "plugin does not list records")
+	}
+	records, err := lister.List(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	resp := &pluginv1.ListResponse{Records: make([]*pluginv1.ListRecord, 0, len(records))}
+	for _, record := range records {
+		resp.Records = append(resp.Records, &pluginv1.ListRecord{Id: record.Id, Record: toRecord(&record.Record)})
+	}
+	return resp, nil
+}
+
+func (s *Server) HealthCheck(ctx context.Context, req *pluginv1.HealthCheckRequest) (*pluginv1.HealthCheckResponse, error) {
+	dnsProvider, err := s.provider(ctx, req.GetConfig(), req.GetMarker())
+	if err != nil {
+		return nil, err
+	}
+	checker, ok := dnsProvider.(provider.DNSProviderHealthChecker)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "plugin does not check its health")
+	}
+	if err := checker.HealthCheck(ctx); err != nil {
+		return nil, toStatus(err)
+	}
+	return &pluginv1.HealthCheckResponse{}, nil
+}
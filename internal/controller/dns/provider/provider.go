@@ -4,23 +4,50 @@ import (
 	"context"
 	"errors"
 
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
 	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
 )
 
 type ContextKey string
 
 const (
-	CtxKeyClient ContextKey = "CLIENT"
+	CtxKeyClient    ContextKey = "CLIENT"
+	CtxKeyClientset ContextKey = "CLIENTSET"
 )
 
-var ErrProviderNotFound = errors.New("provider not found")
+// Labels and annotations of the Jobs created by the JOB provider, declared here
+// so the Record controller can watch the Jobs without importing the job package
+const (
+	LabelJobAction = "dns.xzzpig.com/action"
+	// LabelJobRecord is omitted if the name of the Record is not a valid label value
+	LabelJobRecord          = "dns.xzzpig.com/record"
+	LabelJobRecordNamespace = "dns.xzzpig.com/record-namespace"
+	// AnnotationJobRecord holds the namespace/name of the Record the Job was created for
+	AnnotationJobRecord = "dns.xzzpig.com/record"
+)
 
-var providers = make(map[dnsv1.ProviderType]DNSProviderFactory)
+var (
+	ErrProviderNotFound  = errors.New("provider not found")
+	ErrUnauthenticated   = errors.New("authentication failed")
+	ErrZoneNotFound      = errors.New("zone not found")
+	ErrClientNotFound    = errors.New("client not found in context")
+	ErrClientNotClient   = errors.New("client is not a client.Client")
+	ErrClientsetNotFound = errors.New("clientset not found in context")
+)
+
+var (
+	providers    = make(map[dnsv1.ProviderType]DNSProviderFactory)
+	capabilities = make(map[dnsv1.ProviderType]dnsv1.ProviderCapabilities)
+)
 
 type DnsProviderPayload struct {
 	Id     string            //in,out
 	Data   string            //in,out
 	Record *dnsv1.RecordSpec //in
+	Object *dnsv1.Record     //in, nil when pruning orphaned records
 }
 
 type DNSProvider interface {
@@ -29,15 +56,62 @@ type DNSProvider interface {
 	Delete(ctx context.Context, data *DnsProviderPayload) error
 }
 
+// DNSProviderLister is implemented by providers which can list the records
+// carrying the ownership marker on the provider side
+type DNSProviderLister interface {
+	List(ctx context.Context) ([]DnsProviderRecord, error)
+}
+
+// DNSProviderHealthChecker is implemented by providers which can probe their backend,
+// returned errors should wrap ErrUnauthenticated or ErrZoneNotFound when applicable
+type DNSProviderHealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// DNSProviderCapabilities is implemented by providers whose capabilities depend on their config,
+// they replace the capabilities declared by the provider type unless the spec overrides them
+type DNSProviderCapabilities interface {
+	Capabilities() dnsv1.ProviderCapabilities
+}
+
+type DnsProviderRecord struct {
+	Id     string
+	Record dnsv1.RecordSpec
+}
+
 type CachedDnsProvider struct {
 	DNSProvider
+	UID        types.UID
 	Generation int64
+	// Result of the last health check
+	Health error
+
+	// Number of callers using the DNSProvider, guarded by the Registry
+	refs int
+	// Replaced or evicted, it is closed once it is not used anymore
+	retired bool
+}
+
+// retire marks the DNSProvider as replaced or evicted and reports whether it can be closed now
+func (c *CachedDnsProvider) retire() bool {
+	c.retired = true
+	return c.refs == 0
 }
 
 type DNSProviderFactory = func(ctx context.Context, provider dnsv1.ProviderObject) (DNSProvider, error)
 
-func Register(providerType dnsv1.ProviderType, factory DNSProviderFactory) {
+func Register(providerType dnsv1.ProviderType, factory DNSProviderFactory, caps dnsv1.ProviderCapabilities) {
 	providers[providerType] = factory
+	capabilities[providerType] = caps
+}
+
+// Capabilities returns the capabilities declared by the provider type
+func Capabilities(providerType dnsv1.ProviderType) (dnsv1.ProviderCapabilities, error) {
+	caps, ok := capabilities[providerType]
+	if !ok {
+		return caps, ErrProviderNotFound
+	}
+	return caps, nil
 }
 
 func New(ctx context.Context, provider dnsv1.ProviderObject) (DNSProvider, error) {
@@ -48,6 +122,28 @@ func New(ctx context.Context, provider dnsv1.ProviderObject) (DNSProvider, error
 	return factory(ctx, provider)
 }
 
+// GetClient returns the kubernetes client stored in ctx under CtxKeyClient
+func GetClient(ctx context.Context) (client.Client, error) {
+	c := ctx.Value(CtxKeyClient)
+	if c == nil {
+		return nil, ErrClientNotFound
+	}
+	if client, ok := c.(client.Client); ok {
+		return client, nil
+	} else {
+		return nil, ErrClientNotClient
+	}
+}
+
+// GetClientset returns the kubernetes clientset stored in ctx under CtxKeyClientset,
+// it is needed for the APIs the controller-runtime client does not support, e.g. Pod logs
+func GetClientset(ctx context.Context) (kubernetes.Interface, error) {
+	if clientset, ok := ctx.Value(CtxKeyClientset).(kubernetes.Interface); ok {
+		return clientset, nil
+	}
+	return nil, ErrClientsetNotFound
+}
+
 func NewPayload(status *dnsv1.RecordProviderStatus, record *dnsv1.RecordSpec) *DnsProviderPayload {
 	return &DnsProviderPayload{
 		Id:     status.RecordID,
@@ -0,0 +1,190 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+)
+
+// Registry holds the DNSProviders built from Provider and ClusterProvider objects.
+// It is safe for concurrent use by multiple controllers.
+//
+// DNSProviders which hold connections may implement io.Closer, Close is called
+// when the DNSProvider is replaced, evicted or the Registry is stopped,
+// and no caller still uses it: Get and Load return a release func to call once done with the DNSProvider.
+type Registry struct {
+	mu        sync.Mutex
+	providers map[types.NamespacedName]*CachedDnsProvider
+	// Serializes the builds of a DNSProvider, so concurrent Loads build it once
+	buildLocks map[types.NamespacedName]*sync.Mutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		providers:  make(map[types.NamespacedName]*CachedDnsProvider),
+		buildLocks: make(map[types.NamespacedName]*sync.Mutex),
+	}
+}
+
+func registryKey(obj dnsv1.ProviderObject) types.NamespacedName {
+	return types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}
+}
+
+func noRelease() {}
+
+// Get returns the DNSProvider built from the current generation of obj, or nil if there is none.
+// The release func must be called once the DNSProvider is not used anymore
+func (r *Registry) Get(obj dnsv1.ProviderObject) (DNSProvider, func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cached := r.providers[registryKey(obj)]
+	if cached == nil || cached.UID != obj.GetUID() || cached.Generation != obj.GetGeneration() {
+		return nil, noRelease
+	}
+	cached.refs++
+	return cached.DNSProvider, r.releaser(cached)
+}
+
+// Load returns the DNSProvider built from the current generation of obj,
+// building it and replacing the outdated one if necessary.
+// The release func must be called once the DNSProvider is not used anymore
+func (r *Registry) Load(ctx context.Context, obj dnsv1.ProviderObject) (DNSProvider, func(), error) {
+	if dnsProvider, release := r.Get(obj); dnsProvider != nil {
+		return dnsProvider, release, nil
+	}
+
+	key := registryKey(obj)
+	r.mu.Lock()
+	buildLock := r.buildLocks[key]
+	if buildLock == nil {
+		buildLock = &sync.Mutex{}
+		r.buildLocks[key] = buildLock
+	}
+	r.mu.Unlock()
+	buildLock.Lock()
+	defer buildLock.Unlock()
+
+	// built by a concurrent Load while waiting for the lock
+	if dnsProvider, release := r.Get(obj); dnsProvider != nil {
+		return dnsProvider, release, nil
+	}
+
+	dnsProvider, err := New(ctx, obj)
+	if err != nil {
+		return nil, noRelease, err
+	}
+
+	cached := &CachedDnsProvider{DNSProvider: dnsProvider, UID: obj.GetUID(), Generation: obj.GetGeneration(), refs: 1}
+	r.mu.Lock()
+	old := r.providers[key]
+	r.providers[key] = cached
+	closeOld := old != nil && old.retire()
+	r.mu.Unlock()
+
+	if closeOld {
+		logCloseError(closeProvider(old.DNSProvider))
+	}
+	return dnsProvider, r.releaser(cached), nil
+}
+
+// releaser returns the release func of a use of the cached DNSProvider, it closes the DNSProvider
+// if it was retired meanwhile and this was its last use
+func (r *Registry) releaser(cached *CachedDnsProvider) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.mu.Lock()
+			cached.refs--
+			closeNow := cached.retired && cached.refs == 0
+			r.mu.Unlock()
+			if closeNow {
+				logCloseError(closeProvider(cached.DNSProvider))
+			}
+		})
+	}
+}
+
+// SetHealth records the result of the last health check of the DNSProvider built from obj
+func (r *Registry) SetHealth(obj dnsv1.ProviderObject, health error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cached := r.providers[registryKey(obj)]; cached != nil && cached.UID == obj.GetUID() {
+		cached.Health = health
+	}
+}
+
+// ReadyzCheck implements healthz.Checker, it fails if the last health check of any DNSProvider failed
+func (r *Registry) ReadyzCheck(_ *http.Request) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for name, cached := range r.providers {
+		if cached.Health != nil {
+			errs = append(errs, fmt.Errorf("provider %s: %w", name, cached.Health))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Evict removes the DNSProvider registered with the given name, it is closed now if it is not in use,
+// otherwise once the last caller releases it
+func (r *Registry) Evict(name types.NamespacedName) error {
+	r.mu.Lock()
+	old := r.providers[name]
+	delete(r.providers, name)
+	delete(r.buildLocks, name)
+	closeNow := old != nil && old.retire()
+	r.mu.Unlock()
+
+	if !closeNow {
+		return nil
+	}
+	return closeProvider(old.DNSProvider)
+}
+
+// Close evicts all registered DNSProviders
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	providers := r.providers
+	r.providers = make(map[types.NamespacedName]*CachedDnsProvider)
+	closing := make([]DNSProvider, 0, len(providers))
+	for _, cached := range providers {
+		if cached.retire() {
+			closing = append(closing, cached.DNSProvider)
+		}
+	}
+	r.mu.Unlock()
+
+	var errs []error
+	for _, dnsProvider := range closing {
+		errs = append(errs, closeProvider(dnsProvider))
+	}
+	return errors.Join(errs...)
+}
+
+// Start implements manager.Runnable, it closes all DNSProviders when the manager stops
+func (r *Registry) Start(ctx context.Context) error {
+	<-ctx.Done()
+	return r.Close()
+}
+
+func closeProvider(dnsProvider DNSProvider) error {
+	if closer, ok := dnsProvider.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func logCloseError(err error) {
+	if err != nil {
+		log.Log.WithName("provider-registry").Error(err, "failed to close provider")
+	}
+}
@@ -0,0 +1,168 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+)
+
+const testProviderType dnsv1.ProviderType = "REGISTRY_TEST"
+
+// closingProvider counts its Close calls
+type closingProvider struct {
+	closed atomic.Int32
+}
+
+func (p *closingProvider) Create(ctx context.Context, payload *DnsProviderPayload) error { return nil }
+func (p *closingProvider) Update(ctx context.Context, payload *DnsProviderPayload) error { return nil }
+func (p *closingProvider) Delete(ctx context.Context, payload *DnsProviderPayload) error { return nil }
+func (p *closingProvider) Close() error {
+	p.closed.Add(1)
+	return nil
+}
+
+// registerTestProvider registers a provider type whose builds are counted and slowed down to expose races
+func registerTestProvider(t *testing.T) *atomic.Int32 {
+	builds := &atomic.Int32{}
+	Register(testProviderType, func(ctx context.Context, provider dnsv1.ProviderObject) (DNSProvider, error) {
+		builds.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return &closingProvider{}, nil
+	}, dnsv1.ProviderCapabilities{})
+	t.Cleanup(func() {
+		delete(providers, testProviderType)
+		delete(capabilities, testProviderType)
+	})
+	return builds
+}
+
+func testProvider(generation int64) *dnsv1.ClusterProvider {
+	return &dnsv1.ClusterProvider{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", UID: "uid", Generation: generation},
+		Spec:       dnsv1.ProviderSpec{Type: testProviderType},
+	}
+}
+
+func TestRegistryConcurrentLoad(t *testing.T) {
+	builds := registerTestProvider(t)
+	registry := NewRegistry()
+	ctx := context.Background()
+
+	results := make([]DNSProvider, 10)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			dnsProvider, release, err := registry.Load(ctx, testProvider(1))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer release()
+			results[i] = dnsProvider
+		}(i)
+	}
+	wg.Wait()
+
+	if builds.Load() != 1 {
+		t.Errorf("provider built %d times, want once", builds.Load())
+	}
+	for _, dnsProvider := range results {
+		if dnsProvider != results[0] {
+			t.Fatal("concurrent Loads returned different providers")
+		}
+	}
+	if closed := results[0].(*closingProvider).closed.Load(); closed != 0 {
+		t.Errorf("provider in the registry closed %d times", closed)
+	}
+}
+
+func TestRegistryRetire(t *testing.T) {
+	registerTestProvider(t)
+	registry := NewRegistry()
+	ctx := context.Background()
+
+	first, release, err := registry.Load(ctx, testProvider(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := registry.Get(testProvider(2)); got != nil {
+		t.Error("Get returned the provider of an outdated generation")
+	}
+
+	// replaced while in use, closed once released
+	second, releaseSecond, err := registry.Load(ctx, testProvider(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first {
+		t.Fatal("provider not rebuilt for a new generation")
+	}
+	if closed := first.(*closingProvider).closed.Load(); closed != 0 {
+		t.Fatalf("replaced provider closed while in use")
+	}
+	release()
+	release()
+	if closed := first.(*closingProvider).closed.Load(); closed != 1 {
+		t.Fatalf("replaced provider closed %d times after release, want once", closed)
+	}
+
+	// evicted while in use, closed once released
+	if err := registry.Evict(types.NamespacedName{Name: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := registry.Get(testProvider(2)); got != nil {
+		t.Error("Get returned an evicted provider")
+	}
+	if closed := second.(*closingProvider).closed.Load(); closed != 0 {
+		t.Fatalf("evicted provider closed while in use")
+	}
+	releaseSecond()
+	if closed := second.(*closingProvider).closed.Load(); closed != 1 {
+		t.Fatalf("evicted provider closed %d times after release, want once", closed)
+	}
+
+	// not in use, closed by Close
+	third, releaseThird, err := registry.Load(ctx, testProvider(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseThird()
+	if err := registry.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if closed := third.(*closingProvider).closed.Load(); closed != 1 {
+		t.Fatalf("provider closed %d times by Close, want once", closed)
+	}
+}
+
+func TestRegistryReadyzCheck(t *testing.T) {
+	registerTestProvider(t)
+	registry := NewRegistry()
+	_, release, err := registry.Load(context.Background(), testProvider(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	if err := registry.ReadyzCheck(nil); err != nil {
+		t.Fatalf("expected ready before a health check, got %v", err)
+	}
+	registry.SetHealth(testProvider(1), ErrUnauthenticated)
+	if err := registry.ReadyzCheck(nil); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("expected ErrUnauthenticated, got %v", err)
+	}
+	registry.SetHealth(testProvider(1), nil)
+	if err := registry.ReadyzCheck(nil); err != nil {
+		t.Fatalf("expected ready after a successful health check, got %v", err)
+	}
+}
@@ -18,10 +18,14 @@ package dns
 
 import (
 	"context"
+	"errors"
+	"slices"
 	"time"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -31,13 +35,21 @@ import (
 	"github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider"
 )
 
-var providerCache = make(map[types.UID]*provider.CachedDnsProvider)
+const (
+	DefaultPruneInterval    = 10 * time.Minute
+	DefaultPruneGracePeriod = 10 * time.Minute
+
+	DefaultHealthCheckInterval = 5 * time.Minute
+	// First retry of a failed health check of a provider without health check interval
+	MinHealthCheckRetry = 10 * time.Second
+)
 
 // ProviderReconciler reconciles a Provider object
 type ProviderReconciler[T dnsv1.ProviderObject] struct {
 	client.Client
-	Scheme *runtime.Scheme
-	newer  T
+	Scheme   *runtime.Scheme
+	Registry *provider.Registry
+	newer    T
 }
 
 // +kubebuilder:rbac:groups=dns.xzzpig.com,resources=providers,verbs=get;list;watch;create;update;patch;delete
@@ -61,7 +73,10 @@ func (r *ProviderReconciler[T]) Reconcile(ctx context.Context, req ctrl.Request)
 
 	p := r.newer.New()
 	if err := r.Get(ctx, req.NamespacedName, p); err != nil {
-		return ctrl.Result{}, client.IgnoreNotFound(err)
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, r.Registry.Evict(req.NamespacedName)
+		}
+		return ctrl.Result{}, err
 	}
 
 	if addFinalizer(p) {
@@ -72,28 +87,29 @@ func (r *ProviderReconciler[T]) Reconcile(ctx context.Context, req ctrl.Request)
 	}
 
 	defer func() {
+		readyCondition := metav1.Condition{
+			Type:               dnsv1.ProviderConditionReady,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: p.GetGeneration(),
+			Reason:             "Available",
+		}
 		if err != nil {
 			p.GetStatus().Ready = false
 			p.GetStatus().Reason = err.Error()
+			readyCondition.Status = metav1.ConditionFalse
+			readyCondition.Reason = "Unavailable"
+			readyCondition.Message = err.Error()
 			err = nil
 		} else {
 			p.GetStatus().Ready = true
 			p.GetStatus().Reason = ""
 		}
+		meta.SetStatusCondition(&p.GetStatus().Conditions, readyCondition)
 		if updateErr := r.Status().Update(ctx, p); updateErr != nil {
 			logger.Error(updateErr, "Failed to update provider status")
 		}
 	}()
 
-	newDnsProvider := func() error {
-		dnsProvider, err := provider.New(ctx, p)
-		if err != nil {
-			return err
-		}
-		providerCache[p.GetUID()] = &provider.CachedDnsProvider{DNSProvider: dnsProvider, Generation: p.GetGeneration()}
-		return nil
-	}
-
 	if !p.GetDeletionTimestamp().IsZero() {
 		recordList := &dnsv1.RecordList{}
 		if err := r.List(ctx, recordList, client.InNamespace(p.GetNamespace()), client.MatchingFields{providersField: req.String()}); err != nil {
@@ -116,23 +132,235 @@ func (r *ProviderReconciler[T]) Reconcile(ctx context.Context, req ctrl.Request)
 			if err := r.Update(ctx, p); err != nil {
 				return ctrl.Result{}, err
 			}
+			if err := r.Registry.Evict(req.NamespacedName); err != nil {
+				logger.Error(err, "Failed to close provider")
+			}
 			return ctrl.Result{}, nil
 		}
-		if dnsProvider := providerCache[p.GetUID()]; dnsProvider == nil || dnsProvider.Generation != p.GetGeneration() {
-			err = newDnsProvider()
-			if err != nil {
-				return ctrl.Result{RequeueAfter: time.Second}, err
-			}
+		_, release, err := r.Registry.Load(ctx, p)
+		if err != nil {
+			return ctrl.Result{RequeueAfter: time.Second}, err
 		}
+		release()
 		return ctrl.Result{RequeueAfter: time.Second}, ErrorWaitRecords
 	}
 
-	err = newDnsProvider()
+	if caps, err := provider.Capabilities(p.GetSpec().Type); err == nil {
+		if p.GetSpec().Capabilities != nil {
+			caps = *p.GetSpec().Capabilities
+		}
+		p.GetStatus().Capabilities = &caps
+	}
+
+	dnsProvider, release, err := r.Registry.Load(ctx, p)
 	if err != nil {
+		setHealthConditions(p, err)
 		return ctrl.Result{RequeueAfter: time.Minute}, err
 	}
+	defer release()
+	if declarer, ok := dnsProvider.(provider.DNSProviderCapabilities); ok && p.GetSpec().Capabilities == nil {
+		caps := declarer.Capabilities()
+		p.GetStatus().Capabilities = &caps
+	}
+
+	result, err = r.healthCheck(ctx, p, dnsProvider)
+	if err != nil {
+		return result, err
+	}
 
-	return ctrl.Result{}, nil
+	if prune := p.GetSpec().Prune; prune != nil && prune.Enabled {
+		pruneResult, err := r.prune(ctx, p, dnsProvider)
+		if pruneResult.RequeueAfter > 0 && (result.RequeueAfter == 0 || pruneResult.RequeueAfter < result.RequeueAfter) {
+			result.RequeueAfter = pruneResult.RequeueAfter
+		}
+		return result, err
+	}
+	if status := p.GetStatus().Prune; status != nil {
+		// the retained records keep their marker, they must not be pruned once pruning is enabled again
+		p.GetStatus().Prune = &dnsv1.ProviderPruneStatus{Retained: status.Retained}
+		if len(status.Retained) == 0 {
+			p.GetStatus().Prune = nil
+		}
+	}
+
+	return result, nil
+}
+
+// healthCheck probes the provider and records the result in the status of the provider
+func (r *ProviderReconciler[T]) healthCheck(ctx context.Context, p dnsv1.ProviderObject, dnsProvider provider.DNSProvider) (ctrl.Result, error) {
+	result := ctrl.Result{}
+	if spec := p.GetSpec().HealthCheck; spec != nil {
+		result.RequeueAfter = spec.Interval.Duration
+		if result.RequeueAfter <= 0 {
+			result.RequeueAfter = DefaultHealthCheckInterval
+		}
+	}
+
+	checker, ok := dnsProvider.(provider.DNSProviderHealthChecker)
+	if !ok {
+		return result, nil
+	}
+
+	now := metav1.Now()
+	p.GetStatus().LastProbeTime = &now
+	err := checker.HealthCheck(ctx)
+	r.Registry.SetHealth(p, err)
+	setHealthConditions(p, err)
+	if err != nil && result.RequeueAfter == 0 {
+		// no periodic probe would ever mark the provider ready again
+		result.RequeueAfter = healthCheckRetry(p.GetStatus().Conditions, now.Time)
+	}
+	return result, err
+}
+
+// healthCheckRetry backs off the probes of an unhealthy provider: it waits as long as the provider
+// has been not ready, at least MinHealthCheckRetry and at most DefaultHealthCheckInterval
+func healthCheckRetry(conditions []metav1.Condition, now time.Time) time.Duration {
+	var unhealthy time.Duration
+	if ready := meta.FindStatusCondition(conditions, dnsv1.ProviderConditionReady); ready != nil && ready.Status == metav1.ConditionFalse {
+		unhealthy = now.Sub(ready.LastTransitionTime.Time)
+	}
+	return min(max(unhealthy, MinHealthCheckRetry), DefaultHealthCheckInterval)
+}
+
+// setHealthConditions sets the Authenticated and ZoneFound conditions of the provider from the result of a probe
+func setHealthConditions(p dnsv1.ProviderObject, err error) {
+	authenticated := metav1.Condition{Type: dnsv1.ProviderConditionAuthenticated, Status: metav1.ConditionTrue, Reason: "Authenticated"}
+	zoneFound := metav1.Condition{Type: dnsv1.ProviderConditionZoneFound, Status: metav1.ConditionTrue, Reason: "ZoneFound"}
+	switch {
+	case err == nil:
+	case errors.Is(err, provider.ErrUnauthenticated):
+		authenticated.Status, authenticated.Reason, authenticated.Message = metav1.ConditionFalse, "AuthenticationFailed", err.Error()
+		zoneFound.Status, zoneFound.Reason = metav1.ConditionUnknown, "ProbeFailed"
+	case errors.Is(err, provider.ErrZoneNotFound):
+		zoneFound.Status, zoneFound.Reason, zoneFound.Message = metav1.ConditionFalse, "ZoneNotFound", err.Error()
+	default:
+		authenticated.Status, authenticated.Reason, authenticated.Message = metav1.ConditionUnknown, "ProbeFailed", err.Error()
+		zoneFound.Status, zoneFound.Reason, zoneFound.Message = metav1.ConditionUnknown, "ProbeFailed", err.Error()
+	}
+	authenticated.ObservedGeneration = p.GetGeneration()
+	zoneFound.ObservedGeneration = p.GetGeneration()
+	meta.SetStatusCondition(&p.GetStatus().Conditions, authenticated)
+	meta.SetStatusCondition(&p.GetStatus().Conditions, zoneFound)
+}
+
+// prune deletes records on the provider side which carry the ownership marker but are not referenced by any Record
+func (r *ProviderReconciler[T]) prune(ctx context.Context, p dnsv1.ProviderObject, dnsProvider provider.DNSProvider) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	spec := p.GetSpec().Prune
+	interval := spec.Interval.Duration
+	if interval <= 0 {
+		interval = DefaultPruneInterval
+	}
+	gracePeriod := spec.GracePeriod.Duration
+	if gracePeriod <= 0 {
+		gracePeriod = DefaultPruneGracePeriod
+	}
+
+	status := p.GetStatus().Prune
+	if status == nil {
+		status = &dnsv1.ProviderPruneStatus{}
+		p.GetStatus().Prune = status
+	}
+	now := metav1.Now()
+	status.LastPruneTime = &now
+	status.Message = ""
+
+	lister, ok := dnsProvider.(provider.DNSProviderLister)
+	if !ok {
+		status.Message = ErrorPruneNotSupported.Error()
+		status.Orphans = nil
+		return ctrl.Result{}, nil
+	}
+
+	remoteRecords, err := lister.List(ctx)
+	if err != nil {
+		status.Message = err.Error()
+		return ctrl.Result{RequeueAfter: interval}, nil
+	}
+
+	recordList := &dnsv1.RecordList{}
+	if err := r.List(ctx, recordList, client.InNamespace(p.GetNamespace()), client.MatchingFields{providersField: (&dnsv1.NamespacedName{Namespace: p.GetNamespace(), Name: p.GetName()}).String()}); err != nil {
+		return ctrl.Result{}, err
+	}
+	referenced := make(map[string]bool)
+	for _, record := range recordList.Items {
+		providerStatus := record.Status.FindProviderStatus(dnsv1.NamespacedName{Namespace: p.GetNamespace(), Name: p.GetName()})
+		if providerStatus != nil && providerStatus.RecordID != "" {
+			referenced[providerStatus.RecordID] = true
+		}
+	}
+	status.Retained = listedRetained(status.Retained, remoteRecords)
+	for _, id := range status.Retained {
+		referenced[id] = true
+	}
+
+	orphans, expired := findOrphans(remoteRecords, referenced, status.Orphans, now, gracePeriod)
+	for i := range expired {
+		orphan, remoteRecord := expired[i].orphan, &expired[i].record
+		payload := &provider.DnsProviderPayload{Id: orphan.ID, Record: &remoteRecord.Record}
+		if err := dnsProvider.Delete(ctx, payload); err != nil {
+			logger.Error(err, "failed to prune orphaned record", "id", orphan.ID, "name", orphan.Name)
+			status.Message = err.Error()
+			orphans = append(orphans, orphan)
+			continue
+		}
+		logger.Info("pruned orphaned record", "id", orphan.ID, "name", orphan.Name, "type", orphan.Type)
+		status.Pruned++
+	}
+	status.Orphans = orphans
+
+	return ctrl.Result{RequeueAfter: interval}, nil
+}
+
+// expiredOrphan is an orphaned record whose grace period expired
+type expiredOrphan struct {
+	orphan dnsv1.ProviderOrphanRecord
+	record provider.DnsProviderRecord
+}
+
+// findOrphans returns the remote records which are not referenced, split into the ones still in their grace period
+// and the expired ones to delete. An orphan keeps the time it was first seen in the previous scans
+func findOrphans(remoteRecords []provider.DnsProviderRecord, referenced map[string]bool, seen []dnsv1.ProviderOrphanRecord, now metav1.Time, gracePeriod time.Duration) (waiting []dnsv1.ProviderOrphanRecord, expired []expiredOrphan) {
+	waiting = make([]dnsv1.ProviderOrphanRecord, 0)
+	for _, remoteRecord := range remoteRecords {
+		if referenced[remoteRecord.Id] {
+			continue
+		}
+		orphan := dnsv1.ProviderOrphanRecord{
+			ID:        remoteRecord.Id,
+			Name:      remoteRecord.Record.Name,
+			Type:      remoteRecord.Record.Type,
+			Value:     remoteRecord.Record.Value,
+			FirstSeen: now,
+		}
+		for _, previous := range seen {
+			if previous.ID == orphan.ID {
+				orphan.FirstSeen = previous.FirstSeen
+				break
+			}
+		}
+		if now.Sub(orphan.FirstSeen.Time) < gracePeriod {
+			waiting = append(waiting, orphan)
+			continue
+		}
+		expired = append(expired, expiredOrphan{orphan: orphan, record: remoteRecord})
+	}
+	return waiting, expired
+}
+
+// listedRetained drops the retained IDs which are not on the provider side anymore
+func listedRetained(retained []string, remoteRecords []provider.DnsProviderRecord) []string {
+	listed := make([]string, 0, len(retained))
+	for _, id := range retained {
+		if slices.ContainsFunc(remoteRecords, func(remoteRecord provider.DnsProviderRecord) bool { return remoteRecord.Id == id }) {
+			listed = append(listed, id)
+		}
+	}
+	if len(listed) == 0 {
+		return nil
+	}
+	return listed
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -0,0 +1,104 @@
+package dns
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+	"github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider"
+)
+
+func TestFindOrphans(t *testing.T) {
+	now := metav1.Now()
+	gracePeriod := 10 * time.Minute
+	remote := func(ids ...string) []provider.DnsProviderRecord {
+		records := make([]provider.DnsProviderRecord, len(ids))
+		for i, id := range ids {
+			records[i] = provider.DnsProviderRecord{Id: id, Record: dnsv1.RecordSpec{Name: id + ".example.com", Type: dnsv1.RecordTypeA}}
+		}
+		return records
+	}
+	seenAt := func(id string, ago time.Duration) dnsv1.ProviderOrphanRecord {
+		return dnsv1.ProviderOrphanRecord{ID: id, FirstSeen: metav1.NewTime(now.Add(-ago))}
+	}
+
+	tests := []struct {
+		name       string
+		remote     []provider.DnsProviderRecord
+		referenced map[string]bool
+		seen       []dnsv1.ProviderOrphanRecord
+		waiting    []string
+		expired    []string
+	}{
+		{name: "all referenced", remote: remote("a", "b"), referenced: map[string]bool{"a": true, "b": true}},
+		{name: "first seen", remote: remote("a", "b"), referenced: map[string]bool{"a": true}, waiting: []string{"b"}},
+		{name: "in grace period", remote: remote("a"), seen: []dnsv1.ProviderOrphanRecord{seenAt("a", 5*time.Minute)}, waiting: []string{"a"}},
+		{name: "grace period expired", remote: remote("a"), seen: []dnsv1.ProviderOrphanRecord{seenAt("a", 10*time.Minute)}, expired: []string{"a"}},
+		{name: "referenced again", remote: remote("a"), referenced: map[string]bool{"a": true}, seen: []dnsv1.ProviderOrphanRecord{seenAt("a", time.Hour)}},
+		{name: "gone from provider", remote: remote("b"), seen: []dnsv1.ProviderOrphanRecord{seenAt("a", time.Hour)}, waiting: []string{"b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waiting, expired := findOrphans(tt.remote, tt.referenced, tt.seen, now, gracePeriod)
+			waitingIDs := make([]string, 0)
+			for _, orphan := range waiting {
+				waitingIDs = append(waitingIDs, orphan.ID)
+				for _, previous := range tt.seen {
+					if previous.ID == orphan.ID && !previous.FirstSeen.Equal(&orphan.FirstSeen) {
+						t.Errorf("orphan %s lost the time it was first seen", orphan.ID)
+					}
+				}
+			}
+			expiredIDs := make([]string, 0)
+			for _, orphan := range expired {
+				expiredIDs = append(expiredIDs, orphan.orphan.ID)
+				if orphan.record.Id != orphan.orphan.ID {
+					t.Errorf("expired orphan %s has the record %s", orphan.orphan.ID, orphan.record.Id)
+				}
+			}
+			if !slices.Equal(waitingIDs, tt.waiting) {
+				t.Errorf("waiting = %v, want %v", waitingIDs, tt.waiting)
+			}
+			if !slices.Equal(expiredIDs, tt.expired) {
+				t.Errorf("expired = %v, want %v", expiredIDs, tt.expired)
+			}
+		})
+	}
+}
+
+func TestListedRetained(t *testing.T) {
+	remote := []provider.DnsProviderRecord{{Id: "a"}, {Id: "c"}}
+	if got := listedRetained([]string{"a", "b", "c"}, remote); !slices.Equal(got, []string{"a", "c"}) {
+		t.Errorf("listedRetained = %v, want [a c]", got)
+	}
+	if got := listedRetained([]string{"b"}, remote); got != nil {
+		t.Errorf("listedRetained = %v, want nil", got)
+	}
+}
+
+func TestHealthCheckRetry(t *testing.T) {
+	now := time.Now()
+	ready := func(status metav1.ConditionStatus, since time.Duration) []metav1.Condition {
+		return []metav1.Condition{{Type: dnsv1.ProviderConditionReady, Status: status, LastTransitionTime: metav1.NewTime(now.Add(-since))}}
+	}
+	tests := []struct {
+		name       string
+		conditions []metav1.Condition
+		wants      time.Duration
+	}{
+		{name: "first failure", wants: MinHealthCheckRetry},
+		{name: "was ready", conditions: ready(metav1.ConditionTrue, time.Hour), wants: MinHealthCheckRetry},
+		{name: "not ready for a while", conditions: ready(metav1.ConditionFalse, time.Minute), wants: time.Minute},
+		{name: "not ready for long", conditions: ready(metav1.ConditionFalse, time.Hour), wants: DefaultHealthCheckInterval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := healthCheckRetry(tt.conditions, now); got != tt.wants {
+				t.Errorf("healthCheckRetry = %s, want %s", got, tt.wants)
+			}
+		})
+	}
+}
@@ -18,13 +18,23 @@ package dns
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
 	"strings"
 	"time"
 
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -50,13 +60,19 @@ type RecordReconciler struct {
 	client.Client
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
+	Registry *provider.Registry
+	// Optional, used by providers which need APIs the client does not support
+	Clientset kubernetes.Interface
 }
 
 // +kubebuilder:rbac:groups=dns.xzzpig.com,resources=records,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=dns.xzzpig.com,resources=records/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=dns.xzzpig.com,resources=records/finalizers,verbs=update
+// +kubebuilder:rbac:groups=dns.xzzpig.com,resources=dnspolicies,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 // +kubebuilder:rbac:groups="batch",resources=jobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups="",resources=pods/log,verbs=get
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -70,6 +86,9 @@ type RecordReconciler struct {
 func (r *RecordReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
 	ctx = context.WithValue(ctx, provider.CtxKeyClient, r.Client)
+	if r.Clientset != nil {
+		ctx = context.WithValue(ctx, provider.CtxKeyClientset, r.Clientset)
+	}
 
 	record := &dnsv1.Record{}
 	if err := r.Get(ctx, req.NamespacedName, record); err != nil {
@@ -100,14 +119,25 @@ func (r *RecordReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		providers = append(providers, &provider)
 	}
 
-	//handle matched providers
-	for _, provider := range providers {
-		if ok, err := provider.GetSpec().Selector.Matches(record); err != nil {
-			return ctrl.Result{}, err
-		} else if !ok {
-			continue
-		}
+	sameNameRecords, err := r.listSameNameRecords(ctx, record)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	conflictRecords := filterConflictRecords(sameNameRecords, record)
+	var conflictMessages []string
+
+	policyErr, err := r.checkPolicies(ctx, record)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	selectedProviders, err := dnsv1.SelectProviders(providers, record)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
 
+	//handle matched providers
+	for _, provider := range selectedProviders {
 		providerStatus := record.Status.FindProviderStatus(dnsv1.NamespacedName{Namespace: provider.GetNamespace(), Name: provider.GetName()})
 		if providerStatus == nil {
 			providerStatus = &dnsv1.RecordProviderStatus{NamespacedName: dnsv1.NamespacedName{Namespace: provider.GetNamespace(), Name: provider.GetName()}}
@@ -115,18 +145,49 @@ func (r *RecordReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		}
 		providerStatus.Checked = true
 
-		dnsProvider := providerCache[provider.GetUID()]
-		if dnsProvider == nil || dnsProvider.Generation != provider.GetGeneration() {
+		dnsProvider, release := r.Registry.Get(provider)
+		if dnsProvider == nil {
 			providerStatus.Message = "provider not ready"
 			continue
 		}
+		defer release()
+
+		if record.DeletionTimestamp.IsZero() && provider.GetDeletionTimestamp().IsZero() {
+			if policyErr != nil {
+				providerStatus.Message = "policy violation: " + policyErr.Error()
+				continue
+			}
+			if conflict := findConflictRecord(conflictRecords, record, provider); conflict != nil {
+				message := fmt.Sprintf("conflicts with Record %s/%s on provider %s", conflict.Namespace, conflict.Name, providerStatus.NamespacedName.String())
+				if err := r.withdraw(ctx, dnsProvider, record, providerStatus, conflict); err != nil {
+					message += ", failed to withdraw the pushed record: " + err.Error()
+				}
+				providerStatus.Message = message
+				conflictMessages = append(conflictMessages, message)
+				continue
+			}
+			if err := checkCapabilities(provider, sameNameRecords, record); err != nil {
+				providerStatus.Message = "unsupported by provider: " + err.Error()
+				continue
+			}
+		}
 
 		payload := NewPayload(providerStatus, &record.Spec)
+		payload.Object = record
 		if !record.DeletionTimestamp.IsZero() || !provider.GetDeletionTimestamp().IsZero() { // delete
 			if providerStatus.RecordID == "" { // already deleted or not yet created
 				providerStatus.Success(providerStatus.RecordID, providerStatus.Data)
 				continue
 			}
+			if record.Spec.GetDeletionPolicy(provider.GetSpec()) == dnsv1.DeletionPolicyRetain {
+				if err := r.markRetained(ctx, provider, providerStatus.RecordID); err != nil {
+					providerStatus.Error(providerStatus.RecordID, providerStatus.Data, err)
+					continue
+				}
+				providerStatus.Success("", "")
+				r.Recorder.Eventf(record, corev1.EventTypeNormal, "Retained", "Record is retained by provider %s", providerStatus.NamespacedName.String())
+				continue
+			}
 			if err := dnsProvider.Delete(ctx, payload); err != nil {
 				providerStatus.Error(payload.Id, payload.Data, err)
 				r.Recorder.Eventf(record, corev1.EventTypeWarning, "Failed", "Failed to delete record by provider %s", providerStatus.NamespacedName.String())
@@ -164,13 +225,21 @@ func (r *RecordReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 			providerStatus.Error(providerStatus.RecordID, providerStatus.Data, err)
 			continue
 		}
-		if providerStatus.RecordID != "" && provider != nil {
-			dnsProvider := providerCache[provider.GetUID()]
-			if dnsProvider == nil || dnsProvider.Generation != provider.GetGeneration() {
+		if providerStatus.RecordID != "" && provider != nil && record.Spec.GetDeletionPolicy(provider.GetSpec()) == dnsv1.DeletionPolicyRetain {
+			if err := r.markRetained(ctx, provider, providerStatus.RecordID); err != nil {
+				providerStatus.Error(providerStatus.RecordID, providerStatus.Data, err)
+				continue
+			}
+			r.Recorder.Eventf(record, corev1.EventTypeNormal, "Retained", "Record is retained by provider %s", providerStatus.NamespacedName.String())
+		} else if providerStatus.RecordID != "" && provider != nil {
+			dnsProvider, release := r.Registry.Get(provider)
+			if dnsProvider == nil {
 				providerStatus.Message = "provider not ready"
 				continue
 			}
+			defer release()
 			payload := NewPayload(providerStatus, &record.Spec)
+			payload.Object = record
 			if err := dnsProvider.Delete(ctx, payload); err != nil {
 				providerStatus.Error(payload.Id, payload.Data, err)
 				r.Recorder.Eventf(record, corev1.EventTypeWarning, "Failed", "Failed to delete record by provider %s", providerStatus.NamespacedName.String())
@@ -192,6 +261,46 @@ func (r *RecordReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		record.Status.Providers = newStatus
 	}
 
+	if len(conflictMessages) != 0 {
+		if !meta.IsStatusConditionTrue(record.Status.Conditions, dnsv1.RecordConditionConflict) {
+			r.Recorder.Event(record, corev1.EventTypeWarning, "Conflict", strings.Join(conflictMessages, "\n"))
+		}
+		meta.SetStatusCondition(&record.Status.Conditions, metav1.Condition{
+			Type:               dnsv1.RecordConditionConflict,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: record.Generation,
+			Reason:             "DuplicateRecord",
+			Message:            strings.Join(conflictMessages, "\n"),
+		})
+	} else {
+		meta.SetStatusCondition(&record.Status.Conditions, metav1.Condition{
+			Type:               dnsv1.RecordConditionConflict,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: record.Generation,
+			Reason:             "NoConflict",
+		})
+	}
+
+	if policyErr != nil {
+		if !meta.IsStatusConditionTrue(record.Status.Conditions, dnsv1.RecordConditionPolicyViolation) {
+			r.Recorder.Event(record, corev1.EventTypeWarning, "PolicyViolation", policyErr.Error())
+		}
+		meta.SetStatusCondition(&record.Status.Conditions, metav1.Condition{
+			Type:               dnsv1.RecordConditionPolicyViolation,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: record.Generation,
+			Reason:             "NotAllowed",
+			Message:            policyErr.Error(),
+		})
+	} else {
+		meta.SetStatusCondition(&record.Status.Conditions, metav1.Condition{
+			Type:               dnsv1.RecordConditionPolicyViolation,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: record.Generation,
+			Reason:             "Allowed",
+		})
+	}
+
 	record.Status.AllReady = true
 	record.Status.Message = ""
 	for _, providerStatus := range record.Status.Providers {
@@ -200,6 +309,11 @@ func (r *RecordReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 			record.Status.Message += providerStatus.Message + "\n"
 		}
 	}
+	if err := r.reconcileReverse(ctx, record); err != nil {
+		record.Status.AllReady = false
+		record.Status.Message += "failed to reconcile reverse record: " + err.Error() + "\n"
+		r.Recorder.Eventf(record, corev1.EventTypeWarning, "Failed", "Failed to reconcile reverse record: %s", err.Error())
+	}
 	record.Status.Message = strings.TrimSuffix(record.Status.Message, "\n")
 	if err := r.Status().Update(ctx, record); err != nil {
 		logger.Error(err, "failed to update record status")
@@ -220,6 +334,281 @@ func (r *RecordReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	return ctrl.Result{}, nil
 }
 
+// withdraw deletes the remote record a record pushed before it was blocked by the conflict,
+// unless the provider shares it with the conflict, e.g. an identical entry it adopted
+func (r *RecordReconciler) withdraw(ctx context.Context, dnsProvider provider.DNSProvider, record *dnsv1.Record, providerStatus *dnsv1.RecordProviderStatus, conflict *dnsv1.Record) error {
+	if providerStatus.RecordID == "" {
+		return nil
+	}
+	if status := conflict.Status.FindProviderStatus(providerStatus.NamespacedName); status == nil || status.RecordID != providerStatus.RecordID {
+		payload := NewPayload(providerStatus, &record.Spec)
+		payload.Object = record
+		if err := dnsProvider.Delete(ctx, payload); err != nil {
+			return err
+		}
+	}
+	providerStatus.Success("", "")
+	r.Recorder.Eventf(record, corev1.EventTypeNormal, "Withdrawn", "Record is withdrawn from provider %s, it conflicts with Record %s/%s", providerStatus.NamespacedName.String(), conflict.Namespace, conflict.Name)
+	return nil
+}
+
+// reconcileReverse creates, updates or deletes the PTR Record owned by the record
+func (r *RecordReconciler) reconcileReverse(ctx context.Context, record *dnsv1.Record) error {
+	reverse := &dnsv1.Record{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: record.Namespace, Name: reverseRecordName(record.Name)}, reverse)
+	if client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	found := err == nil
+	owned := found && metav1.IsControlledBy(reverse, record)
+
+	if !record.Spec.Reverse || !record.DeletionTimestamp.IsZero() || (record.Spec.Type != dnsv1.RecordTypeA && record.Spec.Type != dnsv1.RecordTypeAAAA) {
+		if owned && reverse.DeletionTimestamp.IsZero() {
+			return client.IgnoreNotFound(r.Delete(ctx, reverse))
+		}
+		return nil
+	}
+	if found && !owned {
+		return fmt.Errorf("Record %s already exists and is not owned by %s", reverse.Name, record.Name)
+	}
+
+	reverseName, err := record.Spec.ReverseName()
+	if err != nil {
+		return err
+	}
+	if !found {
+		reverse.Name = reverseRecordName(record.Name)
+		reverse.Namespace = record.Namespace
+	}
+	oldReverse := reverse.DeepCopy()
+	reverse.Labels = reverseLabels(record)
+	reverse.Spec = dnsv1.RecordSpec{
+		Name:           reverseName,
+		Type:           dnsv1.RecordTypePTR,
+		Value:          strings.TrimSuffix(record.Spec.Name, ".") + ".",
+		TTL:            record.Spec.TTL,
+		DeletionPolicy: record.Spec.DeletionPolicy,
+	}
+	if err := ctrl.SetControllerReference(record, reverse, r.Scheme); err != nil {
+		return err
+	}
+
+	if !found {
+		if err := r.Create(ctx, reverse); err != nil {
+			return err
+		}
+		r.Recorder.Eventf(record, corev1.EventTypeNormal, "Created", "Reverse Record %s is created", reverse.Name)
+		return nil
+	}
+	if equality.Semantic.DeepEqual(oldReverse.Labels, reverse.Labels) && equality.Semantic.DeepEqual(oldReverse.Spec, reverse.Spec) {
+		return nil
+	}
+	return r.Update(ctx, reverse)
+}
+
+// reverseRecordName returns the name of the PTR Record of the Record with the given name,
+// a name too long for the suffix is shortened and kept unique by a hash of the full name
+func reverseRecordName(name string) string {
+	if len(name)+len(reverseRecordSuffix) <= validation.DNS1123SubdomainMaxLength {
+		return name + reverseRecordSuffix
+	}
+	sum := sha256.Sum256([]byte(name))
+	hash := hex.EncodeToString(sum[:4])
+	prefix := strings.TrimRight(name[:validation.DNS1123SubdomainMaxLength-len(reverseRecordSuffix)-len(hash)-1], ".-")
+	return prefix + "-" + hash + reverseRecordSuffix
+}
+
+// reverseLabels returns the labels of the PTR Record: the labels of the record so it is selected by the same providers,
+// except the cluster a mirrored Record comes from, the PTR Record is not mirrored
+func reverseLabels(record *dnsv1.Record) map[string]string {
+	labels := make(map[string]string, len(record.Labels)+1)
+	for k, v := range record.Labels {
+		if k == dnsv1.LabelCluster {
+			continue
+		}
+		labels[k] = v
+	}
+	labels[dnsv1.LabelReverseOf] = ""
+	if len(validation.IsValidLabelValue(record.Name)) == 0 {
+		labels[dnsv1.LabelReverseOf] = record.Name
+	}
+	return labels
+}
+
+// markRetained excludes a record retained on the provider side from the pruning of the provider,
+// it still carries the ownership marker but is not referenced by any Record anymore
+func (r *RecordReconciler) markRetained(ctx context.Context, provider dnsv1.ProviderObject, id string) error {
+	if prune := provider.GetSpec().Prune; prune == nil || !prune.Enabled || id == "" {
+		return nil
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest := provider.New()
+		if err := r.Get(ctx, client.ObjectKeyFromObject(provider), latest); err != nil {
+			return err
+		}
+		status := latest.GetStatus()
+		if status.Prune == nil {
+			status.Prune = &dnsv1.ProviderPruneStatus{}
+		}
+		if slices.Contains(status.Prune.Retained, id) {
+			return nil
+		}
+		status.Prune.Retained = append(status.Prune.Retained, id)
+		return r.Status().Update(ctx, latest)
+	})
+}
+
+// checkPolicies returns the policy violation of the record, if any
+func (r *RecordReconciler) checkPolicies(ctx context.Context, record *dnsv1.Record) (violation error, err error) {
+	policyList := &dnsv1.DNSPolicyList{}
+	if err := r.List(ctx, policyList); err != nil {
+		return nil, err
+	}
+	if len(policyList.Items) == 0 {
+		return nil, nil
+	}
+	namespace := &corev1.Namespace{}
+	if err := r.Get(ctx, client.ObjectKey{Name: record.Namespace}, namespace); err != nil {
+		return nil, err
+	}
+	return policyList.Validate(namespace.Labels, &record.Spec), nil
+}
+
+func (r *RecordReconciler) watchForPolicies(ctx context.Context, o client.Object) []reconcile.Request {
+	recordList := &dnsv1.RecordList{}
+	if err := r.List(ctx, recordList); err != nil {
+		return []reconcile.Request{}
+	}
+
+	requests := make([]reconcile.Request, len(recordList.Items))
+	for i, record := range recordList.Items {
+		requests[i] = reconcile.Request{NamespacedName: types.NamespacedName{Namespace: record.Namespace, Name: record.Name}}
+	}
+	return requests
+}
+
+// listSameNameRecords lists the Records which have the same name as the record, including itself
+func (r *RecordReconciler) listSameNameRecords(ctx context.Context, record *dnsv1.Record) ([]dnsv1.Record, error) {
+	recordList := &dnsv1.RecordList{}
+	if err := r.List(ctx, recordList, client.MatchingFields{recordNameField: strings.ToLower(record.Spec.Name)}); err != nil {
+		return nil, err
+	}
+	return recordList.Items, nil
+}
+
+// filterConflictRecords returns the other records which conflict with the record
+func filterConflictRecords(records []dnsv1.Record, record *dnsv1.Record) []dnsv1.Record {
+	conflicts := make([]dnsv1.Record, 0)
+	for _, other := range records {
+		if other.UID == record.UID {
+			continue
+		}
+		if other.Spec.ConflictsWith(&record.Spec) {
+			conflicts = append(conflicts, other)
+		}
+	}
+	return conflicts
+}
+
+// checkCapabilities checks the record against the capabilities declared by the provider
+func checkCapabilities(provider dnsv1.ProviderObject, sameNameRecords []dnsv1.Record, record *dnsv1.Record) error {
+	caps := provider.GetStatus().Capabilities
+	if err := caps.Check(&record.Spec); err != nil {
+		return err
+	}
+	if caps == nil || caps.MaxRecordsPerName == 0 {
+		return nil
+	}
+	// only the records holding a remote record on the provider count, not the ones pushed to a preferred
+	// Exclusive provider or stopped by a policy violation or conflict. A record already pushed keeps its place
+	key := dnsv1.NamespacedName{Namespace: provider.GetNamespace(), Name: provider.GetName()}
+	if own := record.Status.FindProviderStatus(key); own != nil && own.RecordID != "" {
+		return nil
+	}
+	count := 1
+	for i := range sameNameRecords {
+		other := &sameNameRecords[i]
+		if other.UID == record.UID {
+			continue
+		}
+		if status := other.Status.FindProviderStatus(key); status != nil && status.RecordID != "" {
+			count++
+		}
+	}
+	if count > caps.MaxRecordsPerName {
+		return fmt.Errorf("at most %d records named %s are supported", caps.MaxRecordsPerName, record.Spec.Name)
+	}
+	return nil
+}
+
+// pushedProviders returns the providers holding a remote record of the record
+func pushedProviders(record *dnsv1.Record) []string {
+	var providers []string
+	for _, status := range record.Status.Providers {
+		if status != nil && status.RecordID != "" {
+			providers = append(providers, status.NamespacedName.String())
+		}
+	}
+	slices.Sort(providers)
+	return providers
+}
+
+// pushedChangedPredicate passes the status updates changing the providers a Record is pushed to,
+// the conflicting Records of the same name decide again which one holds the remote record
+func pushedChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldRecord, ok := e.ObjectOld.(*dnsv1.Record)
+			if !ok {
+				return false
+			}
+			newRecord, ok := e.ObjectNew.(*dnsv1.Record)
+			if !ok {
+				return false
+			}
+			return !slices.Equal(pushedProviders(oldRecord), pushedProviders(newRecord))
+		},
+	}
+}
+
+// findConflictRecord finds the conflict record holding the remote record on the provider.
+// Only the records pushed to the provider count, so a record stopped by a policy violation or its own conflict
+// never blocks another one. A record which is not pushed yet yields to any pushed one, a pushed one to the older ones,
+// withdrawing its remote record
+func findConflictRecord(conflicts []dnsv1.Record, record *dnsv1.Record, provider dnsv1.ProviderObject) *dnsv1.Record {
+	key := dnsv1.NamespacedName{Namespace: provider.GetNamespace(), Name: provider.GetName()}
+	own := record.Status.FindProviderStatus(key)
+	pushed := own != nil && own.RecordID != ""
+	for i := range conflicts {
+		conflict := &conflicts[i]
+		status := conflict.Status.FindProviderStatus(key)
+		if status == nil || status.RecordID == "" {
+			continue
+		}
+		if !pushed || conflict.OlderThan(record) {
+			return conflict
+		}
+	}
+	return nil
+}
+
+func (r *RecordReconciler) watchForConflicts(ctx context.Context, o client.Object) []reconcile.Request {
+	record := o.(*dnsv1.Record)
+	recordList := &dnsv1.RecordList{}
+	if err := r.List(ctx, recordList, client.MatchingFields{recordNameField: strings.ToLower(record.Spec.Name)}); err != nil {
+		return []reconcile.Request{}
+	}
+
+	requests := []reconcile.Request{}
+	for _, other := range recordList.Items {
+		if other.UID == record.UID || !other.Spec.ConflictsWith(&record.Spec) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: other.Namespace, Name: other.Name}})
+	}
+	return requests
+}
+
 func (r *RecordReconciler) getProvider(ctx context.Context, key types.NamespacedName, provider *dnsv1.ProviderObject) error {
 	var obj dnsv1.ProviderObject
 	if key.Namespace == "" {
@@ -276,6 +665,51 @@ func (r *RecordReconciler) getProviderWatchPredicates() builder.Predicates {
 		})
 }
 
+// watchForJobs enqueues the Record a Job of the JOB provider was created for
+func (r *RecordReconciler) watchForJobs(ctx context.Context, o client.Object) []reconcile.Request {
+	namespace, name, ok := strings.Cut(o.GetAnnotations()[provider.AnnotationJobRecord], string(types.Separator))
+	if !ok {
+		namespace, name = o.GetLabels()[provider.LabelJobRecordNamespace], o.GetLabels()[provider.LabelJobRecord]
+	}
+	if name == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: namespace, Name: name}}}
+}
+
+func jobFinished(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if (condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// getJobWatchPredicates passes the Jobs of the JOB provider once they complete or fail
+func (r *RecordReconciler) getJobWatchPredicates() builder.Predicates {
+	return builder.WithPredicates(
+		predicate.Funcs{
+			CreateFunc: func(e event.CreateEvent) bool { return false },
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				oldJob, ok := e.ObjectOld.(*batchv1.Job)
+				if !ok {
+					return false
+				}
+				newJob, ok := e.ObjectNew.(*batchv1.Job)
+				if !ok {
+					return false
+				}
+				if _, ok := newJob.Labels[provider.LabelJobAction]; !ok {
+					return false
+				}
+				return jobFinished(newJob) && !jobFinished(oldJob)
+			},
+			DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+			GenericFunc: func(e event.GenericEvent) bool { return false },
+		})
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *RecordReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &dnsv1.Record{}, providersField, func(o client.Object) []string {
@@ -292,13 +726,28 @@ func (r *RecordReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &dnsv1.Record{}, recordNameField, func(o client.Object) []string {
+		return []string{strings.ToLower(o.(*dnsv1.Record).Spec.Name)}
+	}); err != nil {
+		return err
+	}
+
+	// not an event filter, the status changes of the Jobs would be filtered out
+	changed := builder.WithPredicates(predicate.Or(
+		predicate.GenerationChangedPredicate{},
+		predicate.LabelChangedPredicate{},
+	))
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&dnsv1.Record{}).
-		Watches(&dnsv1.Provider{}, handler.EnqueueRequestsFromMapFunc(r.watchForProviders), r.getProviderWatchPredicates()).
-		Watches(&dnsv1.ClusterProvider{}, handler.EnqueueRequestsFromMapFunc(r.watchForProviders), r.getProviderWatchPredicates()).
-		WithEventFilter(predicate.Or(
+		For(&dnsv1.Record{}, changed).
+		Owns(&dnsv1.Record{}, changed).
+		Watches(&dnsv1.Record{}, handler.EnqueueRequestsFromMapFunc(r.watchForConflicts), builder.WithPredicates(predicate.Or(
 			predicate.GenerationChangedPredicate{},
 			predicate.LabelChangedPredicate{},
-		)).
+			pushedChangedPredicate(),
+		))).
+		Watches(&dnsv1.DNSPolicy{}, handler.EnqueueRequestsFromMapFunc(r.watchForPolicies), changed).
+		Watches(&dnsv1.Provider{}, handler.EnqueueRequestsFromMapFunc(r.watchForProviders), changed, r.getProviderWatchPredicates()).
+		Watches(&dnsv1.ClusterProvider{}, handler.EnqueueRequestsFromMapFunc(r.watchForProviders), changed, r.getProviderWatchPredicates()).
+		Watches(&batchv1.Job{}, handler.EnqueueRequestsFromMapFunc(r.watchForJobs), r.getJobWatchPredicates()).
 		Complete(r)
 }
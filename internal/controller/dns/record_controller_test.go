@@ -18,16 +18,26 @@ package dns
 
 import (
 	"context"
+	"strings"
+	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+	"github.com/xzzpig/kube-dns-manager/internal/controller/dns/provider"
 )
 
 var _ = Describe("Record Controller", func() {
@@ -69,8 +79,9 @@ var _ = Describe("Record Controller", func() {
 		It("should successfully reconcile the resource", func() {
 			By("Reconciling the created resource")
 			controllerReconciler := &RecordReconciler{
-				Client: k8sClient,
-				Scheme: k8sClient.Scheme(),
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Registry: provider.NewRegistry(),
 			}
 
 			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
@@ -82,3 +93,214 @@ var _ = Describe("Record Controller", func() {
 		})
 	})
 })
+
+func TestFindConflictRecord(t *testing.T) {
+	now := time.Now()
+	provider := &dnsv1.ClusterProvider{ObjectMeta: metav1.ObjectMeta{Name: "cloudflare"}}
+	record := func(namespace string, created time.Time, recordID string) dnsv1.Record {
+		r := dnsv1.Record{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "login", UID: types.UID(namespace), CreationTimestamp: metav1.NewTime(created)},
+			Spec:       dnsv1.RecordSpec{Name: "login.example.com", Type: dnsv1.RecordTypeCNAME, Value: namespace + ".example.com"},
+		}
+		if recordID != "" {
+			r.Status.Providers = []*dnsv1.RecordProviderStatus{{NamespacedName: dnsv1.NamespacedName{Name: "cloudflare"}, RecordID: recordID}}
+		}
+		return r
+	}
+
+	tests := []struct {
+		name     string
+		record   dnsv1.Record
+		others   []dnsv1.Record
+		conflict string
+	}{
+		{name: "older record pushed", record: record("new", now, ""), others: []dnsv1.Record{record("old", now.Add(-time.Hour), "1")}, conflict: "old"},
+		{name: "older record blocked", record: record("new", now, ""), others: []dnsv1.Record{record("old", now.Add(-time.Hour), "")}},
+		{name: "newer record pushed first", record: record("old", now.Add(-time.Hour), ""), others: []dnsv1.Record{record("new", now, "1")}, conflict: "new"},
+		{name: "both pushed, older wins", record: record("old", now.Add(-time.Hour), "1"), others: []dnsv1.Record{record("new", now, "2")}},
+		{name: "both pushed, newer yields", record: record("new", now, "2"), others: []dnsv1.Record{record("old", now.Add(-time.Hour), "1")}, conflict: "old"},
+		{name: "pushed to another provider", record: record("new", now, ""), others: []dnsv1.Record{func() dnsv1.Record {
+			r := record("old", now.Add(-time.Hour), "1")
+			r.Status.Providers[0].Name = "alidns"
+			return r
+		}()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conflicts := filterConflictRecords(append(tt.others, tt.record), &tt.record)
+			conflict := findConflictRecord(conflicts, &tt.record, provider)
+			switch {
+			case conflict == nil && tt.conflict != "":
+				t.Errorf("no conflict, want %s", tt.conflict)
+			case conflict != nil && conflict.Namespace != tt.conflict:
+				t.Errorf("conflict with %s, want %q", conflict.Namespace, tt.conflict)
+			}
+		})
+	}
+}
+
+func TestReverseRecordName(t *testing.T) {
+	if got := reverseRecordName("node-1"); got != "node-1-ptr" {
+		t.Errorf("reverseRecordName = %q, want node-1-ptr", got)
+	}
+	long := strings.Repeat("a", 200) + "." + strings.Repeat("b", 52)
+	got := reverseRecordName(long)
+	if errs := validation.IsDNS1123Subdomain(got); len(errs) != 0 {
+		t.Errorf("reverseRecordName(%q) = %q is not a valid name: %v", long, got, errs)
+	}
+	if other := reverseRecordName(strings.Repeat("a", 200) + "." + strings.Repeat("c", 52)); other == got {
+		t.Errorf("reverse names of different Records are equal: %q", got)
+	}
+}
+
+func TestReverseLabels(t *testing.T) {
+	record := &dnsv1.Record{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{
+		"dns.xzzpig.com/scope": "internal",
+		dnsv1.LabelCluster:     "east",
+		"app":                  "node",
+	}}}
+	labels := reverseLabels(record)
+	if len(labels) != 3 || labels["app"] != "node" || labels["dns.xzzpig.com/scope"] != "internal" || labels[dnsv1.LabelReverseOf] != "node-1" {
+		t.Errorf("unexpected labels %v", labels)
+	}
+
+	record.Name = strings.Repeat("a", 64)
+	if value, ok := reverseLabels(record)[dnsv1.LabelReverseOf]; !ok || value != "" {
+		t.Errorf("expected an empty %s label for a name longer than a label value, got %q", dnsv1.LabelReverseOf, value)
+	}
+}
+
+func TestCheckCapabilities(t *testing.T) {
+	provider := &dnsv1.ClusterProvider{
+		ObjectMeta: metav1.ObjectMeta{Name: "limited"},
+		Status:     dnsv1.ProviderStatus{Capabilities: &dnsv1.ProviderCapabilities{MaxRecordsPerName: 2}},
+	}
+	record := func(uid string, pushedTo string) dnsv1.Record {
+		r := dnsv1.Record{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: uid, UID: types.UID(uid)},
+			Spec:       dnsv1.RecordSpec{Name: "api.example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0." + uid},
+		}
+		if pushedTo != "" {
+			r.Status.Providers = []*dnsv1.RecordProviderStatus{{NamespacedName: dnsv1.NamespacedName{Name: pushedTo}, RecordID: uid}}
+		}
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		record  dnsv1.Record
+		others  []dnsv1.Record
+		wantErr bool
+	}{
+		{name: "below the limit", record: record("3", ""), others: []dnsv1.Record{record("1", "limited")}},
+		{name: "limit reached", record: record("3", ""), others: []dnsv1.Record{record("1", "limited"), record("2", "limited")}, wantErr: true},
+		{name: "others pushed elsewhere", record: record("3", ""), others: []dnsv1.Record{record("1", "preferred"), record("2", "")}},
+		{name: "already pushed", record: record("3", "limited"), others: []dnsv1.Record{record("1", "limited"), record("2", "limited")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCapabilities(provider, append(tt.others, tt.record), &tt.record)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkCapabilities = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// countingProvider counts the records deleted by the Records
+type countingProvider struct {
+	deleted []string
+}
+
+func (p *countingProvider) Create(ctx context.Context, payload *provider.DnsProviderPayload) error {
+	payload.Id = payload.Record.Value
+	return nil
+}
+func (p *countingProvider) Update(ctx context.Context, payload *provider.DnsProviderPayload) error {
+	return nil
+}
+func (p *countingProvider) Delete(ctx context.Context, payload *provider.DnsProviderPayload) error {
+	p.deleted = append(p.deleted, payload.Id)
+	payload.Id = ""
+	return nil
+}
+
+func TestWithdrawBlockedRecord(t *testing.T) {
+	const providerType dnsv1.ProviderType = "RECORD_TEST"
+	backend := &countingProvider{}
+	provider.Register(providerType, func(ctx context.Context, obj dnsv1.ProviderObject) (provider.DNSProvider, error) {
+		return backend, nil
+	}, dnsv1.ProviderCapabilities{})
+
+	scheme := runtime.NewScheme()
+	if err := dnsv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	clusterProvider := &dnsv1.ClusterProvider{ObjectMeta: metav1.ObjectMeta{Name: "test", UID: "provider", Generation: 1}, Spec: dnsv1.ProviderSpec{Type: providerType}}
+	now := time.Now()
+	newRecord := func(name string, created time.Time, recordID string) *dnsv1.Record {
+		return &dnsv1.Record{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID(name), CreationTimestamp: metav1.NewTime(created), Finalizers: []string{finalizerLabel}},
+			Spec:       dnsv1.RecordSpec{Name: "login.example.com", Type: dnsv1.RecordTypeCNAME, Value: name + ".example.com"},
+			Status: dnsv1.RecordStatus{Providers: []*dnsv1.RecordProviderStatus{
+				{NamespacedName: dnsv1.NamespacedName{Name: "test"}, RecordID: recordID},
+			}},
+		}
+	}
+	older, newer := newRecord("older", now.Add(-time.Hour), "older-id"), newRecord("newer", now, "newer-id")
+
+	cli := fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(clusterProvider, older, newer).
+		WithStatusSubresource(&dnsv1.Record{}).
+		WithIndex(&dnsv1.Record{}, recordNameField, func(o client.Object) []string {
+			return []string{strings.ToLower(o.(*dnsv1.Record).Spec.Name)}
+		}).Build()
+	registry := provider.NewRegistry()
+	if _, release, err := registry.Load(context.Background(), clusterProvider); err != nil {
+		t.Fatal(err)
+	} else {
+		release()
+	}
+	r := &RecordReconciler{Client: cli, Scheme: scheme, Recorder: record.NewFakeRecorder(10), Registry: registry}
+
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "newer"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.deleted) != 1 || backend.deleted[0] != "newer-id" {
+		t.Fatalf("deleted %v, want the record of the newer Record", backend.deleted)
+	}
+	latest := &dnsv1.Record{}
+	if err := cli.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "newer"}, latest); err != nil {
+		t.Fatal(err)
+	}
+	if status := latest.Status.Providers[0]; status.RecordID != "" || !strings.Contains(status.Message, "conflicts with Record default/older") {
+		t.Errorf("blocked Record kept id %q with message %q", status.RecordID, status.Message)
+	}
+
+	// the older Record keeps its remote record
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "older"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.deleted) != 1 {
+		t.Fatalf("deleted %v, want the older Record kept", backend.deleted)
+	}
+}
+
+func TestPushedChangedPredicate(t *testing.T) {
+	pushed := &dnsv1.Record{Status: dnsv1.RecordStatus{Providers: []*dnsv1.RecordProviderStatus{{NamespacedName: dnsv1.NamespacedName{Name: "test"}, RecordID: "1"}}}}
+	failed := pushed.DeepCopy()
+	failed.Status.Providers[0].Message = "failed"
+	withdrawn := pushed.DeepCopy()
+	withdrawn.Status.Providers[0].RecordID = ""
+
+	p := pushedChangedPredicate()
+	if p.Update(event.UpdateEvent{ObjectOld: pushed, ObjectNew: failed}) {
+		t.Error("passed a status update keeping the pushed providers")
+	}
+	if !p.Update(event.UpdateEvent{ObjectOld: pushed, ObjectNew: withdrawn}) {
+		t.Error("filtered out a withdrawn Record")
+	}
+	if !p.Update(event.UpdateEvent{ObjectOld: withdrawn, ObjectNew: pushed}) {
+		t.Error("filtered out a pushed Record")
+	}
+}
@@ -0,0 +1,367 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+)
+
+const (
+	// RemoteClusterResyncInterval is the interval the mirrored Records are fully resynced at
+	RemoteClusterResyncInterval = 10 * time.Minute
+	// RemoteClusterSyncTimeout is the time the initial list of the remote Records may take before the sync fails
+	RemoteClusterSyncTimeout = 30 * time.Second
+	// RemoteClusterSyncRetry is the interval a RemoteCluster is requeued at while the initial list is running
+	RemoteClusterSyncRetry = 5 * time.Second
+)
+
+// RemoteClusterReconciler mirrors the Records of remote clusters into the local cluster
+type RemoteClusterReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// APIReader reads the kubeconfig Secrets from the API server, so the Secrets are not cached by the manager.
+	// Defaults to the API reader of the manager
+	APIReader client.Reader
+
+	mu      sync.Mutex
+	remotes map[types.NamespacedName]*remoteCache
+	events  chan event.GenericEvent
+}
+
+// remoteCache is the running cache of the Records of a remote cluster
+type remoteCache struct {
+	cache.Cache
+	// identifies the RemoteCluster generation and kubeconfig the cache was built from
+	key    string
+	cancel context.CancelFunc
+
+	started time.Time
+	// set once the initial list of the remote Records is done
+	synced atomic.Bool
+}
+
+// checkSynced returns ErrorWaitRemoteRecords while the initial list of the remote Records is running,
+// and an error once it takes longer than RemoteClusterSyncTimeout
+func (c *remoteCache) checkSynced(now time.Time) error {
+	if c.synced.Load() {
+		return nil
+	}
+	if now.Sub(c.started) > RemoteClusterSyncTimeout {
+		return fmt.Errorf("timed out waiting for the Records of the remote cluster after %s", RemoteClusterSyncTimeout)
+	}
+	return ErrorWaitRemoteRecords
+}
+
+// +kubebuilder:rbac:groups=dns.xzzpig.com,resources=remoteclusters,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=dns.xzzpig.com,resources=remoteclusters/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=dns.xzzpig.com,resources=remoteclusters/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+
+// Reconcile syncs the local Records with the Records of the remote cluster selected by the RemoteCluster
+func (r *RemoteClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, _err error) {
+	logger := log.FromContext(ctx)
+
+	remote := &dnsv1.RemoteCluster{}
+	if err := r.Get(ctx, req.NamespacedName, remote); err != nil {
+		if apierrors.IsNotFound(err) {
+			// the mirrored Records are garbage collected through their owner reference
+			r.stopCache(req.NamespacedName)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	if !remote.DeletionTimestamp.IsZero() {
+		r.stopCache(req.NamespacedName)
+		return ctrl.Result{}, nil
+	}
+
+	defer func() {
+		if _err != nil {
+			remote.Status.Ready = false
+			remote.Status.Reason = _err.Error()
+			if !errors.Is(_err, ErrorWaitRemoteRecords) {
+				logger.Error(_err, "failed to sync remote cluster")
+				r.Recorder.Event(remote, corev1.EventTypeWarning, "SyncFailed", _err.Error())
+			}
+			_err = nil
+		} else {
+			remote.Status.Ready = true
+			remote.Status.Reason = ""
+		}
+		if err := r.Status().Update(ctx, remote); err != nil {
+			logger.Error(err, "failed to update status")
+		}
+	}()
+
+	remoteRecords, err := r.listRemoteRecords(ctx, remote)
+	if errors.Is(err, ErrorWaitRemoteRecords) {
+		// the end of the initial list triggers a sync, the requeue only notices a list running into the timeout
+		return ctrl.Result{RequeueAfter: RemoteClusterSyncRetry}, err
+	}
+	if err != nil {
+		return ctrl.Result{RequeueAfter: time.Minute}, err
+	}
+
+	changed, err := r.syncRecords(ctx, remote, remoteRecords)
+	if changed != 0 {
+		r.Recorder.Eventf(remote, corev1.EventTypeNormal, "Synced", "%d Records changed by cluster %s", changed, remote.GetClusterName())
+	}
+	remote.Status.Records = len(remoteRecords)
+	if err != nil {
+		return ctrl.Result{RequeueAfter: time.Minute}, err
+	}
+	now := metav1.Now()
+	remote.Status.LastSyncTime = &now
+	return ctrl.Result{RequeueAfter: RemoteClusterResyncInterval}, nil
+}
+
+// syncRecords creates, updates and deletes the local Records mirroring remoteRecords.
+// A Record failing to sync does not stop the others, the errors of all Records are joined
+func (r *RemoteClusterReconciler) syncRecords(ctx context.Context, remote *dnsv1.RemoteCluster, remoteRecords []dnsv1.Record) (changed int, _ error) {
+	recordList := &dnsv1.RecordList{}
+	if err := r.List(ctx, recordList, client.InNamespace(remote.Namespace), client.MatchingLabels{dnsv1.LabelCluster: remote.GetClusterName()}); err != nil {
+		return 0, err
+	}
+
+	var errs []error
+	for i := range remoteRecords {
+		record := remote.MirrorRecord(&remoteRecords[i])
+		if err := ctrl.SetControllerReference(remote, record, r.Scheme); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		oldRecord := recordList.Get(record.Namespace, record.Name)
+		if oldRecord == nil {
+			if err := r.Create(ctx, record); err != nil {
+				errs = append(errs, fmt.Errorf("failed to create record %s: %w", record.Name, err))
+				continue
+			}
+			changed++
+			continue
+		}
+		oldRecord.Status.Checked = true
+		if !metav1.IsControlledBy(oldRecord, remote) {
+			errs = append(errs, fmt.Errorf("record %s already exists and is not managed by the RemoteCluster", oldRecord.Name))
+			continue
+		}
+		if equality.Semantic.DeepEqual(oldRecord.Spec, record.Spec) &&
+			equality.Semantic.DeepEqual(oldRecord.Labels, record.Labels) &&
+			equality.Semantic.DeepEqual(oldRecord.Annotations, record.Annotations) {
+			continue
+		}
+		oldRecord.Labels = record.Labels
+		oldRecord.Annotations = record.Annotations
+		oldRecord.Spec = record.Spec
+		if err := r.Update(ctx, oldRecord); err != nil {
+			errs = append(errs, fmt.Errorf("failed to update record %s: %w", oldRecord.Name, err))
+			continue
+		}
+		changed++
+	}
+	for i := range recordList.Items {
+		record := &recordList.Items[i]
+		if record.Status.Checked || !metav1.IsControlledBy(record, remote) {
+			continue
+		}
+		if err := r.Delete(ctx, record); client.IgnoreNotFound(err) != nil {
+			errs = append(errs, fmt.Errorf("failed to delete record %s: %w", record.Name, err))
+			continue
+		}
+		changed++
+	}
+	return changed, errors.Join(errs...)
+}
+
+// listRemoteRecords lists the remote Records selected by the RemoteCluster.
+// Records mirrored from another cluster and reverse Records are skipped, the latter are recreated by the local Record controller.
+func (r *RemoteClusterReconciler) listRemoteRecords(ctx context.Context, remote *dnsv1.RemoteCluster) ([]dnsv1.Record, error) {
+	remoteCache, err := r.getCache(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	// never block a worker on the initial list, a slow or unreachable cluster would stall the other RemoteClusters
+	if err := remoteCache.checkSynced(time.Now()); err != nil {
+		return nil, err
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(&remote.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	recordList := &dnsv1.RecordList{}
+	if err := remoteCache.List(ctx, recordList, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+	records := make([]dnsv1.Record, 0, len(recordList.Items))
+	for _, record := range recordList.Items {
+		if _, ok := record.Labels[dnsv1.LabelCluster]; ok {
+			continue
+		}
+		if _, ok := record.Labels[dnsv1.LabelReverseOf]; ok {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// getCache returns the cache of the remote Records, (re)starting it if the RemoteCluster or its kubeconfig changed
+func (r *RemoteClusterReconciler) getCache(ctx context.Context, remote *dnsv1.RemoteCluster) (*remoteCache, error) {
+	secretKey := remote.Spec.KubeConfigSecretRef.Key
+	if secretKey == "" {
+		secretKey = "kubeconfig"
+	}
+	secret := &corev1.Secret{}
+	if err := r.APIReader.Get(ctx, client.ObjectKey{Namespace: remote.Namespace, Name: remote.Spec.KubeConfigSecretRef.Name}, secret); err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("%s/%d/%s", remote.UID, remote.Generation, secret.ResourceVersion)
+	name := types.NamespacedName{Namespace: remote.Namespace, Name: remote.Name}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if current := r.remotes[name]; current != nil {
+		if current.key == key {
+			return current, nil
+		}
+		current.cancel()
+		delete(r.remotes, name)
+	}
+
+	kubeconfig, ok := secret.Data[secretKey]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found in secret %s", secretKey, secret.Name)
+	}
+	config, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	options := cache.Options{Scheme: r.Scheme}
+	if remote.Spec.Namespace != "" {
+		options.DefaultNamespaces = map[string]cache.Config{remote.Spec.Namespace: {}}
+	}
+	c, err := cache.New(config, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// every change of a remote Record triggers a sync of the RemoteCluster
+	informer, err := c.GetInformer(ctx, &dnsv1.Record{})
+	if err != nil {
+		return nil, err
+	}
+	cacheCtx, cancel := context.WithCancel(context.Background())
+	trigger := func(any) {
+		obj := &dnsv1.RemoteCluster{ObjectMeta: metav1.ObjectMeta{Namespace: name.Namespace, Name: name.Name}}
+		select {
+		case r.events <- event.GenericEvent{Object: obj}:
+		case <-cacheCtx.Done():
+		}
+	}
+	if _, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    trigger,
+		UpdateFunc: func(_, newObj any) { trigger(newObj) },
+		DeleteFunc: trigger,
+	}); err != nil {
+		cancel()
+		return nil, err
+	}
+	current := &remoteCache{Cache: c, key: key, cancel: cancel, started: time.Now()}
+	go func() {
+		if err := c.Start(cacheCtx); err != nil {
+			log.FromContext(ctx).Error(err, "remote cache stopped", "cluster", remote.GetClusterName())
+		}
+	}()
+	go func() {
+		if c.WaitForCacheSync(cacheCtx) {
+			current.synced.Store(true)
+			trigger(nil)
+		}
+	}()
+
+	r.remotes[name] = current
+	return current, nil
+}
+
+func (r *RemoteClusterReconciler) stopCache(name types.NamespacedName) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if current := r.remotes[name]; current != nil {
+		current.cancel()
+		delete(r.remotes, name)
+	}
+}
+
+// Start implements manager.Runnable, it stops the caches of all remote clusters when the manager stops
+func (r *RemoteClusterReconciler) Start(ctx context.Context) error {
+	<-ctx.Done()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, current := range r.remotes {
+		current.cancel()
+		delete(r.remotes, name)
+	}
+	return nil
+}
+
+func (r *RemoteClusterReconciler) watchForSecrets(ctx context.Context, o client.Object) []reconcile.Request {
+	remoteList := &dnsv1.RemoteClusterList{}
+	if err := r.List(ctx, remoteList, client.InNamespace(o.GetNamespace())); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list remote clusters")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0)
+	for _, remote := range remoteList.Items {
+		if remote.Spec.KubeConfigSecretRef.Name == o.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: remote.Namespace, Name: remote.Name}})
+		}
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *RemoteClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.remotes = make(map[types.NamespacedName]*remoteCache)
+	if r.APIReader == nil {
+		r.APIReader = mgr.GetAPIReader()
+	}
+	r.events = make(chan event.GenericEvent, 64)
+	if err := mgr.Add(r); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&dnsv1.RemoteCluster{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Owns(&dnsv1.Record{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		// only the metadata of the Secrets is cached, a change of the resource version is enough to reload the kubeconfig
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.watchForSecrets), builder.OnlyMetadata).
+		WatchesRawSource(source.Channel(r.events, &handler.EnqueueRequestForObject{})).
+		Complete(r)
+}
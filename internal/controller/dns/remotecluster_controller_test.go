@@ -0,0 +1,135 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+)
+
+func newRemoteClusterTestReconciler(t *testing.T, objects ...runtime.Object) *RemoteClusterReconciler {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := dnsv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	cli := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objects...).Build()
+	return &RemoteClusterReconciler{Client: cli, APIReader: cli, Scheme: scheme, remotes: make(map[types.NamespacedName]*remoteCache)}
+}
+
+func TestRemoteCacheCheckSynced(t *testing.T) {
+	now := time.Now()
+	c := &remoteCache{started: now.Add(-time.Second)}
+	if err := c.checkSynced(now); !errors.Is(err, ErrorWaitRemoteRecords) {
+		t.Errorf("expected ErrorWaitRemoteRecords while listing, got %v", err)
+	}
+	c.started = now.Add(-2 * RemoteClusterSyncTimeout)
+	if err := c.checkSynced(now); err == nil || errors.Is(err, ErrorWaitRemoteRecords) {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+	c.synced.Store(true)
+	if err := c.checkSynced(now); err != nil {
+		t.Errorf("expected no error once synced, got %v", err)
+	}
+}
+
+func TestWatchForSecrets(t *testing.T) {
+	remote := func(namespace, name, secret string) *dnsv1.RemoteCluster {
+		return &dnsv1.RemoteCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec:       dnsv1.RemoteClusterSpec{KubeConfigSecretRef: dnsv1.SecretKeyReference{Name: secret}},
+		}
+	}
+	r := newRemoteClusterTestReconciler(t,
+		remote("mirror", "east", "east-kubeconfig"),
+		remote("mirror", "west", "west-kubeconfig"),
+		remote("other", "east", "east-kubeconfig"),
+	)
+	secret := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: "mirror", Name: "east-kubeconfig"}}
+	requests := r.watchForSecrets(context.Background(), secret)
+	if len(requests) != 1 || requests[0].NamespacedName != (types.NamespacedName{Namespace: "mirror", Name: "east"}) {
+		t.Errorf("unexpected requests %v", requests)
+	}
+}
+
+func TestGetCacheSecret(t *testing.T) {
+	cluster := &dnsv1.RemoteCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "mirror", Name: "east"},
+		Spec:       dnsv1.RemoteClusterSpec{KubeConfigSecretRef: dnsv1.SecretKeyReference{Name: "east-kubeconfig"}},
+	}
+	tests := []struct {
+		name   string
+		secret *corev1.Secret
+		err    string
+	}{
+		{name: "missing secret", err: "not found"},
+		{name: "missing key", secret: &corev1.Secret{Data: map[string][]byte{"config": []byte("")}}, err: "key kubeconfig not found"},
+		{name: "invalid kubeconfig", secret: &corev1.Secret{Data: map[string][]byte{"kubeconfig": []byte("{")}}, err: "yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := []runtime.Object{}
+			if tt.secret != nil {
+				tt.secret.ObjectMeta = metav1.ObjectMeta{Namespace: "mirror", Name: "east-kubeconfig"}
+				objects = append(objects, tt.secret)
+			}
+			r := newRemoteClusterTestReconciler(t, objects...)
+			_, err := r.getCache(context.Background(), cluster)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected an error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestSyncRecordsContinuesOnError(t *testing.T) {
+	remote := &dnsv1.RemoteCluster{ObjectMeta: metav1.ObjectMeta{Namespace: "mirror", Name: "east", UID: "east-uid"}}
+	remoteRecord := func(name string) dnsv1.Record {
+		return dnsv1.Record{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: name},
+			Spec:       dnsv1.RecordSpec{Name: name + ".example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.1"},
+		}
+	}
+	// a Record of the same name not managed by the RemoteCluster
+	taken := &dnsv1.Record{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "mirror", Name: remote.MirrorName("app", "taken"),
+		Labels: map[string]string{dnsv1.LabelCluster: "east"},
+	}}
+	stale := remote.MirrorRecord(&dnsv1.Record{ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "stale"}})
+	r := newRemoteClusterTestReconciler(t, remote, taken)
+	if err := ctrl.SetControllerReference(remote, stale, r.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := r.Create(ctx, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := r.syncRecords(ctx, remote, []dnsv1.Record{remoteRecord("taken"), remoteRecord("new")})
+	if err == nil || !strings.Contains(err.Error(), "not managed by the RemoteCluster") {
+		t.Fatalf("expected the error of the taken Record, got %v", err)
+	}
+	if changed != 2 {
+		t.Errorf("expected the new Record to be created and the stale one deleted, got %d changes", changed)
+	}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: "mirror", Name: remote.MirrorName("app", "new")}, &dnsv1.Record{}); err != nil {
+		t.Errorf("expected the Record after the failed one to be created, got %v", err)
+	}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: "mirror", Name: stale.Name}, &dnsv1.Record{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the stale Record to be deleted, got %v", err)
+	}
+}
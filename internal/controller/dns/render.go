@@ -0,0 +1,208 @@
+package dns
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	DefaultRenderTimeout        = 10 * time.Second
+	DefaultRenderMaxOutputBytes = 1 << 20
+	DefaultRenderMaxLookups     = 1000
+	DefaultRenderMaxSteps       = 100000
+)
+
+// RenderLimits bounds a single render of a ResourceWatcher template, zero values are unbounded
+type RenderLimits struct {
+	// The render is abandoned if it does not finish in time
+	Timeout time.Duration
+	// Maximum size of the rendered Records
+	MaxOutputBytes int
+	// Maximum number of objects the template may look up, e.g. with .Endpoints or .Pods
+	MaxLookups int
+	// Maximum number of function calls and outputs of the template, bounds loops which do not look up objects
+	MaxSteps int
+}
+
+// renderState is shared by the TemplateData of a render, it stops the render when a limit is hit.
+//
+// Go templates cannot be interrupted, a render abandoned on timeout keeps running in the background
+// until its next function call, output or lookup, it cannot modify the watcher anymore.
+// A loop doing none of them, e.g. an empty range over a large number, runs until it ends,
+// the watcher is not rendered again meanwhile, see ResourceWatcherReconciler.checkAbandoned.
+type renderState struct {
+	limits RenderLimits
+	// Closed once the execution of the template returned
+	finished chan struct{}
+
+	mu       sync.Mutex
+	done     bool
+	lookups  int
+	steps    int
+	includes int
+	output   bytes.Buffer
+	// The first limit hit by the render
+	err error
+}
+
+func newRenderState(limits RenderLimits) *renderState {
+	return &renderState{limits: limits, finished: make(chan struct{})}
+}
+
+// running reports whether the execution of the template has not returned yet
+func (s *renderState) running() bool {
+	select {
+	case <-s.finished:
+		return false
+	default:
+		return true
+	}
+}
+
+// fail records err as the reason the render stopped unless there already is one
+func (s *renderState) fail(err error) error {
+	if s.err == nil {
+		s.err = err
+	}
+	s.done = true
+	return s.err
+}
+
+// stop ends the render, it returns the first limit hit if any, otherwise err
+func (s *renderState) stop(err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		s.done = true
+		return s.err
+	}
+	if err == nil {
+		s.done = true
+		return nil
+	}
+	return s.fail(err)
+}
+
+// lookup counts a lookup of the render
+func (s *renderState) lookup() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return ErrorRenderAborted
+	}
+	s.lookups++
+	if s.limits.MaxLookups > 0 && s.lookups > s.limits.MaxLookups {
+		return s.fail(fmt.Errorf("%w: more than %d", ErrorRenderLookupLimit, s.limits.MaxLookups))
+	}
+	return nil
+}
+
+// step counts a function call or output of the render, the caller must hold mu
+func (s *renderState) step() error {
+	if s.done {
+		return ErrorRenderAborted
+	}
+	s.steps++
+	if s.limits.MaxSteps > 0 && s.steps > s.limits.MaxSteps {
+		return s.fail(fmt.Errorf("%w: more than %d", ErrorRenderStepLimit, s.limits.MaxSteps))
+	}
+	return nil
+}
+
+// budgeted wraps the funcs so every call counts a step of the render, a call failing the render panics
+// with the error, which is returned by the execution of the template
+func (s *renderState) budgeted(funcs template.FuncMap) template.FuncMap {
+	wrapped := make(template.FuncMap, len(funcs))
+	for name, fn := range funcs {
+		value := reflect.ValueOf(fn)
+		wrapped[name] = reflect.MakeFunc(value.Type(), func(args []reflect.Value) []reflect.Value {
+			s.mu.Lock()
+			err := s.step()
+			s.mu.Unlock()
+			if err != nil {
+				panic(err)
+			}
+			if value.Type().IsVariadic() {
+				return value.CallSlice(args)
+			}
+			return value.Call(args)
+		}).Interface()
+	}
+	return wrapped
+}
+
+// enterInclude counts a nested include of the render
+func (s *renderState) enterInclude() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return ErrorRenderAborted
+	}
+	s.includes++
+	if s.includes > maxIncludeDepth {
+		return s.fail(fmt.Errorf("%w: more than %d", ErrorRenderIncludeDepth, maxIncludeDepth))
+	}
+	return nil
+}
+
+func (s *renderState) leaveInclude() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.includes--
+}
+
+// Write implements io.Writer for the output of the render
+func (s *renderState) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.step(); err != nil {
+		return 0, err
+	}
+	if s.limits.MaxOutputBytes > 0 && s.output.Len()+len(p) > s.limits.MaxOutputBytes {
+		return 0, s.fail(fmt.Errorf("%w: more than %d bytes", ErrorRenderOutputTooLarge, s.limits.MaxOutputBytes))
+	}
+	return s.output.Write(p)
+}
+
+// execute renders tpl with data within the limits of the render,
+// tpl is copied to bind the include function and the step limit to the render
+func (d *TemplateData) execute(tpl *template.Template, data any) (string, error) {
+	set, err := tpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	funcs := make(template.FuncMap, len(templateFuncs))
+	for name, fn := range templateFuncs {
+		funcs[name] = fn
+	}
+	funcs["include"] = d.include(set)
+	set.Funcs(d.render.budgeted(funcs))
+
+	result := make(chan error, 1)
+	go func() {
+		defer close(d.render.finished)
+		result <- set.Execute(d.render, data)
+	}()
+
+	var timeout <-chan time.Time
+	if d.render.limits.Timeout > 0 {
+		timer := time.NewTimer(d.render.limits.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case err := <-result:
+		if err := d.render.stop(err); err != nil {
+			return "", err
+		}
+		return d.render.output.String(), nil
+	case <-timeout:
+		return "", d.render.stop(fmt.Errorf("%w after %s", ErrorRenderTimeout, d.render.limits.Timeout))
+	case <-d.ctx.Done():
+		return "", d.render.stop(d.ctx.Err())
+	}
+}
@@ -0,0 +1,111 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+)
+
+// render executes the template with the limits for a watcher in the namespace default
+func render(t *testing.T, tplString string, limits RenderLimits) (string, *TemplateData, error) {
+	cli := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).
+		WithObjects(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}).Build()
+	data := NewTemplateData(context.Background(), &dnsv1.ResourceWatcher{ObjectMeta: metav1.ObjectMeta{Namespace: "default"}}, cli, limits)
+	tpl, err := NewTemplate("test").Parse(tplString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := data.execute(tpl, &data)
+	return output, &data, err
+}
+
+func TestRenderLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		limits   RenderLimits
+		wants    string
+		wantErr  error
+	}{
+		{name: "within limits", template: `{{ range until 3 }}{{ $.GetNamespace.Name }} {{ end }}`,
+			limits: RenderLimits{MaxOutputBytes: 100, MaxLookups: 3, MaxSteps: 100}, wants: "default default default "},
+		{name: "output too large", template: `{{ repeat 20 "a" }}`, limits: RenderLimits{MaxOutputBytes: 10}, wantErr: ErrorRenderOutputTooLarge},
+		{name: "output of an include too large", template: `{{ define "a" }}{{ repeat 20 "a" }}{{ end }}{{ include "a" . | trunc 5 }}`,
+			limits: RenderLimits{MaxOutputBytes: 10}, wantErr: ErrorRenderOutputTooLarge},
+		{name: "too many lookups", template: `{{ range until 5 }}{{ $.GetNamespace.Name }}{{ end }}`, limits: RenderLimits{MaxLookups: 3}, wantErr: ErrorRenderLookupLimit},
+		{name: "too many function calls", template: `{{ range until 1000 }}{{ $x := add 1 1 }}{{ end }}`, limits: RenderLimits{MaxSteps: 100}, wantErr: ErrorRenderStepLimit},
+		{name: "too many outputs", template: `{{ range until 1000 }}{{ . }}{{ end }}`, limits: RenderLimits{MaxSteps: 100}, wantErr: ErrorRenderStepLimit},
+		{name: "include nested too deeply", template: `{{ define "loop" }}{{ include "loop" . }}{{ end }}{{ include "loop" . }}`, wantErr: ErrorRenderIncludeDepth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, _, err := render(t, tt.template, tt.limits)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output != tt.wants {
+				t.Errorf("output = %q, want %q", output, tt.wants)
+			}
+		})
+	}
+}
+
+func TestRenderTimeout(t *testing.T) {
+	start := time.Now()
+	_, data, err := render(t, `{{ range $i := 1000000000000 }}{{ $x := add $i 1 }}{{ end }}`, RenderLimits{Timeout: 50 * time.Millisecond})
+	if !errors.Is(err, ErrorRenderTimeout) {
+		t.Fatalf("expected ErrorRenderTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("render returned after %s", elapsed)
+	}
+	// the abandoned render stops at its next function call
+	select {
+	case <-data.render.finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("abandoned render still running")
+	}
+	if len(data.watcher.Status.Resources) != 0 {
+		t.Errorf("abandoned render tracked resources %v", data.watcher.Status.Resources)
+	}
+}
+
+func TestCheckAbandoned(t *testing.T) {
+	r := &ResourceWatcherReconciler{}
+	watcher := types.NamespacedName{Namespace: "default", Name: "watcher"}
+	if err := r.checkAbandoned(watcher); err != nil {
+		t.Fatal(err)
+	}
+
+	render := newRenderState(RenderLimits{})
+	r.setAbandoned(watcher, render)
+	if err := r.checkAbandoned(watcher); !errors.Is(err, ErrorRenderTimeout) || !strings.Contains(err.Error(), "still running") {
+		t.Fatalf("expected a running render to block the watcher, got %v", err)
+	}
+	if err := r.checkAbandoned(types.NamespacedName{Namespace: "default", Name: "other"}); err != nil {
+		t.Fatalf("other watcher blocked: %v", err)
+	}
+	close(render.finished)
+	if err := r.checkAbandoned(watcher); err != nil {
+		t.Fatalf("expected a finished render to unblock the watcher, got %v", err)
+	}
+	if len(r.abandoned) != 0 {
+		t.Errorf("finished render not forgotten")
+	}
+}
@@ -18,18 +18,26 @@ package dns
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"sync"
 	"text/template"
 	"time"
 
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -46,14 +54,28 @@ type ResourceWatcherReconciler struct {
 	Scheme   *runtime.Scheme
 	Template *template.Template
 	Recorder record.EventRecorder
-
-	cacheGenMap map[string]int64
-	lock        sync.Mutex
+	// Triggers of a kind in its window are coalesced into one render, see ParseTriggerWindows
+	TriggerWindows map[dnsv1.WatchResourceKind]time.Duration
+	RenderLimits   RenderLimits
+
+	// Parsed templates with their library partials by template key
+	templates map[string]*cachedTemplate
+	lock      sync.Mutex
+
+	// Whether the template of a watcher may read the status of the watched resources, assumed if unknown
+	readsStatus map[types.NamespacedName]bool
+	triggers    triggers
+	triggerLock sync.Mutex
+
+	// Renders abandoned on timeout which may still be running, by watcher
+	abandoned     map[types.NamespacedName]*renderState
+	abandonedLock sync.Mutex
 }
 
 // +kubebuilder:rbac:groups=dns.xzzpig.com,resources=resourcewatchers,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=dns.xzzpig.com,resources=resourcewatchers/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=dns.xzzpig.com,resources=resourcewatchers/finalizers,verbs=update
+// +kubebuilder:rbac:groups=dns.xzzpig.com,resources=templatelibraries;clustertemplatelibraries,verbs=get;list;watch
 // +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=namespaces;services;endpoints;nodes;pods,verbs=get;list;watch
 
@@ -71,7 +93,13 @@ func (r *ResourceWatcherReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 
 	watcher := &dnsv1.ResourceWatcher{}
 	if err := r.Get(ctx, req.NamespacedName, watcher); err != nil {
-		return ctrl.Result{}, err
+		if apierrors.IsNotFound(err) {
+			r.forget(req.NamespacedName)
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if message := r.takeTriggers(req.NamespacedName); message != "" {
+		r.Recorder.Event(watcher, corev1.EventTypeNormal, "Trigger", message)
 	}
 
 	var generator dnsv1.GeneratorObject
@@ -84,10 +112,23 @@ func (r *ResourceWatcherReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		return ctrl.Result{}, err
 	}
 
+	if watcher.Status.Ready && watcher.Status.RenderHash != "" {
+		versions, err := r.currentVersions(ctx, watcher.Status.Resources)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if renderHash(watcher, generator, versions, recordList.Items) == watcher.Status.RenderHash {
+			logger.V(1).Info("inputs unchanged, skipping render")
+			return ctrl.Result{}, nil
+		}
+	}
+
+	data := NewTemplateData(ctx, watcher, r.Client, r.RenderLimits)
 	defer func() {
 		if _err != nil {
 			watcher.Status.Ready = false
 			watcher.Status.Reason = _err.Error()
+			watcher.Status.RenderHash = ""
 			logger.Error(_err, "failed to reconcile")
 			_err = nil
 		} else {
@@ -101,7 +142,11 @@ func (r *ResourceWatcherReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 	}()
 	watcher.Status.Resources = make([]dnsv1.WatchResource, 0)
 
-	templateData, err := r.getTemplateData(ctx, watcher, generator)
+	if err := r.checkAbandoned(req.NamespacedName); err != nil {
+		return ctrl.Result{RequeueAfter: time.Minute}, err
+	}
+
+	templateData, err := r.getTemplateData(ctx, data, generator)
 	if err != nil {
 		r.Recorder.Event(watcher, corev1.EventTypeWarning, "Failed", "Failed to get template data")
 		return ctrl.Result{RequeueAfter: time.Minute}, err
@@ -109,7 +154,7 @@ func (r *ResourceWatcherReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 
 	var cachedTpl *template.Template
 	if generator.GetSpec().Template != "" {
-		cachedTpl, err = r.getTemplate(fmt.Sprintf("Generator/%s/%s", generator.GetNamespace(), generator.GetName()), generator.GetGeneration(), generator.GetSpec().Template) //r.NewTemplate(generator.GetSpec().Template, nil)
+		cachedTpl, err = r.getTemplate(ctx, &data, fmt.Sprintf("Generator/%s/%s", generator.GetNamespace(), generator.GetName()), generator.GetNamespace(), generator.GetGeneration(), generator.GetSpec().Template) //r.NewTemplate(generator.GetSpec().Template, nil)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
@@ -120,21 +165,21 @@ func (r *ResourceWatcherReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 			if err := r.Get(ctx, client.ObjectKey{Namespace: watcher.Namespace, Name: generator.GetSpec().TemplateRef}, template); err != nil {
 				return ctrl.Result{}, err
 			}
-			cachedTpl, err = r.getTemplate(fmt.Sprintf("Template/%s/%s", template.Namespace, template.Name), template.Generation, template.Spec.Template) //r.NewTemplate(template.Spec.Template, template)
+			cachedTpl, err = r.getTemplate(ctx, &data, fmt.Sprintf("Template/%s/%s", template.Namespace, template.Name), template.Namespace, template.Generation, template.Spec.Template) //r.NewTemplate(template.Spec.Template, template)
 			if err != nil {
 				return ctrl.Result{}, err
 			}
-			watcher.Status.AddResource(dnsv1.WatchResourceKindTemplate, watcher.Namespace, generator.GetSpec().TemplateRef)
+			data.track(dnsv1.WatchResourceKindTemplate, template)
 		case *dnsv1.ClusterGenerator:
 			template := &dnsv1.ClusterTemplate{}
 			if err := r.Get(ctx, client.ObjectKey{Name: generator.GetSpec().TemplateRef}, template); err != nil {
 				return ctrl.Result{}, err
 			}
-			cachedTpl, err = r.getTemplate(fmt.Sprintf("ClusterTemplate/%s", template.Name), template.Generation, template.Spec.Template) //r.NewTemplate(template.Spec.Template, template)
+			cachedTpl, err = r.getTemplate(ctx, &data, fmt.Sprintf("ClusterTemplate/%s", template.Name), "", template.Generation, template.Spec.Template) //r.NewTemplate(template.Spec.Template, template)
 			if err != nil {
 				return ctrl.Result{}, err
 			}
-			watcher.Status.AddResource(dnsv1.WatchResourceKindClusterTemplate, "", generator.GetSpec().TemplateRef)
+			data.track(dnsv1.WatchResourceKindClusterTemplate, template)
 		default:
 			r.Recorder.Event(watcher, corev1.EventTypeWarning, "Failed", "No template specified")
 			return ctrl.Result{}, ErrorUnknownKind
@@ -143,12 +188,17 @@ func (r *ResourceWatcherReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		r.Recorder.Event(watcher, corev1.EventTypeWarning, "Failed", "No template specified")
 		return ctrl.Result{}, ErrorNoTemplate
 	}
-	parsedRecords, err := r.parse(ctx, cachedTpl, templateData)
+	r.setReadsStatus(req.NamespacedName, templateReadsStatus(cachedTpl))
+	parsedRecords, err := r.parse(ctx, cachedTpl, &data, templateData)
+	if errors.Is(err, ErrorRenderTimeout) {
+		r.setAbandoned(req.NamespacedName, data.render)
+	}
 	if err != nil {
-		r.Recorder.Event(watcher, corev1.EventTypeWarning, "Failed", "Failed to parse template")
+		r.Recorder.Eventf(watcher, corev1.EventTypeWarning, "Failed", "Failed to parse template: %s", err)
 		return ctrl.Result{RequeueAfter: time.Minute}, err
 	}
 
+	rendered := make([]dnsv1.Record, 0, len(parsedRecords))
 	for _, record := range parsedRecords {
 		record.Namespace = watcher.Namespace
 		ctrl.SetControllerReference(watcher, &record, r.Scheme)
@@ -157,12 +207,14 @@ func (r *ResourceWatcherReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		oldVersion := ""
 		if oldRecord != nil {
 			oldVersion = oldRecord.ResourceVersion
-			oldRecord.Labels = record.Labels
-			oldRecord.Annotations = record.Annotations
-			oldRecord.OwnerReferences = record.OwnerReferences
-			oldRecord.Spec = record.Spec
-			if err := r.Update(ctx, oldRecord); err != nil {
-				return ctrl.Result{RequeueAfter: time.Minute}, err
+			if recordChanged(oldRecord, &record) {
+				oldRecord.Labels = record.Labels
+				oldRecord.Annotations = record.Annotations
+				oldRecord.OwnerReferences = record.OwnerReferences
+				oldRecord.Spec = record.Spec
+				if err := r.Update(ctx, oldRecord); err != nil {
+					return ctrl.Result{RequeueAfter: time.Minute}, err
+				}
 			}
 			oldRecord.Status.Checked = true
 		} else {
@@ -174,6 +226,7 @@ func (r *ResourceWatcherReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		if oldVersion != oldRecord.ResourceVersion {
 			r.Recorder.Eventf(oldRecord, corev1.EventTypeNormal, "Modify", "Record modified by ResourceWatcher %s", watcher.Name)
 		}
+		rendered = append(rendered, *oldRecord)
 	}
 	for _, record := range recordList.Items {
 		if !record.Status.Checked {
@@ -182,17 +235,84 @@ func (r *ResourceWatcherReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 			}
 		}
 	}
+	watcher.Status.RenderHash = renderHash(watcher, generator, data.versions, rendered)
 
 	return ctrl.Result{}, nil
 }
 
-func (r *ResourceWatcherReconciler) parse(ctx context.Context, tpl *template.Template, data any) (records []dnsv1.Record, err error) {
-	buffer := new(strings.Builder)
-	err = tpl.Execute(buffer, data)
+// renderHash hashes the inputs of a render: the generations of the watcher and the generator,
+// the resourceVersions of the tracked resources and the generations of the owned Records
+func renderHash(watcher *dnsv1.ResourceWatcher, generator dnsv1.GeneratorObject, versions map[string]string, records []dnsv1.Record) string {
+	lines := make([]string, 0, len(versions)+len(records))
+	for resource, version := range versions {
+		lines = append(lines, fmt.Sprintf("resource %s %s", resource, version))
+	}
+	for _, record := range records {
+		lines = append(lines, fmt.Sprintf("record %s %d", record.Name, record.Generation))
+	}
+	slices.Sort(lines)
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "watcher %d\ngenerator %s %d\n", watcher.Generation, generator.GetUID(), generator.GetGeneration())
+	for _, line := range lines {
+		fmt.Fprintln(hash, line)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// currentVersions reads the resourceVersions of the tracked resources, deleted resources have an empty version
+func (r *ResourceWatcherReconciler) currentVersions(ctx context.Context, resources []dnsv1.WatchResource) (map[string]string, error) {
+	versions := make(map[string]string, len(resources))
+	for _, resource := range resources {
+		var obj client.Object
+		switch resource.Kind {
+		case dnsv1.WatchResourceKindTemplate:
+			obj = &dnsv1.Template{}
+		case dnsv1.WatchResourceKindClusterTemplate:
+			obj = &dnsv1.ClusterTemplate{}
+		case dnsv1.WatchResourceKindNamespace:
+			obj = &corev1.Namespace{}
+		case dnsv1.WatchResourceKindIngress:
+			obj = &netv1.Ingress{}
+		case dnsv1.WatchResourceKindService:
+			obj = &corev1.Service{}
+		case dnsv1.WatchResourceKindEndpoints:
+			obj = &corev1.Endpoints{}
+		case dnsv1.WatchResourceKindNode:
+			obj = &corev1.Node{}
+		case dnsv1.WatchResourceKindPod:
+			obj = &corev1.Pod{}
+		case dnsv1.WatchResourceKindRecord:
+			obj = &dnsv1.Record{}
+		case dnsv1.WatchResourceKindTemplateLibrary:
+			obj = &dnsv1.TemplateLibrary{}
+		case dnsv1.WatchResourceKindClusterTemplateLibrary:
+			obj = &dnsv1.ClusterTemplateLibrary{}
+		default:
+			return nil, ErrorUnknownKind
+		}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: resource.Namespace, Name: resource.Name}, obj); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+		versions[resource.String()] = obj.GetResourceVersion()
+	}
+	return versions, nil
+}
+
+// recordChanged reports whether the rendered record differs from the existing one in the fields
+// written by the ResourceWatcher, nil and empty maps are considered equal
+func recordChanged(existing, rendered *dnsv1.Record) bool {
+	return !equality.Semantic.DeepEqual(existing.Labels, rendered.Labels) ||
+		!equality.Semantic.DeepEqual(existing.Annotations, rendered.Annotations) ||
+		!equality.Semantic.DeepEqual(existing.OwnerReferences, rendered.OwnerReferences) ||
+		!equality.Semantic.DeepEqual(existing.Spec, rendered.Spec)
+}
+
+func (r *ResourceWatcherReconciler) parse(ctx context.Context, tpl *template.Template, data *TemplateData, templateData any) (records []dnsv1.Record, err error) {
+	str, err := data.execute(tpl, templateData)
 	if err != nil {
 		return nil, err
 	}
-	str := buffer.String()
 	cleanStr := strings.TrimPrefix(strings.TrimPrefix(str, "\n"), " ")
 	if cleanStr == "" {
 		return []dnsv1.Record{}, nil
@@ -230,48 +350,61 @@ func (r *ResourceWatcherReconciler) parse(ctx context.Context, tpl *template.Tem
 	}
 }
 
-func (r *ResourceWatcherReconciler) getTemplate(key string, generation int64, tplString dnsv1.GoTemplateString) (tpl *template.Template, err error) {
+// getTemplate returns the parsed template, it is parsed again when its generation
+// or one of the libraries it includes changed
+func (r *ResourceWatcherReconciler) getTemplate(ctx context.Context, data *TemplateData, key, namespace string, generation int64, tplString dnsv1.GoTemplateString) (tpl *template.Template, err error) {
 	r.lock.Lock()
 	defer r.lock.Unlock()
-	tpl = r.Template.Lookup(key)
-	if tpl == nil {
-		tpl = r.Template.New(key)
-	}
-	if r.cacheGenMap[key] != generation {
-		if _, err := tpl.Parse(string(tplString)); err != nil {
+	if cached := r.templates[key]; cached != nil && cached.generation == generation {
+		fingerprint, err := r.resolveLibraries(ctx, data, namespace, cached.libraries)
+		if err != nil {
 			return nil, err
 		}
-		r.cacheGenMap[key] = generation
+		if fingerprint == cached.fingerprint {
+			return cached.tpl, nil
+		}
+	}
+	cached, err := r.buildTemplate(ctx, data, key, namespace, generation, tplString)
+	if err != nil {
+		return nil, err
 	}
-	return tpl, nil
+	r.templates[key] = cached
+	return cached.tpl, nil
 }
 
-func (r *ResourceWatcherReconciler) getTemplateData(ctx context.Context, watcher *dnsv1.ResourceWatcher, generator dnsv1.GeneratorObject) (any, error) {
+// getTemplateData gets the resource of the watcher and tracks it, so a change of the resource itself
+// changes the render hash whichever fields of it the template reads
+func (r *ResourceWatcherReconciler) getTemplateData(ctx context.Context, data TemplateData, generator dnsv1.GeneratorObject) (any, error) {
+	watcher := data.watcher
 	switch generator.GetSpec().ResourceKind {
 	case dnsv1.GeneratorResourceKindIngress:
 		ingress := &netv1.Ingress{}
 		if err := r.Get(ctx, client.ObjectKey{Namespace: watcher.Spec.Resource.Namespace, Name: watcher.Spec.Resource.Name}, ingress); err != nil {
 			return nil, err
 		}
-		return NewIngressTemplateData(NewTemplateData(ctx, watcher, r.Client), ingress), nil
+		data.track(dnsv1.WatchResourceKindIngress, ingress)
+		return NewIngressTemplateData(data, ingress), nil
 	case dnsv1.GeneratorResourceKindRecord:
 		record := &dnsv1.Record{}
 		if err := r.Get(ctx, client.ObjectKey{Namespace: watcher.Spec.Resource.Namespace, Name: watcher.Spec.Resource.Name}, record); err != nil {
 			return nil, err
 		}
-		return NewRecordTemplateData(NewTemplateData(ctx, watcher, r.Client), record), nil
+		data.track(dnsv1.WatchResourceKindRecord, record)
+		return NewRecordTemplateData(data, record), nil
 	case dnsv1.GeneratorResourceKindNode:
 		node := &corev1.Node{}
 		if err := r.Get(ctx, client.ObjectKey{Name: watcher.Spec.Resource.Name}, node); err != nil {
 			return nil, err
 		}
-		return NewNodeTemplateData(NewTemplateData(ctx, watcher, r.Client), node), nil
+		data.track(dnsv1.WatchResourceKindNode, node)
+		return NewNodeTemplateData(data, node), nil
 	case dnsv1.GeneratorResourceKindService:
 		service := &corev1.Service{}
 		if err := r.Get(ctx, client.ObjectKey{Namespace: watcher.Spec.Resource.Namespace, Name: watcher.Spec.Resource.Name}, service); err != nil {
 			return nil, err
 		}
-		return NewServiceTemplateData(NewTemplateData(ctx, watcher, r.Client), service), nil
+		data.track(dnsv1.WatchResourceKindService, service)
+		return NewServiceTemplateData(data, service), nil
 	default:
 		return nil, ErrorUnknownKind
 	}
@@ -313,31 +446,106 @@ func (r *ResourceWatcherReconciler) getOwner(ctx context.Context, watcher *dnsv1
 	return nil
 }
 
-func (r *ResourceWatcherReconciler) watchResources(kind dnsv1.WatchResourceKind) handler.MapFunc {
-	return func(ctx context.Context, obj client.Object) []reconcile.Request {
-		watchResource := &dnsv1.WatchResource{
-			NamespacedName: dnsv1.NamespacedName{
-				Name:      obj.GetName(),
-				Namespace: obj.GetNamespace(),
-			},
-			Kind: kind,
-		}
+func (r *ResourceWatcherReconciler) forget(watcher types.NamespacedName) {
+	r.triggerLock.Lock()
+	defer r.triggerLock.Unlock()
+	delete(r.readsStatus, watcher)
+	delete(r.triggers, watcher)
+	r.abandonedLock.Lock()
+	defer r.abandonedLock.Unlock()
+	delete(r.abandoned, watcher)
+}
 
-		logger := log.FromContext(ctx).WithName("ResourceWatcher").WithValues("resource", watchResource)
+// checkAbandoned fails with ErrorRenderTimeout while the render of the watcher abandoned on timeout is still running,
+// so a template which cannot be stopped does not pile up renders on retries
+func (r *ResourceWatcherReconciler) checkAbandoned(watcher types.NamespacedName) error {
+	r.abandonedLock.Lock()
+	defer r.abandonedLock.Unlock()
+	render := r.abandoned[watcher]
+	if render == nil {
+		return nil
+	}
+	if render.running() {
+		return fmt.Errorf("%w: the previous render is still running", ErrorRenderTimeout)
+	}
+	delete(r.abandoned, watcher)
+	return nil
+}
 
-		watcherList := &dnsv1.ResourceWatcherList{}
-		if err := r.List(ctx, watcherList, client.MatchingFields{resourcesField: watchResource.String()}); err != nil {
-			logger.Error(err, "failed to list resource watchers")
-			return []ctrl.Request{}
-		}
+func (r *ResourceWatcherReconciler) setAbandoned(watcher types.NamespacedName, render *renderState) {
+	r.abandonedLock.Lock()
+	defer r.abandonedLock.Unlock()
+	if r.abandoned == nil {
+		r.abandoned = make(map[types.NamespacedName]*renderState)
+	}
+	r.abandoned[watcher] = render
+}
 
-		requests := make([]reconcile.Request, len(watcherList.Items))
-		for i, watcher := range watcherList.Items {
-			requests[i] = reconcile.Request{NamespacedName: types.NamespacedName{Namespace: watcher.Namespace, Name: watcher.Name}}
-			r.Recorder.Eventf(&watcher, corev1.EventTypeNormal, "Trigger", "Record re-parsing, trigged by %s", watchResource.String())
+func (r *ResourceWatcherReconciler) setReadsStatus(watcher types.NamespacedName, readsStatus bool) {
+	r.triggerLock.Lock()
+	defer r.triggerLock.Unlock()
+	if r.readsStatus == nil {
+		r.readsStatus = make(map[types.NamespacedName]bool)
+	}
+	r.readsStatus[watcher] = readsStatus
+}
+
+func (r *ResourceWatcherReconciler) takeTriggers(watcher types.NamespacedName) string {
+	r.triggerLock.Lock()
+	defer r.triggerLock.Unlock()
+	return r.triggers.take(watcher)
+}
+
+// trigger enqueues the watchers of obj after the window of the kind,
+// status-only updates are skipped for the watchers whose template does not read the status
+func (r *ResourceWatcherReconciler) trigger(ctx context.Context, kind dnsv1.WatchResourceKind, obj client.Object, statusOnly bool, q workqueue.RateLimitingInterface) {
+	watchResource := &dnsv1.WatchResource{
+		NamespacedName: dnsv1.NamespacedName{
+			Name:      obj.GetName(),
+			Namespace: obj.GetNamespace(),
+		},
+		Kind: kind,
+	}
+
+	logger := log.FromContext(ctx).WithName("ResourceWatcher").WithValues("resource", watchResource)
+
+	watcherList := &dnsv1.ResourceWatcherList{}
+	if err := r.List(ctx, watcherList, client.MatchingFields{resourcesField: watchResource.String()}); err != nil {
+		logger.Error(err, "failed to list resource watchers")
+		return
+	}
+
+	window := r.TriggerWindows[kind]
+	r.triggerLock.Lock()
+	defer r.triggerLock.Unlock()
+	for _, watcher := range watcherList.Items {
+		key := types.NamespacedName{Namespace: watcher.Namespace, Name: watcher.Name}
+		if readsStatus, ok := r.readsStatus[key]; statusOnly && ok && !readsStatus {
+			continue
 		}
+		r.triggers.add(key, watchResource.String())
+		if window > 0 {
+			q.AddAfter(reconcile.Request{NamespacedName: key}, window)
+		} else {
+			q.Add(reconcile.Request{NamespacedName: key})
+		}
+	}
+}
 
-		return requests
+func (r *ResourceWatcherReconciler) watchResources(kind dnsv1.WatchResourceKind) handler.EventHandler {
+	return handler.Funcs{
+		CreateFunc: func(ctx context.Context, e event.CreateEvent, q workqueue.RateLimitingInterface) {
+			r.trigger(ctx, kind, e.Object, false, q)
+		},
+		UpdateFunc: func(ctx context.Context, e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+			r.trigger(ctx, kind, e.ObjectNew, statusOnlyUpdate(e.ObjectOld, e.ObjectNew), q)
+		},
+		DeleteFunc: func(ctx context.Context, e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+			r.trigger(ctx, kind, e.Object, false, q)
+		},
+		GenericFunc: func(ctx context.Context, e event.GenericEvent, q workqueue.RateLimitingInterface) {
+			r.trigger(ctx, kind, e.Object, false, q)
+		},
 	}
 }
 
@@ -376,18 +584,21 @@ func (r *ResourceWatcherReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
-	r.cacheGenMap = make(map[string]int64)
+	r.templates = make(map[string]*cachedTemplate)
+	r.triggers = make(triggers)
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&dnsv1.ResourceWatcher{}).
-		Watches(&dnsv1.Template{}, handler.EnqueueRequestsFromMapFunc(r.watchResources(dnsv1.WatchResourceKindTemplate))).
-		Watches(&dnsv1.ClusterTemplate{}, handler.EnqueueRequestsFromMapFunc(r.watchResources(dnsv1.WatchResourceKindClusterTemplate))).
-		Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(r.watchResources(dnsv1.WatchResourceKindNamespace))).
-		Watches(&netv1.Ingress{}, handler.EnqueueRequestsFromMapFunc(r.watchResources(dnsv1.WatchResourceKindIngress))).
-		Watches(&corev1.Service{}, handler.EnqueueRequestsFromMapFunc(r.watchResources(dnsv1.WatchResourceKindService))).
-		Watches(&corev1.Endpoints{}, handler.EnqueueRequestsFromMapFunc(r.watchResources(dnsv1.WatchResourceKindEndpoints))).
-		Watches(&corev1.Node{}, handler.EnqueueRequestsFromMapFunc(r.watchResources(dnsv1.WatchResourceKindNode))).
-		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(r.watchResources(dnsv1.WatchResourceKindPod))).
-		Watches(&dnsv1.Record{}, handler.EnqueueRequestsFromMapFunc(r.watchResources(dnsv1.WatchResourceKindRecord))).
+		Watches(&dnsv1.Template{}, r.watchResources(dnsv1.WatchResourceKindTemplate)).
+		Watches(&dnsv1.ClusterTemplate{}, r.watchResources(dnsv1.WatchResourceKindClusterTemplate)).
+		Watches(&corev1.Namespace{}, r.watchResources(dnsv1.WatchResourceKindNamespace)).
+		Watches(&netv1.Ingress{}, r.watchResources(dnsv1.WatchResourceKindIngress)).
+		Watches(&corev1.Service{}, r.watchResources(dnsv1.WatchResourceKindService)).
+		Watches(&corev1.Endpoints{}, r.watchResources(dnsv1.WatchResourceKindEndpoints)).
+		Watches(&corev1.Node{}, r.watchResources(dnsv1.WatchResourceKindNode)).
+		Watches(&corev1.Pod{}, r.watchResources(dnsv1.WatchResourceKindPod)).
+		Watches(&dnsv1.Record{}, r.watchResources(dnsv1.WatchResourceKindRecord)).
+		Watches(&dnsv1.TemplateLibrary{}, r.watchResources(dnsv1.WatchResourceKindTemplateLibrary)).
+		Watches(&dnsv1.ClusterTemplateLibrary{}, r.watchResources(dnsv1.WatchResourceKindClusterTemplateLibrary)).
 		Complete(r)
 }
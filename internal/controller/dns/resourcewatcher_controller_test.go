@@ -18,9 +18,11 @@ package dns
 
 import (
 	"context"
+	"testing"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -82,3 +84,93 @@ var _ = Describe("ResourceWatcher Controller", func() {
 		})
 	})
 })
+
+func TestRenderHash(t *testing.T) {
+	watcher := &dnsv1.ResourceWatcher{ObjectMeta: metav1.ObjectMeta{Name: "watcher", Generation: 1}}
+	generator := &dnsv1.Generator{ObjectMeta: metav1.ObjectMeta{Name: "generator", UID: "uid", Generation: 1}}
+	versions := map[string]string{"Service/default/web": "10", "Endpoints/default/web": "11"}
+	records := []dnsv1.Record{
+		{ObjectMeta: metav1.ObjectMeta{Name: "a", Generation: 1}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "b", Generation: 2}},
+	}
+	hash := renderHash(watcher, generator, versions, records)
+
+	if got := renderHash(watcher, generator, versions, []dnsv1.Record{records[1], records[0]}); got != hash {
+		t.Error("hash depends on the order of the records")
+	}
+	changed := map[string]func() string{
+		"watcher generation": func() string {
+			watcher := watcher.DeepCopy()
+			watcher.Generation = 2
+			return renderHash(watcher, generator, versions, records)
+		},
+		"generator generation": func() string {
+			generator := generator.DeepCopy()
+			generator.Generation = 2
+			return renderHash(watcher, generator, versions, records)
+		},
+		"generator replaced": func() string {
+			generator := generator.DeepCopy()
+			generator.UID = "other"
+			return renderHash(watcher, generator, versions, records)
+		},
+		"resource version": func() string {
+			return renderHash(watcher, generator, map[string]string{"Service/default/web": "12", "Endpoints/default/web": "11"}, records)
+		},
+		"resource deleted": func() string {
+			return renderHash(watcher, generator, map[string]string{"Service/default/web": "", "Endpoints/default/web": "11"}, records)
+		},
+		"record generation": func() string {
+			records := []dnsv1.Record{*records[0].DeepCopy(), records[1]}
+			records[0].Generation = 3
+			return renderHash(watcher, generator, versions, records)
+		},
+		"record deleted": func() string {
+			return renderHash(watcher, generator, versions, records[:1])
+		},
+	}
+	for name, hashOf := range changed {
+		if hashOf() == hash {
+			t.Errorf("hash unchanged by a change of the %s", name)
+		}
+	}
+}
+
+func TestRootResourceTracked(t *testing.T) {
+	ctx := context.Background()
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+		Spec:       corev1.ServiceSpec{ClusterIP: "10.0.0.1"},
+	}
+	r := newLibraryReconciler(t, service)
+	watcher := &dnsv1.ResourceWatcher{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+		Spec:       dnsv1.ResourceWatcherSpec{Resource: dnsv1.NamespacedName{Namespace: "default", Name: "web"}},
+	}
+	generator := &dnsv1.Generator{Spec: dnsv1.GeneratorSpec{ResourceKind: dnsv1.GeneratorResourceKindService}}
+
+	// the template may only read the fields of the Service, which are not tracked by the accessors
+	data := NewTemplateData(ctx, watcher, r.Client, RenderLimits{})
+	if _, err := r.getTemplateData(ctx, data, generator); err != nil {
+		t.Fatal(err)
+	}
+	hash := renderHash(watcher, generator, data.versions, nil)
+	versions, err := r.currentVersions(ctx, watcher.Status.Resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renderHash(watcher, generator, versions, nil) != hash {
+		t.Fatal("hash changed without a change of the Service")
+	}
+
+	service.Spec.ClusterIP = "10.0.0.2"
+	if err := r.Update(ctx, service); err != nil {
+		t.Fatal(err)
+	}
+	if versions, err = r.currentVersions(ctx, watcher.Status.Resources); err != nil {
+		t.Fatal(err)
+	}
+	if renderHash(watcher, generator, versions, nil) == hash {
+		t.Error("hash unchanged by a change of the Service of the watcher")
+	}
+}
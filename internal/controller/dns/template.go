@@ -2,6 +2,7 @@ package dns
 
 import (
 	"context"
+	"fmt"
 	"reflect"
 	"text/template"
 
@@ -18,14 +19,49 @@ type TemplateData struct {
 	ctx     context.Context
 	watcher *dnsv1.ResourceWatcher
 	client  client.Client
+	// resourceVersions of the tracked resources as read by the render
+	versions map[string]string
+	render   *renderState
+}
+
+// get looks up an object for the template, counting it against the lookup limit of the render
+func (d *TemplateData) get(key client.ObjectKey, obj client.Object) error {
+	if err := d.render.lookup(); err != nil {
+		return err
+	}
+	return d.client.Get(d.ctx, key, obj)
+}
+
+// track adds obj to the resources watched by the watcher, unless the render was stopped
+func (d *TemplateData) track(kind dnsv1.WatchResourceKind, obj client.Object) {
+	d.render.mu.Lock()
+	defer d.render.mu.Unlock()
+	if d.render.done {
+		return
+	}
+	resource := dnsv1.WatchResource{NamespacedName: dnsv1.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}, Kind: kind}
+	d.watcher.Status.AddResource(kind, resource.Namespace, resource.Name)
+	d.versions[resource.String()] = obj.GetResourceVersion()
+}
+
+// trackMissing adds a resource which does not exist to the resources watched by the watcher
+func (d *TemplateData) trackMissing(kind dnsv1.WatchResourceKind, namespace, name string) {
+	d.render.mu.Lock()
+	defer d.render.mu.Unlock()
+	if d.render.done {
+		return
+	}
+	resource := dnsv1.WatchResource{NamespacedName: dnsv1.NamespacedName{Namespace: namespace, Name: name}, Kind: kind}
+	d.watcher.Status.AddResource(kind, namespace, name)
+	d.versions[resource.String()] = ""
 }
 
 func (d *TemplateData) GetNamespace() (*corev1.Namespace, error) {
 	ns := &corev1.Namespace{}
-	if err := d.client.Get(d.ctx, client.ObjectKey{Name: d.watcher.Namespace}, ns); err != nil {
+	if err := d.get(client.ObjectKey{Name: d.watcher.Namespace}, ns); err != nil {
 		return nil, err
 	}
-	d.watcher.Status.AddResource(dnsv1.WatchResourceKindNamespace, ns.Namespace, ns.Name)
+	d.track(dnsv1.WatchResourceKindNamespace, ns)
 	return ns, nil
 }
 
@@ -35,7 +71,6 @@ type IngressTemplateData struct {
 }
 
 func (d *IngressTemplateData) Ingress() *IngressData {
-	d.watcher.Status.AddResource(dnsv1.WatchResourceKindIngress, d.ingress.Namespace, d.ingress.Name)
 	return &IngressData{d.TemplateData, d.ingress}
 }
 
@@ -47,10 +82,10 @@ type IngressData struct {
 func (i *IngressData) Service(ruleIndex, pathIndex int) (*ServiceData, error) {
 	serviceName := i.Spec.Rules[ruleIndex].IngressRuleValue.HTTP.Paths[pathIndex].Backend.Service.Name
 	service := &corev1.Service{}
-	if err := i.client.Get(i.ctx, client.ObjectKey{Namespace: i.Namespace, Name: serviceName}, service); err != nil {
+	if err := i.get(client.ObjectKey{Namespace: i.Namespace, Name: serviceName}, service); err != nil {
 		return nil, err
 	}
-	i.watcher.Status.AddResource(dnsv1.WatchResourceKindService, i.Namespace, serviceName)
+	i.track(dnsv1.WatchResourceKindService, service)
 	return &ServiceData{i.TemplateData, service}, nil
 }
 
@@ -61,10 +96,10 @@ type ServiceData struct {
 
 func (s *ServiceData) Endpoints() (*EndpointsData, error) {
 	endpoints := &corev1.Endpoints{}
-	if err := s.client.Get(s.ctx, client.ObjectKey{Namespace: s.Namespace, Name: s.Name}, endpoints); err != nil {
+	if err := s.get(client.ObjectKey{Namespace: s.Namespace, Name: s.Name}, endpoints); err != nil {
 		return nil, err
 	}
-	s.watcher.Status.AddResource(dnsv1.WatchResourceKindEndpoints, endpoints.Namespace, endpoints.Name)
+	s.track(dnsv1.WatchResourceKindEndpoints, endpoints)
 	return &EndpointsData{s.TemplateData, endpoints}, nil
 }
 
@@ -82,7 +117,7 @@ func (e *EndpointsData) Nodes() ([]NodeData, error) {
 			}
 			if _, ok := nodeMap[*address.NodeName]; !ok {
 				node := &corev1.Node{}
-				if err := e.client.Get(e.ctx, client.ObjectKey{Name: *address.NodeName}, node); err != nil {
+				if err := e.get(client.ObjectKey{Name: *address.NodeName}, node); err != nil {
 					return nil, err
 				}
 				nodeMap[*address.NodeName] = node
@@ -93,7 +128,7 @@ func (e *EndpointsData) Nodes() ([]NodeData, error) {
 	i := 0
 	for _, node := range nodeMap {
 		nodes[i] = NodeData{e.TemplateData, node}
-		e.watcher.Status.AddResource(dnsv1.WatchResourceKindNode, node.Namespace, node.Name)
+		e.track(dnsv1.WatchResourceKindNode, node)
 		i++
 	}
 	return nodes, nil
@@ -111,7 +146,7 @@ func (e *EndpointsData) Pods() ([]PodData, error) {
 			}
 			if _, ok := podMap[address.TargetRef.UID]; !ok {
 				pod := &corev1.Pod{}
-				if err := e.client.Get(e.ctx, client.ObjectKey{Namespace: e.Namespace, Name: address.TargetRef.Name}, pod); err != nil {
+				if err := e.get(client.ObjectKey{Namespace: e.Namespace, Name: address.TargetRef.Name}, pod); err != nil {
 					return nil, err
 				}
 				podMap[address.TargetRef.UID] = pod
@@ -122,7 +157,7 @@ func (e *EndpointsData) Pods() ([]PodData, error) {
 	i := 0
 	for _, pod := range podMap {
 		pods[i] = PodData{e.TemplateData, pod}
-		e.watcher.Status.AddResource(dnsv1.WatchResourceKindPod, pod.Namespace, pod.Name)
+		e.track(dnsv1.WatchResourceKindPod, pod)
 		i++
 	}
 	return pods, nil
@@ -138,10 +173,10 @@ func (p *PodData) Node() (*NodeData, error) {
 		return nil, nil
 	}
 	node := &corev1.Node{}
-	if err := p.client.Get(p.ctx, client.ObjectKey{Name: p.Spec.NodeName}, node); err != nil {
+	if err := p.get(client.ObjectKey{Name: p.Spec.NodeName}, node); err != nil {
 		return nil, err
 	}
-	p.watcher.Status.AddResource(dnsv1.WatchResourceKindNode, node.Namespace, node.Name)
+	p.track(dnsv1.WatchResourceKindNode, node)
 	return &NodeData{p.TemplateData, node}, nil
 }
 
@@ -159,11 +194,13 @@ func (n *NodeData) Ready() bool {
 	return false
 }
 
-func NewTemplateData(ctx context.Context, watcher *dnsv1.ResourceWatcher, client client.Client) TemplateData {
+func NewTemplateData(ctx context.Context, watcher *dnsv1.ResourceWatcher, client client.Client, limits RenderLimits) TemplateData {
 	return TemplateData{
-		ctx:     ctx,
-		watcher: watcher,
-		client:  client,
+		ctx:      ctx,
+		watcher:  watcher,
+		client:   client,
+		versions: make(map[string]string),
+		render:   newRenderState(limits),
 	}
 }
 
@@ -173,7 +210,6 @@ type RecordTemplateData struct {
 }
 
 func (d *RecordTemplateData) Record() *dnsv1.Record {
-	d.watcher.Status.AddResource(dnsv1.WatchResourceKindRecord, d.record.Namespace, d.record.Name)
 	return d.record
 }
 
@@ -206,24 +242,37 @@ func NewServiceTemplateData(data TemplateData, service *corev1.Service) *Service
 }
 
 func NewTemplate(name string) *template.Template {
-	return template.New(name).
-		Funcs(sprig.FuncMap()).
-		Funcs(template.FuncMap{
-			"toYaml": func(v any) (string, error) {
-				if v == nil || reflect.ValueOf(v).IsNil() {
-					return "", nil
-				}
-				bs, err := yaml.Marshal(v)
-				if err != nil {
-					return "", err
-				}
-				return string(bs), nil
-			},
-			"unPtrStr": func(v *string) string {
-				if v == nil {
-					return ""
-				}
-				return *v
-			},
-		})
+	return template.New(name).Funcs(templateFuncs)
+}
+
+// templateFuncs are the functions of the templates, a render of a ResourceWatcher counts their calls against its step limit
+var templateFuncs = newTemplateFuncs()
+
+func newTemplateFuncs() template.FuncMap {
+	funcs := sprig.FuncMap()
+	for name, fn := range (template.FuncMap{
+		"toYaml": func(v any) (string, error) {
+			if v == nil || reflect.ValueOf(v).IsNil() {
+				return "", nil
+			}
+			bs, err := yaml.Marshal(v)
+			if err != nil {
+				return "", err
+			}
+			return string(bs), nil
+		},
+		// bound to the partials of the template for every render of a ResourceWatcher
+		"include": func(name string, data any) (string, error) {
+			return "", fmt.Errorf("include %q is not supported by this template", name)
+		},
+		"unPtrStr": func(v *string) string {
+			if v == nil {
+				return ""
+			}
+			return *v
+		},
+	}) {
+		funcs[name] = fn
+	}
+	return funcs
 }
@@ -0,0 +1,160 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+)
+
+// DefaultTriggerWindows coalesces the triggers of the resources changing in bursts, e.g. during a rolling update
+const DefaultTriggerWindows = "Endpoints=1s,Pod=1s,Node=10s"
+
+// maxTriggerEventResources limits the resources listed in an aggregated Trigger event
+const maxTriggerEventResources = 5
+
+// ParseTriggerWindows parses a comma separated list of <kind>=<duration>,
+// the triggers of a kind in its window are coalesced into one render of the ResourceWatcher
+func ParseTriggerWindows(s string) (map[dnsv1.WatchResourceKind]time.Duration, error) {
+	windows := make(map[dnsv1.WatchResourceKind]time.Duration)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kind, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid trigger window %q, expected <kind>=<duration>", item)
+		}
+		window, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trigger window %q: %w", item, err)
+		}
+		switch dnsv1.WatchResourceKind(kind) {
+		case dnsv1.WatchResourceKindTemplate, dnsv1.WatchResourceKindClusterTemplate, dnsv1.WatchResourceKindNamespace,
+			dnsv1.WatchResourceKindIngress, dnsv1.WatchResourceKindService, dnsv1.WatchResourceKindEndpoints,
+			dnsv1.WatchResourceKindNode, dnsv1.WatchResourceKindPod, dnsv1.WatchResourceKindRecord,
+			dnsv1.WatchResourceKindTemplateLibrary, dnsv1.WatchResourceKindClusterTemplateLibrary:
+			windows[dnsv1.WatchResourceKind(kind)] = window
+		default:
+			return nil, fmt.Errorf("invalid trigger window %q: %w", item, ErrorUnknownKind)
+		}
+	}
+	return windows, nil
+}
+
+// statusOnlyUpdate reports whether the update changed nothing but the status of the object
+func statusOnlyUpdate(oldObj, newObj client.Object) bool {
+	if oldObj == nil || newObj == nil {
+		return false
+	}
+	strip := func(obj client.Object) (map[string]any, error) {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+		delete(content, "status")
+		if metadata, ok := content["metadata"].(map[string]any); ok {
+			delete(metadata, "resourceVersion")
+			delete(metadata, "managedFields")
+		}
+		return content, nil
+	}
+	oldContent, err := strip(oldObj)
+	if err != nil {
+		return false
+	}
+	newContent, err := strip(newObj)
+	if err != nil {
+		return false
+	}
+	return equality.Semantic.DeepEqual(oldContent, newContent)
+}
+
+// statusIdentifiers are the fields and methods of the template data reading the status of a resource
+var statusIdentifiers = map[string]bool{"Status": true, "Ready": true}
+
+// serializingFuncs read every field of their argument, including the status
+var serializingFuncs = map[string]bool{"toYaml": true, "toJson": true, "toPrettyJson": true, "toRawJson": true}
+
+// templateReadsStatus reports whether tpl or the templates it includes may read the status of a resource
+func templateReadsStatus(tpl *template.Template) bool {
+	visited := make(map[string]bool)
+	var readsTemplate func(name string) bool
+	readsTemplate = func(name string) bool {
+		if visited[name] {
+			return false
+		}
+		visited[name] = true
+		// templates which cannot be resolved are assumed to read the status
+		t := tpl.Lookup(name)
+		if t == nil || t.Tree == nil {
+			return true
+		}
+		return walkNodes(t.Tree.Root, func(node parse.Node) bool {
+			switch n := node.(type) {
+			case *parse.FieldNode:
+				return identsRead(n.Ident)
+			case *parse.ChainNode:
+				return identsRead(n.Field)
+			case *parse.VariableNode:
+				return identsRead(n.Ident[1:])
+			case *parse.IdentifierNode:
+				return serializingFuncs[n.Ident]
+			case *parse.StringNode:
+				return strings.EqualFold(n.Text, "status")
+			case *parse.TemplateNode:
+				return readsTemplate(n.Name)
+			case *parse.CommandNode:
+				// partials included by a name computed at render time are unknown
+				if name, ok := includeName(n); ok {
+					return name == "" || readsTemplate(name)
+				}
+			}
+			return false
+		})
+	}
+	return readsTemplate(tpl.Name())
+}
+
+func identsRead(idents []string) bool {
+	for _, ident := range idents {
+		if statusIdentifiers[ident] {
+			return true
+		}
+	}
+	return false
+}
+
+// triggers collects the resources which triggered a render of a ResourceWatcher until it is reconciled
+type triggers map[types.NamespacedName][]string
+
+func (t triggers) add(watcher types.NamespacedName, resource string) {
+	for _, r := range t[watcher] {
+		if r == resource {
+			return
+		}
+	}
+	t[watcher] = append(t[watcher], resource)
+}
+
+// take removes and returns the message of the aggregated Trigger event of the watcher, empty if it was not triggered
+func (t triggers) take(watcher types.NamespacedName) string {
+	resources := t[watcher]
+	delete(t, watcher)
+	if len(resources) == 0 {
+		return ""
+	}
+	if len(resources) <= maxTriggerEventResources {
+		return fmt.Sprintf("Record re-parsing, triggered by %s", strings.Join(resources, ", "))
+	}
+	return fmt.Sprintf("Record re-parsing, triggered by %s and %d more", strings.Join(resources[:maxTriggerEventResources], ", "), len(resources)-maxTriggerEventResources)
+}
@@ -0,0 +1,142 @@
+package dns
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+)
+
+func TestParseTriggerWindows(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wants   map[dnsv1.WatchResourceKind]time.Duration
+		wantErr bool
+		// the error must wrap it
+		wantErrIs error
+	}{
+		{name: "default", value: DefaultTriggerWindows, wants: map[dnsv1.WatchResourceKind]time.Duration{
+			dnsv1.WatchResourceKindEndpoints: time.Second, dnsv1.WatchResourceKindPod: time.Second, dnsv1.WatchResourceKindNode: 10 * time.Second,
+		}},
+		{name: "empty", value: "", wants: map[dnsv1.WatchResourceKind]time.Duration{}},
+		{name: "spaces and empty items", value: " Service=500ms, ,Record=0s ", wants: map[dnsv1.WatchResourceKind]time.Duration{
+			dnsv1.WatchResourceKindService: 500 * time.Millisecond, dnsv1.WatchResourceKindRecord: 0,
+		}},
+		{name: "last wins", value: "Pod=1s,Pod=2s", wants: map[dnsv1.WatchResourceKind]time.Duration{dnsv1.WatchResourceKindPod: 2 * time.Second}},
+		{name: "missing duration", value: "Pod", wantErr: true},
+		{name: "invalid duration", value: "Pod=soon", wantErr: true},
+		{name: "unknown kind", value: "Secret=1s", wantErr: true, wantErrIs: ErrorUnknownKind},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			windows, err := ParseTriggerWindows(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", windows)
+				}
+				if tt.wantErrIs != nil && !errors.Is(err, tt.wantErrIs) {
+					t.Fatalf("expected %v, got %v", tt.wantErrIs, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(windows) != len(tt.wants) {
+				t.Fatalf("windows = %v, want %v", windows, tt.wants)
+			}
+			for kind, window := range tt.wants {
+				if got, ok := windows[kind]; !ok || got != window {
+					t.Errorf("window of %s = %s, want %s", kind, got, window)
+				}
+			}
+		})
+	}
+}
+
+func TestStatusOnlyUpdate(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default", ResourceVersion: "1", Labels: map[string]string{"app": "web"}},
+		Spec:       corev1.PodSpec{NodeName: "node-1"},
+		Status:     corev1.PodStatus{PodIP: "10.0.0.1"},
+	}
+	modify := func(modify func(pod *corev1.Pod)) *corev1.Pod {
+		pod := pod.DeepCopy()
+		pod.ResourceVersion = "2"
+		modify(pod)
+		return pod
+	}
+	tests := []struct {
+		name   string
+		oldObj client.Object
+		newObj client.Object
+		wants  bool
+	}{
+		{name: "status", oldObj: pod, newObj: modify(func(pod *corev1.Pod) { pod.Status.PodIP = "10.0.0.2" }), wants: true},
+		{name: "resourceVersion only", oldObj: pod, newObj: modify(func(pod *corev1.Pod) {}), wants: true},
+		{name: "managedFields", oldObj: pod, newObj: modify(func(pod *corev1.Pod) {
+			pod.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: "kubelet"}}
+		}), wants: true},
+		{name: "labels", oldObj: pod, newObj: modify(func(pod *corev1.Pod) { pod.Labels["app"] = "api" }), wants: false},
+		{name: "spec", oldObj: pod, newObj: modify(func(pod *corev1.Pod) { pod.Spec.NodeName = "node-2" }), wants: false},
+		{name: "spec and status", oldObj: pod, newObj: modify(func(pod *corev1.Pod) {
+			pod.Spec.NodeName = "node-2"
+			pod.Status.PodIP = "10.0.0.2"
+		}), wants: false},
+		{name: "no old object", newObj: pod, wants: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := statusOnlyUpdate(tt.oldObj, tt.newObj); got != tt.wants {
+				t.Errorf("statusOnlyUpdate = %v, want %v", got, tt.wants)
+			}
+		})
+	}
+}
+
+func TestTemplateReadsStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		partials map[string]string
+		wants    bool
+	}{
+		{name: "spec only", template: `{{ .Ingress.Spec.Rules }}`, wants: false},
+		{name: "status field", template: `{{ range .Service.Status.LoadBalancer.Ingress }}{{ .IP }}{{ end }}`, wants: true},
+		{name: "status of a variable", template: `{{ $svc := .Service }}{{ $svc.Status }}`, wants: true},
+		{name: "status of a chain", template: `{{ (index .Pods 0).Status.PodIP }}`, wants: true},
+		{name: "ready", template: `{{ if .Record.Ready }}ok{{ end }}`, wants: true},
+		{name: "index by string", template: `{{ index .Object "status" }}`, wants: true},
+		{name: "serialized", template: `{{ toYaml .Node }}`, wants: true},
+		{name: "defined template", template: `{{ define "ip" }}{{ .Status.PodIP }}{{ end }}{{ template "ip" .Pod }}`, wants: true},
+		{name: "defined template without status", template: `{{ define "name" }}{{ .Name }}{{ end }}{{ template "name" .Pod }}`, wants: false},
+		{name: "included partial", template: `{{ include "lib.ip" .Pod }}`, partials: map[string]string{"lib.ip": `{{ .Status.PodIP }}`}, wants: true},
+		{name: "included partial without status", template: `{{ include "lib.name" .Pod }}`, partials: map[string]string{"lib.name": `{{ .Name }}`}, wants: false},
+		{name: "recursive partial", template: `{{ include "lib.loop" . }}`, partials: map[string]string{"lib.loop": `{{ include "lib.loop" . }}`}, wants: false},
+		{name: "missing partial", template: `{{ include "lib.missing" . }}`, wants: true},
+		{name: "computed include", template: `{{ include (printf "lib.%s" .Name) . }}`, partials: map[string]string{"lib.name": `{{ .Name }}`}, wants: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := NewTemplate("base")
+			for name, partial := range tt.partials {
+				if _, err := set.New(name).Parse(partial); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tpl, err := set.New("test").Parse(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := templateReadsStatus(tpl); got != tt.wants {
+				t.Errorf("templateReadsStatus = %v, want %v", got, tt.wants)
+			}
+		})
+	}
+}
@@ -0,0 +1,349 @@
+// Package zonefile writes and parses RFC 1035 zone files
+package zonefile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+)
+
+const DefaultTTL = 300
+
+// Zone holds the header of a zone file
+type Zone struct {
+	// Origin of the zone, without the trailing dot
+	Origin string
+	// TTL of records which do not specify one
+	TTL int
+	// Serial of the SOA record
+	Serial uint64
+}
+
+// NextSerial returns a serial in the YYYYMMDDnn convention which is greater than old
+func NextSerial(old uint64, now time.Time) uint64 {
+	date, _ := strconv.ParseUint(now.UTC().Format("20060102")+"00", 10, 64)
+	if old < date {
+		return date
+	}
+	return old + 1
+}
+
+// Fqdn returns name with a trailing dot
+func Fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// CompareRecords orders records by name, type and value
+func CompareRecords(a, b dnsv1.RecordSpec) int {
+	if c := strings.Compare(a.Name, b.Name); c != 0 {
+		return c
+	}
+	if c := strings.Compare(string(a.Type), string(b.Type)); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Value, b.Value)
+}
+
+// InZone reports whether name is the origin or a name below it
+func InZone(name string, origin string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	origin = strings.ToLower(strings.TrimSuffix(origin, "."))
+	return origin == "" || name == origin || strings.HasSuffix(name, "."+origin)
+}
+
+// quoteString quotes a character-string, escaping quotes and backslashes
+// and writing non-printable bytes as \DDD as described in RFC 1035 section 5.1
+func quoteString(value string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// quoteTXT quotes the value of a TXT record, splitting it into strings of at most 255 bytes
+func quoteTXT(value string) string {
+	if strings.HasPrefix(value, `"`) {
+		return value
+	}
+	parts := make([]string, 0, len(value)/255+1)
+	for len(value) > 255 {
+		parts = append(parts, quoteString(value[:255]))
+		value = value[255:]
+	}
+	parts = append(parts, quoteString(value))
+	return strings.Join(parts, " ")
+}
+
+// formatValue returns the rdata of the record, names in the value are written as FQDN
+func formatValue(record *dnsv1.RecordSpec) string {
+	fields := strings.Fields(record.Value)
+	switch record.Type {
+	case dnsv1.RecordTypeCNAME, dnsv1.RecordTypeNS, dnsv1.RecordTypePTR:
+		return Fqdn(record.Value)
+	case dnsv1.RecordTypeMX, dnsv1.RecordTypeSRV:
+		if len(fields) > 1 {
+			fields[len(fields)-1] = Fqdn(fields[len(fields)-1])
+		}
+		return strings.Join(fields, " ")
+	case dnsv1.RecordTypeTXT:
+		return quoteTXT(record.Value)
+	}
+	return record.Value
+}
+
+// Write writes the records as a zone file in a stable order,
+// it fails without writing anything if a record is not in the zone
+func Write(w io.Writer, zone *Zone, records []dnsv1.RecordSpec) error {
+	for i := range records {
+		if !InZone(records[i].Name, zone.Origin) {
+			return fmt.Errorf("record %s is not in zone %s", records[i].Name, zone.Origin)
+		}
+	}
+	ttl := zone.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	origin := Fqdn(zone.Origin)
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "$ORIGIN %s\n", origin)
+	fmt.Fprintf(b, "$TTL %d\n", ttl)
+	fmt.Fprintf(b, "@\tIN\tSOA\tns.dns.%s hostmaster.%s %d 7200 1800 86400 %d\n", origin, origin, zone.Serial, ttl)
+
+	records = slices.Clone(records)
+	slices.SortFunc(records, CompareRecords)
+	for i := range records {
+		record := &records[i]
+		recordTTL := record.TTL
+		if recordTTL == 0 {
+			recordTTL = ttl
+		}
+		fmt.Fprintf(b, "%s\t%d\tIN\t%s\t%s\n", Fqdn(record.Name), recordTTL, record.Type, formatValue(record))
+	}
+	return b.Flush()
+}
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+// tokenize splits a line into tokens, it returns the change of the parenthesis depth
+func tokenize(line string, lineNumber int) (tokens []token, depth int, err error) {
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == ';':
+			return tokens, depth, nil
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ' ' || c == '\t' || c == '\r':
+		case c == '"':
+			var b strings.Builder
+			for i++; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+3 < len(line) && isDigits(line[i+1:i+4]) {
+					// \DDD is the decimal value of a byte
+					n, _ := strconv.Atoi(line[i+1 : i+4])
+					if n > 255 {
+						return nil, 0, fmt.Errorf("line %d: invalid escape \\%s", lineNumber, line[i+1:i+4])
+					}
+					b.WriteByte(byte(n))
+					i += 3
+					continue
+				}
+				if line[i] == '\\' && i+1 < len(line) {
+					i++
+				}
+				b.WriteByte(line[i])
+			}
+			if i >= len(line) {
+				return nil, 0, fmt.Errorf("line %d: unterminated quoted string", lineNumber)
+			}
+			tokens = append(tokens, token{text: b.String(), quoted: true})
+		default:
+			start := i
+			for i < len(line) && !strings.ContainsRune(" \t\r;()\"", rune(line[i])) {
+				i++
+			}
+			tokens = append(tokens, token{text: line[start:i]})
+			i--
+		}
+	}
+	return tokens, depth, nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTTL parses a TTL in seconds or with the BIND units (s, m, h, d, w)
+func parseTTL(s string) (int, bool) {
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return 0, false
+	}
+	total, current := 0, 0
+	for _, c := range strings.ToLower(s) {
+		if c >= '0' && c <= '9' {
+			current = current*10 + int(c-'0')
+			continue
+		}
+		unit := map[rune]int{'s': 1, 'm': 60, 'h': 3600, 'd': 86400, 'w': 604800}[c]
+		if unit == 0 {
+			return 0, false
+		}
+		total, current = total+current*unit, 0
+	}
+	return total + current, true
+}
+
+func isClass(s string) bool {
+	switch strings.ToUpper(s) {
+	case "IN", "CH", "HS", "CS":
+		return true
+	}
+	return false
+}
+
+// resolve returns the absolute name without the trailing dot
+func resolve(name string, origin string) string {
+	switch {
+	case name == "@":
+		return origin
+	case strings.HasSuffix(name, "."):
+		return strings.TrimSuffix(name, ".")
+	case origin == "":
+		return name
+	}
+	return name + "." + origin
+}
+
+var supportedTypes = []dnsv1.RecordType{
+	dnsv1.RecordTypeA, dnsv1.RecordTypeAAAA, dnsv1.RecordTypeCNAME, dnsv1.RecordTypeTXT, dnsv1.RecordTypeMX,
+	dnsv1.RecordTypeSRV, dnsv1.RecordTypeNS, dnsv1.RecordTypeCAA, dnsv1.RecordTypePTR,
+}
+
+// Parse parses a zone file, origin is used until a $ORIGIN directive is found.
+// SOA records and record types which are not supported by Record are returned as skipped.
+func Parse(r io.Reader, origin string) (records []dnsv1.RecordSpec, skipped []string, err error) {
+	origin = strings.TrimSuffix(origin, ".")
+	defaultTTL := 0
+	owner := origin
+
+	scanner := bufio.NewScanner(r)
+	lineNumber, depth := 0, 0
+	var tokens []token
+	ownerOmitted := false
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		lineTokens, lineDepth, err := tokenize(line, lineNumber)
+		if err != nil {
+			return nil, nil, err
+		}
+		if depth == 0 {
+			ownerOmitted = line != "" && (line[0] == ' ' || line[0] == '\t')
+		}
+		tokens = append(tokens, lineTokens...)
+		if depth += lineDepth; depth > 0 {
+			continue
+		}
+		if len(tokens) == 0 {
+			continue
+		}
+
+		if strings.HasPrefix(tokens[0].text, "$") {
+			switch directive := strings.ToUpper(tokens[0].text); {
+			case directive == "$ORIGIN" && len(tokens) > 1:
+				origin = resolve(tokens[1].text, origin)
+			case directive == "$TTL" && len(tokens) > 1:
+				ttl, ok := parseTTL(tokens[1].text)
+				if !ok {
+					return nil, nil, fmt.Errorf("line %d: invalid ttl %s", lineNumber, tokens[1].text)
+				}
+				defaultTTL = ttl
+			default:
+				return nil, nil, fmt.Errorf("line %d: unsupported directive %s", lineNumber, tokens[0].text)
+			}
+			tokens = tokens[:0]
+			continue
+		}
+
+		rest := tokens
+		if !ownerOmitted {
+			owner = resolve(rest[0].text, origin)
+			rest = rest[1:]
+		}
+		ttl := defaultTTL
+		for len(rest) > 0 {
+			if t, ok := parseTTL(rest[0].text); ok {
+				ttl = t
+			} else if !isClass(rest[0].text) {
+				break
+			}
+			rest = rest[1:]
+		}
+		if len(rest) < 2 {
+			return nil, nil, fmt.Errorf("line %d: missing record type or value", lineNumber)
+		}
+
+		recordType := dnsv1.RecordType(strings.ToUpper(rest[0].text))
+		rdata := rest[1:]
+		tokens = tokens[:0]
+		if !slices.Contains(supportedTypes, recordType) {
+			skipped = append(skipped, fmt.Sprintf("%s %s", owner, recordType))
+			continue
+		}
+
+		values := make([]string, 0, len(rdata))
+		for i, t := range rdata {
+			switch {
+			case recordType == dnsv1.RecordTypeTXT:
+				values = append(values, t.text)
+			case t.quoted:
+				values = append(values, strconv.Quote(t.text))
+			case i == len(rdata)-1 && slices.Contains([]dnsv1.RecordType{dnsv1.RecordTypeCNAME, dnsv1.RecordTypeNS, dnsv1.RecordTypePTR, dnsv1.RecordTypeMX, dnsv1.RecordTypeSRV}, recordType):
+				values = append(values, resolve(t.text, origin))
+			default:
+				values = append(values, t.text)
+			}
+		}
+		separator := " "
+		if recordType == dnsv1.RecordTypeTXT {
+			separator = ""
+		}
+		records = append(records, dnsv1.RecordSpec{Name: owner, Type: recordType, Value: strings.Join(values, separator), TTL: ttl})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if depth != 0 {
+		return nil, nil, fmt.Errorf("line %d: unbalanced parentheses", lineNumber)
+	}
+	return records, skipped, nil
+}
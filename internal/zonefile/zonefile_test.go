@@ -0,0 +1,144 @@
+package zonefile
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	dnsv1 "github.com/xzzpig/kube-dns-manager/api/dns/v1"
+)
+
+func TestParse(t *testing.T) {
+	zone := `$ORIGIN example.com.
+$TTL 1h
+@	IN	SOA	ns1.example.com. admin.example.com. (
+		2024050100 ; serial
+		7200 3600 1209600 3600 )
+@		IN	A	10.0.0.1
+		IN	AAAA	fd00::1
+www	300	IN	CNAME	@
+mail	IN	300	MX	10 mx
+_sip._tcp	SRV	10 20 5060 sip.other.org.
+@	TXT	"v=spf1 -all" ; comment
+long	TXT	"hello " "world"
+@	CAA	0 issue "letsencrypt.org"
+@	HTTPS	1 . alpn=h2
+`
+	records, skipped, err := Parse(strings.NewReader(zone), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []dnsv1.RecordSpec{
+		{Name: "example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.1", TTL: 3600},
+		{Name: "example.com", Type: dnsv1.RecordTypeAAAA, Value: "fd00::1", TTL: 3600},
+		{Name: "www.example.com", Type: dnsv1.RecordTypeCNAME, Value: "example.com", TTL: 300},
+		{Name: "mail.example.com", Type: dnsv1.RecordTypeMX, Value: "10 mx.example.com", TTL: 300},
+		{Name: "_sip._tcp.example.com", Type: dnsv1.RecordTypeSRV, Value: "10 20 5060 sip.other.org", TTL: 3600},
+		{Name: "example.com", Type: dnsv1.RecordTypeTXT, Value: "v=spf1 -all", TTL: 3600},
+		{Name: "long.example.com", Type: dnsv1.RecordTypeTXT, Value: "hello world", TTL: 3600},
+		{Name: "example.com", Type: dnsv1.RecordTypeCAA, Value: `0 issue "letsencrypt.org"`, TTL: 3600},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("expected %d records, got %d: %+v", len(expected), len(records), records)
+	}
+	for i := range expected {
+		if CompareRecords(records[i], expected[i]) != 0 || records[i].TTL != expected[i].TTL {
+			t.Errorf("record %d: expected %+v, got %+v", i, expected[i], records[i])
+		}
+	}
+	if !slices.Equal(skipped, []string{"example.com SOA", "example.com HTTPS"}) {
+		t.Errorf("unexpected skipped records %v", skipped)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	records := []dnsv1.RecordSpec{
+		{Name: "www.example.com", Type: dnsv1.RecordTypeCNAME, Value: "example.com", TTL: 60},
+		{Name: "example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.1", TTL: 300},
+		{Name: "example.com", Type: dnsv1.RecordTypeMX, Value: "10 mail.example.com", TTL: 300},
+		{Name: "example.com", Type: dnsv1.RecordTypeTXT, Value: strings.Repeat("x", 300), TTL: 300},
+		{Name: "example.com", Type: dnsv1.RecordTypeCAA, Value: `0 issue "letsencrypt.org"`, TTL: 300},
+	}
+	var b strings.Builder
+	if err := Write(&b, &Zone{Origin: "example.com", TTL: 300, Serial: 1}, records); err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, err := Parse(strings.NewReader(b.String()), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.SortFunc(records, CompareRecords)
+	if !slices.EqualFunc(records, parsed, func(a, b dnsv1.RecordSpec) bool { return CompareRecords(a, b) == 0 && a.TTL == b.TTL }) {
+		t.Fatalf("round trip mismatch:\n%s\n%+v", b.String(), parsed)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, zone := range []string{
+		"$INCLUDE other.zone\n",
+		"www IN A\n",
+		"www TXT \"unterminated\n",
+		"@ SOA ns. admin. ( 1 2 3\n",
+	} {
+		if _, _, err := Parse(strings.NewReader(zone), "example.com"); err == nil {
+			t.Errorf("expected an error for %q", zone)
+		}
+	}
+}
+
+func TestNextSerial(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for old, expected := range map[uint64]uint64{
+		0:          2024050100,
+		2024043005: 2024050100,
+		2024050100: 2024050101,
+		2024050299: 2024050300,
+	} {
+		if serial := NextSerial(old, now); serial != expected {
+			t.Errorf("NextSerial(%d) = %d, expected %d", old, serial, expected)
+		}
+	}
+}
+
+func TestQuoteTXT(t *testing.T) {
+	for value, expected := range map[string]string{
+		"v=spf1 -all":    `"v=spf1 -all"`,
+		`say "hi" \o/`:   `"say \"hi\" \\o/"`,
+		"tab\tnewline\n": `"tab\009newline\010"`,
+		"caf\u00e9":      `"caf\195\169"`,
+		`"kept" "as is"`: `"kept" "as is"`,
+	} {
+		if quoted := quoteTXT(value); quoted != expected {
+			t.Errorf("quoteTXT(%q) = %s, expected %s", value, quoted, expected)
+		}
+	}
+
+	// escaped values are parsed back into the original bytes
+	value := "a\"b\\c\td\u00e9"
+	records, _, err := Parse(strings.NewReader("@ TXT "+quoteTXT(value)+"\n"), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Value != value {
+		t.Fatalf("expected %q, got %+v", value, records)
+	}
+}
+
+func TestWriteOutOfZone(t *testing.T) {
+	records := []dnsv1.RecordSpec{
+		{Name: "Example.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.1"},
+		{Name: "www.example.com.", Type: dnsv1.RecordTypeA, Value: "10.0.0.1"},
+		{Name: "notexample.com", Type: dnsv1.RecordTypeA, Value: "10.0.0.2"},
+	}
+	var b strings.Builder
+	if err := Write(&b, &Zone{Origin: "example.com"}, records); err == nil {
+		t.Fatal("expected an error for a record out of the zone")
+	}
+	if b.Len() != 0 {
+		t.Fatalf("expected nothing to be written, got %q", b.String())
+	}
+	if err := Write(&b, &Zone{Origin: "example.com."}, records[:2]); err != nil {
+		t.Fatal(err)
+	}
+}